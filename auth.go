@@ -1,16 +1,27 @@
 package main
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
+// SignedFramePath serves the latest frame to holders of a signed URL instead of the token
+const SignedFramePath = "/api/stream/frame/signed"
+
 type AuthMiddleware struct {
 	mu        sync.RWMutex
 	secretKey string
+	revoked   chan struct{} // closed (and replaced) when the token changes
+	basicUser string        // username required for HTTP Basic auth; empty = any
 }
 
 func generateToken() string {
@@ -19,18 +30,31 @@ func generateToken() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
-func NewAuthMiddleware(secretKey string) *AuthMiddleware {
-	return &AuthMiddleware{secretKey: secretKey}
+func NewAuthMiddleware(secretKey, basicUser string) *AuthMiddleware {
+	return &AuthMiddleware{secretKey: secretKey, revoked: make(chan struct{}), basicUser: basicUser}
 }
 
-// UpdateToken swaps the active bearer token (after a regenerate-token call).
+// UpdateToken swaps the active bearer token (after a regenerate-token call) and
+// signals Revoked so long-lived requests made with the old token end.
 func (am *AuthMiddleware) UpdateToken(newKey string) {
 	am.mu.Lock()
 	am.secretKey = newKey
+	close(am.revoked)
+	am.revoked = make(chan struct{})
 	am.mu.Unlock()
 }
 
-// Check validates the bearer token from the Authorization header or ?token= query param.
+// Revoked returns a channel that is closed the next time the token changes.
+// Streaming handlers grab it when they start and stop once it closes, since the
+// middleware only checks the token when a request begins.
+func (am *AuthMiddleware) Revoked() <-chan struct{} {
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+	return am.revoked
+}
+
+// Check validates the token from the Authorization header (Bearer, or Basic with
+// the token as the password) or the ?token= query param.
 func (am *AuthMiddleware) Check(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/health" {
@@ -38,12 +62,28 @@ func (am *AuthMiddleware) Check(next http.Handler) http.Handler {
 			return
 		}
 
+		// Signed frame URLs carry an HMAC instead of the token, so they can be
+		// embedded in an <img> without handing out full API access
+		if r.URL.Path == SignedFramePath {
+			q := r.URL.Query()
+			if !am.verifyFrameSignature(q.Get("camera"), q.Get("exp"), q.Get("sig")) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		var token string
+		authHeader := r.Header.Get("Authorization")
 
-		if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		if authHeader != "" {
 			parts := strings.Split(authHeader, " ")
 			if len(parts) == 2 && parts[0] == "Bearer" {
 				token = parts[1]
+			} else if user, pass, ok := r.BasicAuth(); ok && (am.basicUser == "" || user == am.basicUser) {
+				// For clients that only speak Basic (NVRs, curl -u, browser prompts)
+				token = pass
 			}
 		}
 
@@ -56,6 +96,11 @@ func (am *AuthMiddleware) Check(next http.Handler) http.Handler {
 		am.mu.RUnlock()
 
 		if token == "" || token != key {
+			// Let a browser opening an API URL directly prompt for credentials;
+			// the dashboard always sends a header, so it never sees the prompt
+			if authHeader == "" && token == "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="dash-of-pi"`)
+			}
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
@@ -63,3 +108,29 @@ func (am *AuthMiddleware) Check(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// SignFrameURL returns the query string for a signed frame URL that's valid for
+// cameraID until exp. Regenerating the token invalidates every signed URL.
+func (am *AuthMiddleware) SignFrameURL(cameraID string, exp time.Time) string {
+	expStr := strconv.FormatInt(exp.Unix(), 10)
+	return fmt.Sprintf("camera=%s&exp=%s&sig=%s", url.QueryEscape(cameraID), expStr, am.frameSignature(cameraID, expStr))
+}
+
+func (am *AuthMiddleware) frameSignature(cameraID, exp string) string {
+	am.mu.RLock()
+	key := am.secretKey
+	am.mu.RUnlock()
+
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "camera=%s&exp=%s", cameraID, exp)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyFrameSignature checks a signed frame URL's sig and that exp hasn't passed
+func (am *AuthMiddleware) verifyFrameSignature(cameraID, exp, sig string) bool {
+	expUnix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || sig == "" || time.Now().Unix() > expUnix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(am.frameSignature(cameraID, exp)))
+}
@@ -3,25 +3,62 @@ package camera
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sync"
 	"time"
 )
 
+const (
+	// DefaultOpenAttempts is how many times a camera tries to open its device
+	// before it's reported as failed, unless SetOpenAttempts says otherwise
+	DefaultOpenAttempts = 3
+	// OpenRetryDelay is the pause between attempts to open a device that has
+	// never recorded
+	OpenRetryDelay = 2 * time.Second
+)
+
 // CameraConfig represents the configuration for a single camera
 type CameraConfig struct {
 	ID             string `json:"id"`
 	Name           string `json:"name"`
 	Device         string `json:"device"`
 	Rotation       int    `json:"rotation"`
+	FlipHorizontal bool   `json:"flip_horizontal"`
+	FlipVertical   bool   `json:"flip_vertical"`
 	ResWidth       int    `json:"res_width"`
 	ResHeight      int    `json:"res_height"`
 	Bitrate        int    `json:"bitrate"`
 	FPS            int    `json:"fps"`
 	MJPEGQuality   int    `json:"mjpeg_quality"`
 	EmbedTimestamp bool   `json:"embed_timestamp"`
+	LabelOverlay   bool   `json:"label_overlay"`
 	Enabled        bool   `json:"enabled"`
+
+	SnapshotIntervalS int `json:"snapshot_interval_s"` // 0 = no interval snapshots
+	SnapshotRetain    int `json:"snapshot_retain"`     // newest snapshots kept; 0 = DefaultSnapshotRetain
+
+	FrameWindowKB int     `json:"frame_window_kb"` // live-frame read window; 0 = FrameBufferSizeKB
+	PreviewScale  float64 `json:"preview_scale"`   // 0 < scale < 1 records a downscaled copy for the live frame
+
+	PreviewNoOverlay bool `json:"preview_no_overlay"` // the live frame skips the timestamp, label and watermark
+
+	VideoDir string `json:"video_dir,omitempty"` // records here instead of <video dir>/<ID>
+
+	WatermarkFile     string `json:"watermark_file,omitempty"`     // image overlaid on every frame; "" = none
+	WatermarkPosition string `json:"watermark_position,omitempty"` // a Watermark* corner; "" = WatermarkBottomRight
+
+	ContinuousRecording *bool `json:"continuous_recording,omitempty"` // overrides the manager-wide setting; nil = follow it
+
+	PipeCommand string `json:"pipe_command,omitempty"` // shell command fed the recording (as MJPEG) on stdin; "" = none
+}
+
+// StorageDir returns the directory the camera records to: its own VideoDir if
+// set, otherwise <videoDir>/<ID>
+func (c CameraConfig) StorageDir(videoDir string) string {
+	if c.VideoDir != "" {
+		return c.VideoDir
+	}
+	return filepath.Join(videoDir, c.ID)
 }
 
 // Camera handles video capture and recording for a single camera
@@ -29,29 +66,104 @@ type Camera struct {
 	camConfig     CameraConfig
 	logger        Logger
 	done          chan struct{}
+	stopOnce      sync.Once
 	streamManager *StreamManager
 	lastErrorTime time.Time
-	recordCmd     *exec.Cmd
+	runner        Runner
+	nice          int     // niceness for the recording process; 0 = unchanged
+	cpus          string  // taskset CPU list for the recording process; "" = any
+	recordProc    Process // running ffmpeg/rpicam-vid, guarded by cmdMu
 	cmdMu         sync.Mutex
 	videoEncoder  string
-	segmentLength int
-	isCSI         bool // cached on startup; avoids shelling out rpicam-still every segment
+	isCSI         bool        // cached on startup; avoids shelling out rpicam-still every segment
+	continuous    bool        // record through the segment muxer (see SetContinuousRecording)
+	pipeFrames    chan []byte // recorded frames on their way to the pipe command (USB cameras); nil = none
+	frameCounters frameCounters
+
+	// stateMu guards settings the manager can change while the recording loop runs
+	stateMu         sync.Mutex
+	segmentLength   int         // seconds; read when each new segment starts
+	segmentMode     string      // SegmentModeTime, SegmentModeSize or SegmentModeBoth
+	segmentMaxBytes int64       // size limit for the size/both modes
+	paused          bool        // no new segments start while true
+	pendingEvents   []time.Time // marked since the current segment started (see MarkEvent)
+	storageLayout   string      // StorageLayoutFlat or StorageLayoutDaily
+	currentDir      string      // directory of the segment being recorded
+
+	// How long Stop lets the recorder finalize its segment before killing it;
+	// guarded by stateMu
+	stopGrace time.Duration
+
+	// Tries to open the device before it's reported as failed (see Start);
+	// guarded by stateMu
+	openAttempts int
+
+	// The recorder's last command line (program first) and when it started, for
+	// debugging; guarded by stateMu
+	lastCommand     []string
+	lastCommandTime time.Time
+
+	// Live-frame updater health (see FrameUpdaterHealth); guarded by stateMu
+	lastFrameAt     time.Time
+	updaterRestarts int
+
+	// Closed once recordProc has exited; guarded by cmdMu
+	recordExited chan struct{}
+
+	// Frames ffmpeg reported for the segment just recorded; recording loop only
+	lastSegmentFrames int
+
+	// WatermarkFile was missing when the last segment started, so it was recorded
+	// without one; recording loop only
+	watermarkMissing bool
 }
 
-// NewCamera creates a new camera instance
-func NewCamera(config CameraConfig, segmentLength int, logger Logger) (*Camera, error) {
+// NewCamera creates a new camera instance. videoEncoder is the host's H.264
+// encoder, detected once by the manager for all cameras (see detectVideoEncoder).
+func NewCamera(config CameraConfig, segmentLength int, videoEncoder string, logger Logger) (*Camera, error) {
+	if !ValidRotation(config.Rotation) {
+		logger.Warnf("Camera '%s' (%s): Invalid rotation %d (expected 0, 90, 180 or 270). Ignoring rotation.", config.Name, config.ID, config.Rotation)
+		config.Rotation = 0
+	}
+	if !ValidWatermarkPosition(config.WatermarkPosition) {
+		logger.Warnf("Camera '%s' (%s): Invalid watermark position %q. Using %s.", config.Name, config.ID, config.WatermarkPosition, WatermarkBottomRight)
+		config.WatermarkPosition = WatermarkBottomRight
+	}
+
 	camera := &Camera{
 		camConfig:     config,
 		logger:        logger,
 		done:          make(chan struct{}),
 		segmentLength: segmentLength,
+		runner:        ExecRunner{},
+		videoEncoder:  videoEncoder,
 	}
 
-	// Detect camera type and encoder once on startup rather than per-segment.
+	// Detect camera type once on startup rather than per-segment.
 	// IsCSICamera shells out to rpicam-still, which is slow and may conflict
 	// with an active rpicam-vid process if called during recording.
 	camera.isCSI = IsCSICamera(logger, config.Device)
-	camera.videoEncoder = detectVideoEncoder(logger)
+
+	// rpicam-vid MJPEG encoder does not support 90/270 degree rotation (transpose)
+	// See: https://github.com/raspberrypi/rpicam-apps/issues/505
+	// Drop it here so the reported output size matches what is actually recorded.
+	if camera.isCSI && (config.Rotation == 90 || config.Rotation == 270) {
+		logger.Warnf("Camera '%s': Rotation %d is not supported by rpicam-vid MJPEG encoder. Ignoring rotation to prevent crash.", config.Name, config.Rotation)
+		camera.camConfig.Rotation = 0
+	}
+
+	if camera.isCSI && config.PreviewScale > 0 && config.PreviewScale < 1 {
+		logger.Warnf("Camera '%s': preview_scale is not supported for CSI cameras (rpicam-vid). Ignoring.", config.Name)
+	}
+	if camera.isCSI && config.PreviewNoOverlay {
+		logger.Warnf("Camera '%s': preview_no_overlay is not supported for CSI cameras (rpicam-vid). Ignoring.", config.Name)
+	}
+
+	// ffmpeg writes the pipe command a copy of the recording; rpicam-vid has a
+	// single output, so a CSI camera's pipe command gets the live frames instead
+	if config.PipeCommand != "" && !camera.isCSI {
+		camera.pipeFrames = make(chan []byte, frameSinkBuffer)
+	}
 
 	if camera.isCSI {
 		logger.Printf("Camera '%s' (%s): Using libcamera (rpicam-vid) for CSI camera", config.Name, config.ID)
@@ -62,6 +174,12 @@ func NewCamera(config CameraConfig, segmentLength int, logger Logger) (*Camera,
 	return camera, nil
 }
 
+// SetRunner replaces how the camera launches ffmpeg/rpicam-vid (default ExecRunner).
+// Must be called before Start.
+func (c *Camera) SetRunner(r Runner) {
+	c.runner = r
+}
+
 // SetStreamManager connects the camera to a stream manager
 func (c *Camera) SetStreamManager(sm *StreamManager) {
 	c.streamManager = sm
@@ -81,6 +199,22 @@ func (c *Camera) Start(videoDir string) error {
 	// Start background frame extraction to cache frames for faster /api/stream/frame responses
 	go c.backgroundFrameUpdate(videoDir)
 
+	if c.camConfig.SnapshotIntervalS > 0 {
+		go c.snapshotLoop(videoDir)
+	}
+
+	if c.pipeFrames != nil || (c.camConfig.PipeCommand != "" && c.streamManager != nil) {
+		go c.runPipe()
+	}
+
+	seq := nextSegmentSeq(videoDir)
+
+	// Until a segment records anything, failures are treated as the device still
+	// initializing (common for USB cameras right after boot): they're retried
+	// quietly up to openAttempts times before the camera is reported as failed
+	opened := false
+	openFailures := 0
+
 	for {
 		select {
 		case <-c.done:
@@ -88,23 +222,54 @@ func (c *Camera) Start(videoDir string) error {
 		default:
 		}
 
-		timestamp := time.Now().Format("2006-01-02_15-04-05")
-		// Record to MJPEG (Motion JPEG) - supports real-time streaming and safe interruption recovery
-		// Each frame is a complete JPEG, so files remain readable during recording
-		filename := filepath.Join(videoDir, fmt.Sprintf("dashcam_%s_%s.mjpeg", c.camConfig.ID, timestamp))
-
-		c.logger.Debugf("Camera '%s': Starting recording segment: %s", c.camConfig.Name, filepath.Base(filename))
+		if c.isPaused() {
+			select {
+			case <-c.done:
+				return nil
+			case <-time.After(time.Second):
+			}
+			continue
+		}
 
+		var recorded bool
 		var err error
-		if c.isCSI {
-			err = c.recordAndStreamSegmentLibcamera(filename)
+		if c.continuousRecording() {
+			recorded, err = c.recordContinuous(videoDir, &seq)
 		} else {
-			err = c.recordAndStreamSegment(filename)
+			recorded, err = c.recordNextSegment(videoDir, &seq)
+		}
+
+		if !opened && recorded {
+			opened = true
+			if openFailures > 0 {
+				c.logger.Printf("Camera '%s': Opened after %d failed attempt(s)", c.camConfig.Name, openFailures)
+			}
+		}
+		if !opened && err != nil && !c.isPaused() && !c.isStopped() {
+			openFailures++
+			attempts := c.getOpenAttempts()
+			switch {
+			case openFailures < attempts:
+				c.logger.Debugf("Camera '%s': Open attempt %d/%d failed, retrying in %v: %v", c.camConfig.Name, openFailures, attempts, OpenRetryDelay, err)
+			case openFailures == attempts:
+				c.logger.Errorf("Camera '%s': Failed to open after %d attempt(s), still retrying: %v", c.camConfig.Name, attempts, err)
+				c.lastErrorTime = time.Now()
+			}
+			// A device that never opened fails instantly; don't spin on it
+			select {
+			case <-c.done:
+				return nil
+			case <-time.After(OpenRetryDelay):
+			}
+			if openFailures <= attempts {
+				continue
+			}
 		}
 
-		if err != nil {
+		// A pause or stop ends the running segment on purpose; that isn't a recording error
+		if err != nil && !c.isPaused() && !c.isStopped() {
 			if time.Since(c.lastErrorTime) > 5*time.Second {
-				c.logger.Printf("Camera '%s': Recording error: %v", c.camConfig.Name, err)
+				c.logger.Errorf("Camera '%s': Recording error: %v", c.camConfig.Name, err)
 				c.lastErrorTime = time.Now()
 			}
 		}
@@ -118,21 +283,239 @@ func (c *Camera) Start(videoDir string) error {
 	}
 }
 
-// backgroundFrameUpdate continuously extracts and caches frames from the latest segment
-// This ensures fresh frames are always available for the /api/stream/frame endpoint
-// Runs at 10 Hz (100ms) for near-realtime performance
+// recordNextSegment records one segment into videoDir (or its day directory)
+// under the next free sequence number from *seq, and writes its sidecar. It
+// reports whether the segment recorded anything.
+func (c *Camera) recordNextSegment(videoDir string, seq *int) (bool, error) {
+	// Record to MJPEG (Motion JPEG) - supports real-time streaming and safe interruption recovery
+	// Each frame is a complete JPEG, so files remain readable during recording
+	// Never reuse a name: two segments can start within the same second after a
+	// fast error/restart, and overwriting the earlier one would lose footage
+	segmentStart := time.Now()
+	dir := c.makeSegmentDir(videoDir, segmentStart)
+	filename, usedSeq := uniqueSegmentPath(dir, c.camConfig.ID, segmentStart, *seq)
+	*seq = usedSeq + 1
+	c.lastSegmentFrames = 0
+
+	c.logger.Debugf("Camera '%s': Starting recording segment: %s", c.camConfig.Name, filepath.Base(filename))
+
+	var err error
+	if c.isCSI {
+		err = c.recordAndStreamSegmentLibcamera(filename)
+	} else {
+		err = c.recordAndStreamSegment(filename)
+	}
+
+	c.finishSegment(filename, segmentStart, c.lastSegmentFrames)
+
+	info, statErr := os.Stat(filename)
+	return statErr == nil && info.Size() > 0, err
+}
+
+// makeSegmentDir creates and returns the directory a segment starting at t goes
+// in, falling back to videoDir itself if that fails, and records it as the
+// directory being recorded into
+func (c *Camera) makeSegmentDir(videoDir string, t time.Time) string {
+	dir := segmentDir(videoDir, c.getStorageLayout(), t)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.logger.Errorf("Camera '%s': Failed to create %s, recording to %s instead: %v", c.camConfig.Name, dir, videoDir, err)
+		dir = videoDir
+	}
+	c.setCurrentDir(dir)
+	return dir
+}
+
+// SetPaused pauses or resumes recording. Pausing ends the current segment right
+// away, cleanly as Stop does, and returns once nothing more is being written; the
+// recording loop idles until resumed.
+func (c *Camera) SetPaused(paused bool) {
+	c.stateMu.Lock()
+	c.paused = paused
+	c.stateMu.Unlock()
+
+	if paused {
+		c.endSegment()
+	}
+}
+
+// SetOpenAttempts sets how many times Start tries to open the device before it
+// reports the camera as failed; it keeps retrying after that, just not quietly
+func (c *Camera) SetOpenAttempts(n int) {
+	if n < 1 {
+		n = 1
+	}
+	c.stateMu.Lock()
+	c.openAttempts = n
+	c.stateMu.Unlock()
+}
+
+func (c *Camera) getOpenAttempts() int {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.openAttempts < 1 {
+		return DefaultOpenAttempts
+	}
+	return c.openAttempts
+}
+
+func (c *Camera) setLastCommand(name string, args []string) {
+	c.stateMu.Lock()
+	c.lastCommand = append([]string{name}, args...)
+	c.lastCommandTime = time.Now()
+	c.stateMu.Unlock()
+}
+
+// LastCommand returns the command line (program first) of the most recently
+// started ffmpeg/rpicam-vid for this camera and when it started, or nil if none
+// has been started yet
+func (c *Camera) LastCommand() ([]string, time.Time) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return append([]string(nil), c.lastCommand...), c.lastCommandTime
+}
+
+func (c *Camera) isStopped() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// SetStopGrace sets how long Stop waits for the recorder to close the current
+// segment after interrupting it; 0 kills it straight away.
+func (c *Camera) SetStopGrace(grace time.Duration) {
+	c.stateMu.Lock()
+	c.stopGrace = grace
+	c.stateMu.Unlock()
+}
+
+func (c *Camera) getStopGrace() time.Duration {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.stopGrace
+}
+
+func (c *Camera) isPaused() bool {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.paused
+}
+
+// SetStorageLayout sets where new segments go (StorageLayoutFlat or
+// StorageLayoutDaily), from the next segment on
+func (c *Camera) SetStorageLayout(layout string) {
+	c.stateMu.Lock()
+	c.storageLayout = layout
+	c.stateMu.Unlock()
+}
+
+func (c *Camera) getStorageLayout() string {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.storageLayout
+}
+
+func (c *Camera) setCurrentDir(dir string) {
+	c.stateMu.Lock()
+	c.currentDir = dir
+	c.stateMu.Unlock()
+}
+
+// getCurrentDir returns the directory being recorded into, or fallback before
+// the first segment starts
+func (c *Camera) getCurrentDir(fallback string) string {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.currentDir == "" {
+		return fallback
+	}
+	return c.currentDir
+}
+
+// SetSegmentLength changes the segment duration; the segment being recorded keeps
+// its length and the next one uses the new value.
+func (c *Camera) SetSegmentLength(seconds int) {
+	c.stateMu.Lock()
+	c.segmentLength = seconds
+	c.stateMu.Unlock()
+}
+
+// FrameUpdaterHealth shows whether a camera's live frame is still being
+// refreshed: when a frame was last extracted from its recording, and how often
+// the updater had to be restarted after a panic
+type FrameUpdaterHealth struct {
+	CameraID    string    `json:"camera_id"`
+	LastFrameAt time.Time `json:"last_frame_at"` // zero until the first frame
+	Restarts    int       `json:"restarts"`
+}
+
+// FrameUpdaterHealth returns the live-frame updater's health for this camera
+func (c *Camera) FrameUpdaterHealth() FrameUpdaterHealth {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return FrameUpdaterHealth{
+		CameraID:    c.camConfig.ID,
+		LastFrameAt: c.lastFrameAt,
+		Restarts:    c.updaterRestarts,
+	}
+}
+
+// backgroundFrameUpdate keeps the live frame fresh until Stop (see
+// runFrameUpdates). A panic in it would otherwise freeze the preview for good,
+// so it's logged and the updater started again after a second.
 func (c *Camera) backgroundFrameUpdate(videoDir string) {
+	for !c.runFrameUpdates(videoDir) {
+		c.stateMu.Lock()
+		c.updaterRestarts++
+		c.stateMu.Unlock()
+		select {
+		case <-c.done:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// runFrameUpdates continuously extracts and caches frames from the latest segment
+// This ensures fresh frames are always available for the /api/stream/frame endpoint
+// Runs at 10 Hz (100ms) for near-realtime performance. Returns true once the
+// camera stops, or false if it recovered from a panic.
+func (c *Camera) runFrameUpdates(videoDir string) (stopped bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Errorf("Camera '%s': Frame updater panicked, restarting it: %v", c.camConfig.Name, r)
+			stopped = false
+		}
+	}()
+
+	// A downscaled preview is much cheaper to read than the full-res recording
+	preview := c.hasPreview()
+	if preview {
+		videoDir = filepath.Join(videoDir, PreviewDirName)
+	}
+
 	ticker := time.NewTicker(100 * time.Millisecond) // Update frame at 10 Hz
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-c.done:
-			return
+			return true
 		case <-ticker.C:
-			frameData := ExtractFrameFromLatestSegment(videoDir, c.logger)
-			if len(frameData) > 0 && c.streamManager != nil {
-				c.streamManager.UpdateFrame(frameData)
+			dir := videoDir
+			if !preview {
+				dir = c.getCurrentDir(videoDir)
+			}
+			frameData := ExtractFrameFromLatestSegment(dir, c.camConfig.FrameWindowKB, c.logger)
+			if len(frameData) > 0 {
+				c.stateMu.Lock()
+				c.lastFrameAt = time.Now()
+				c.stateMu.Unlock()
+				if c.streamManager != nil {
+					c.streamManager.UpdateFrame(frameData)
+				}
 			}
 		}
 	}
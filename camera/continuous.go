@@ -0,0 +1,286 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// stagingDirName is the per-camera subdirectory ffmpeg's segment muxer writes
+	// new segments to before they're renamed into place. Listings, cleanup and
+	// exports skip it like any directory that isn't a day directory.
+	stagingDirName = ".recording"
+
+	// stagingPollInterval is how often continuous recording looks for the next
+	// segment; a new segment keeps its staging name at most this long
+	stagingPollInterval = 200 * time.Millisecond
+
+	// previewWrap is how many preview files continuous recording cycles through
+	previewWrap = 2
+
+	// stagedNamePattern is the segment muxer's strftime output name: the time the
+	// segment started, in SegmentTimeLayout, which becomes its final name's timestamp
+	stagedNamePattern = "%Y-%m-%d_%H-%M-%S.mjpeg"
+)
+
+// SetContinuousRecording makes the camera record with a single ffmpeg whose
+// segment muxer starts each segment, instead of one ffmpeg per segment, so no
+// frames are lost while one process exits and the next opens the device. The
+// camera's own ContinuousRecording, if set, wins over enabled, so a camera that
+// misbehaves with the segment muxer can stay on one process per segment. It only
+// applies to USB cameras in the time segment mode; other cameras, and the size
+// and both modes, keep recording one process per segment. Must be called before
+// Start.
+func (c *Camera) SetContinuousRecording(enabled bool) {
+	if c.camConfig.ContinuousRecording != nil {
+		enabled = *c.camConfig.ContinuousRecording
+	}
+	if enabled && c.isCSI {
+		c.logger.Warnf("Camera '%s': Continuous recording is not supported for CSI cameras (rpicam-vid). Recording one segment at a time.", c.camConfig.Name)
+	}
+	c.continuous = enabled
+}
+
+// continuousRecording reports whether the next recording runs the segment muxer
+func (c *Camera) continuousRecording() bool {
+	return c.continuous && !c.isCSI && c.getSegmentLimits().maxBytes == 0
+}
+
+// recordContinuous records segments back to back with one ffmpeg until it
+// exits: on stop or pause, on an error, or once the segment limits change, which
+// restarts it with the new ones. The segment muxer writes each segment to the
+// staging directory named after the time it started; as soon as one appears it
+// is renamed to its usual name, with the next sequence number from *seq, and
+// directory (ffmpeg keeps writing to the open file), and the segment before it
+// gets its sidecar. It reports whether anything was recorded.
+func (c *Camera) recordContinuous(videoDir string, seq *int) (bool, error) {
+	limits := c.getSegmentLimits()
+
+	staging := filepath.Join(videoDir, stagingDirName)
+	if err := os.MkdirAll(staging, 0755); err != nil {
+		return false, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	// Anything left here never made it into place, e.g. recording stopped within
+	// a poll of the segment starting; move it in before ffmpeg could reuse its name
+	for _, staged := range stagedSegments(staging) {
+		info, err := os.Stat(staged)
+		if err != nil || info.Size() == 0 {
+			os.Remove(staged)
+			continue
+		}
+		start := stagedStart(staged, info.ModTime())
+		final, used := uniqueSegmentPath(c.makeSegmentDir(videoDir, start), c.camConfig.ID, start, *seq)
+		if err := os.Rename(staged, final); err != nil {
+			c.logger.Errorf("Camera '%s': Failed to move leftover segment into place: %v", c.camConfig.Name, err)
+			continue
+		}
+		*seq = used + 1
+	}
+	stuck := make(map[string]bool) // staged segments that couldn't be moved
+
+	// The preview alternates between a couple of files instead of growing forever;
+	// the live frame is read from whichever was written last
+	preview := ""
+	if c.hasPreview() {
+		previewDir := filepath.Join(videoDir, PreviewDirName)
+		if err := os.MkdirAll(previewDir, 0755); err != nil {
+			return false, fmt.Errorf("failed to create preview directory: %w", err)
+		}
+		preview = filepath.Join(previewDir, "preview_%d.mjpeg")
+	}
+	args := buildContinuousRecordArgs(c.recordConfig(), limits.seconds, filepath.Join(staging, stagedNamePattern), preview)
+
+	frameStats := &segmentFrameStats{counters: &c.frameCounters}
+	stderrOutput := &stderrTail{limit: 16 * 1024}
+	name, args := PriorityArgs(c.nice, c.cpus, "ffmpeg", args)
+	c.setLastCommand(name, args)
+	c.cmdMu.Lock()
+	proc, err := c.runner.Start(context.Background(), name, args, c.pipeOutput(), frameStats.stderrWriter(stderrOutput))
+	if err != nil {
+		c.cmdMu.Unlock()
+		return false, err
+	}
+	c.recordProc = proc
+	exited := make(chan struct{})
+	c.recordExited = exited
+	c.cmdMu.Unlock()
+
+	// A stop or pause that came in before recordProc was set found nothing to
+	// end; this process runs until interrupted, so end it now
+	stopping := c.isStopped() || c.isPaused()
+	if stopping {
+		c.interruptRecorder(proc, exited)
+	}
+
+	c.logger.Debugf("Camera '%s': Recording continuously in %ds segments", c.camConfig.Name, limits.seconds)
+
+	waitErr := make(chan error, 1)
+	go func() {
+		err := proc.Wait()
+		c.cmdMu.Lock()
+		c.recordProc = nil
+		c.recordExited = nil
+		close(exited)
+		c.cmdMu.Unlock()
+		waitErr <- err
+	}()
+
+	var (
+		current      string // renamed segment ffmpeg is writing to; "" before the first
+		currentStart time.Time
+		startFrames  int64 // frame count when current started
+		recorded     bool
+		restarting   bool
+	)
+	// finish writes the sidecar of the segment that just ended
+	finish := func() {
+		if current == "" {
+			return
+		}
+		frames := frameStats.frames.Load()
+		c.finishSegment(current, currentStart, int(frames-startFrames))
+		if info, err := os.Stat(current); err == nil && info.Size() > 0 {
+			recorded = true
+		}
+		startFrames = frames
+	}
+	// promote renames newly started segments into place
+	promote := func() {
+		for _, staged := range stagedSegments(staging) {
+			if stuck[staged] {
+				continue
+			}
+			finish()
+			currentStart = time.Now()
+			start := stagedStart(staged, currentStart)
+			dir := c.makeSegmentDir(videoDir, start)
+			final, used := uniqueSegmentPath(dir, c.camConfig.ID, start, *seq)
+			*seq = used + 1
+			if err := os.Rename(staged, final); err != nil {
+				c.logger.Errorf("Camera '%s': Failed to move segment into place, leaving it in %s: %v", c.camConfig.Name, staging, err)
+				stuck[staged] = true
+				final = staged
+			}
+			current = final
+			c.logger.Debugf("Camera '%s': Recording segment: %s", c.camConfig.Name, filepath.Base(final))
+		}
+	}
+
+	ticker := time.NewTicker(stagingPollInterval)
+	defer ticker.Stop()
+	var recordErr error
+	done := c.done // nil once handled, so a closed channel doesn't spin the loop
+	for running := true; running; {
+		select {
+		case recordErr = <-waitErr:
+			running = false
+		case <-done:
+			done = nil
+			if !stopping {
+				stopping = true
+				c.interruptRecorder(proc, exited)
+			}
+		case <-ticker.C:
+			if !stopping && c.isPaused() {
+				stopping = true
+				c.interruptRecorder(proc, exited)
+			}
+			// A new segment length (or a switch to a size mode) needs a new
+			// process; the segment being recorded ends early
+			if !stopping && !restarting && c.getSegmentLimits() != limits {
+				c.logger.Printf("Camera '%s': Segment settings changed, restarting the recorder", c.camConfig.Name)
+				restarting = true
+				proc.Interrupt()
+			}
+		}
+		promote()
+	}
+	finish()
+
+	if recordErr != nil && !restarting && !stopping {
+		if stderrOutput.Len() > 0 {
+			return recorded, fmt.Errorf("%w: %s", recordErr, stderrOutput.String())
+		}
+		return recorded, recordErr
+	}
+	return recorded, nil
+}
+
+// stagedSegments returns the segments in the staging directory, oldest first
+func stagedSegments(staging string) []string {
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".mjpeg") {
+			paths = append(paths, filepath.Join(staging, entry.Name()))
+		}
+	}
+	// The timestamps sort in order, short of a clock jump within one poll
+	sort.Strings(paths)
+	return paths
+}
+
+// stagedStart returns the start time a staged segment is named after, or
+// fallback if the name doesn't parse
+func stagedStart(path string, fallback time.Time) time.Time {
+	// ffmpeg formats the name in local time, as SegmentFilename does
+	start, err := time.ParseInLocation(SegmentTimeLayout, strings.TrimSuffix(filepath.Base(path), ".mjpeg"), time.Local)
+	if err != nil {
+		return fallback
+	}
+	return start
+}
+
+// buildContinuousRecordArgs returns the ffmpeg arguments that record MJPEG
+// segments of segmentSeconds back to back through the segment muxer, into files
+// named by the strftime pattern. Every MJPEG frame is a keyframe, so each
+// segment starts exactly where the previous one ended, and each starts at
+// timestamp zero like a segment recorded on its own. A preview pattern (with a
+// %d verb) gets the downscaled copy in files that are reused in turn. With a
+// PipeCommand, a copy of the recording goes to stdout as one MJPEG stream.
+func buildContinuousRecordArgs(config CameraConfig, segmentSeconds int, pattern, preview string) []string {
+	args := recordInputArgs(config, preview != "")
+	args = append(args,
+		"-c:v", "mjpeg",
+		"-q:v", fmt.Sprintf("%d", config.MJPEGQuality),
+		"-r", fmt.Sprintf("%d", config.FPS),
+		"-f", "segment",
+		"-segment_format", "mjpeg",
+		"-segment_time", fmt.Sprintf("%d", segmentSeconds),
+		"-reset_timestamps", "1",
+		"-strftime", "1",
+		pattern,
+	)
+	if preview != "" {
+		args = append(args,
+			"-map", "[preview]",
+			"-c:v", "mjpeg",
+			"-q:v", fmt.Sprintf("%d", config.MJPEGQuality),
+			"-r", fmt.Sprintf("%d", config.FPS),
+			"-f", "segment",
+			"-segment_format", "mjpeg",
+			"-segment_time", fmt.Sprintf("%d", segmentSeconds),
+			"-segment_wrap", fmt.Sprintf("%d", previewWrap),
+			preview,
+		)
+	}
+	if config.PipeCommand != "" {
+		args = append(args,
+			"-map", "[pipe]",
+			"-c:v", "mjpeg",
+			"-q:v", fmt.Sprintf("%d", config.MJPEGQuality),
+			"-r", fmt.Sprintf("%d", config.FPS),
+			"-f", "mjpeg",
+			"pipe:1",
+		)
+	}
+	return args
+}
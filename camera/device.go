@@ -0,0 +1,17 @@
+package camera
+
+import "os"
+
+// DevicePresent reports whether a camera's device node exists right now. Test
+// sources always count as present; an empty device means /dev/video0, as for
+// v4l2Driver.
+func DevicePresent(device string) bool {
+	if IsTestDevice(device) {
+		return true
+	}
+	if device == "" {
+		device = "/dev/video0"
+	}
+	_, err := os.Stat(device)
+	return err == nil
+}
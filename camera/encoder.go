@@ -1,22 +1,82 @@
 package camera
 
 import (
+	"context"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 )
 
+const (
+	// EncoderProbeFrames is how many frames isEncoderUsable encodes
+	EncoderProbeFrames = 3
+	// EncoderProbeTimeout bounds each probe, so a wedged hardware encoder can't
+	// hold up startup
+	EncoderProbeTimeout = 15 * time.Second
+)
+
+// EncoderAuto selects the encoder by probing (see detectVideoEncoder)
+const EncoderAuto = "auto"
+
+// resolveVideoEncoder returns the encoder to use: the one named by preference if
+// this ffmpeg has it, otherwise (or for "auto"/"") the best one detected.
+// Forcing an encoder skips the usability probe, for boards where a hardware
+// encoder passes the probe but produces broken output.
+func resolveVideoEncoder(preference string, logger Logger) string {
+	if preference == "" || preference == EncoderAuto {
+		return detectVideoEncoder(logger)
+	}
+
+	encoders, err := ffmpegEncoders()
+	if err != nil {
+		logger.Warnf("Can't check configured encoder %s (%v); using it anyway", preference, err)
+		return preference
+	}
+	if !encoders[preference] {
+		logger.Errorf("Configured encoder %s is not in `ffmpeg -encoders`; detecting one instead", preference)
+		return detectVideoEncoder(logger)
+	}
+	logger.Printf("Using configured video encoder %s", preference)
+	return preference
+}
+
+// ffmpegEncoders returns the names listed by `ffmpeg -encoders`
+func ffmpegEncoders() (map[string]bool, error) {
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-encoders").CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	// The list follows a "------" line; each entry is "<flags> <name> <description>"
+	encoders := make(map[string]bool)
+	inList := false
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !inList {
+			inList = strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 {
+			encoders[fields[1]] = true
+		}
+	}
+	return encoders, nil
+}
+
 // detectVideoEncoder checks available encoders and returns the best one
 // Priority: h264_v4l2m2m (Pi hardware) > h264_vaapi (generic hardware) > libopenh264 (open) > libx264 (fallback)
 func detectVideoEncoder(logger Logger) string {
-	cmd := exec.Command("ffmpeg", "-encoders")
-	output, err := cmd.CombinedOutput()
+	encoders, err := ffmpegEncoders()
 	if err != nil {
 		logger.Debugf("Failed to query FFmpeg encoders: %v", err)
 		return "libopenh264"
 	}
 
-	encodersOutput := string(output)
-
 	// Priority list of encoders to check
 	preferredEncoders := []string{
 		"h264_v4l2m2m", // Raspberry Pi hardware encoder
@@ -26,7 +86,7 @@ func detectVideoEncoder(logger Logger) string {
 	}
 
 	for _, encoder := range preferredEncoders {
-		if strings.Contains(encodersOutput, encoder) {
+		if encoders[encoder] {
 			// Test if encoder actually works with a quick validation
 			if isEncoderUsable(encoder, logger) {
 				return encoder
@@ -35,27 +95,66 @@ func detectVideoEncoder(logger Logger) string {
 	}
 
 	// Ultimate fallback
-	logger.Printf("[WARN] No suitable H.264 encoders found, defaulting to libopenh264")
+	logger.Warnf("No suitable H.264 encoders found, defaulting to libopenh264")
 	return "libopenh264"
 }
 
-// isEncoderUsable tests if an encoder can actually be used
+// isEncoderUsable encodes a few frames of a test pattern to a temp file and
+// checks the result holds decodable video. Just encoding to null isn't enough:
+// h264_v4l2m2m on a Pi often loads and "succeeds" while writing nothing usable.
 func isEncoderUsable(encoder string, logger Logger) bool {
-	// Skip hardware encoders that require specific hardware
-	if encoder == "h264_v4l2m2m" || encoder == "h264_vaapi" {
-		// Try a quick test to see if the encoder works
-		testCmd := exec.Command("ffmpeg",
-			"-f", "lavfi",
-			"-i", "color=c=black:s=640x480:d=0.1",
-			"-c:v", encoder,
-			"-f", "null",
-			"-",
-		)
-
-		if err := testCmd.Run(); err != nil {
-			logger.Debugf("Encoder %s not usable: %v", encoder, err)
-			return false
-		}
+	tmp, err := os.CreateTemp("", "dash-of-pi-encoder-*.mp4")
+	if err != nil {
+		logger.Debugf("Encoder probe can't create temp file: %v", err)
+		return false
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	ctx, cancel := context.WithTimeout(context.Background(), EncoderProbeTimeout)
+	defer cancel()
+
+	// testsrc rather than a flat colour so the encoder has real detail to code
+	encodeCmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-f", "lavfi",
+		"-i", "testsrc=size=640x480:rate=10",
+		"-frames:v", strconv.Itoa(EncoderProbeFrames),
+		"-pix_fmt", "yuv420p",
+		"-c:v", encoder,
+		tmpPath,
+	)
+	if output, err := encodeCmd.CombinedOutput(); err != nil {
+		logger.Debugf("Encoder %s not usable: %v: %s", encoder, err, strings.TrimSpace(string(output)))
+		return false
+	}
+
+	if info, err := os.Stat(tmpPath); err != nil || info.Size() == 0 {
+		logger.Debugf("Encoder %s not usable: produced no output", encoder)
+		return false
+	}
+
+	// Without ffprobe, a non-empty file is the best check available
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		return true
+	}
+	probeCmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-count_frames",
+		"-show_entries", "stream=nb_read_frames",
+		"-of", "csv=p=0",
+		tmpPath,
+	)
+	output, err := probeCmd.Output()
+	if err != nil {
+		logger.Debugf("Encoder %s not usable: output doesn't decode: %v", encoder, err)
+		return false
+	}
+	if frames, err := strconv.Atoi(strings.TrimSpace(string(output))); err != nil || frames == 0 {
+		logger.Debugf("Encoder %s not usable: output has no decodable frames (%q)", encoder, strings.TrimSpace(string(output)))
+		return false
 	}
 
 	return true
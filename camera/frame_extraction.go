@@ -1,6 +1,8 @@
 package camera
 
 import (
+	"bufio"
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
@@ -10,20 +12,22 @@ import (
 
 const (
 	// Frame extraction buffers
-	FrameBufferSizeKB = 256 // Read last 256KB from MJPEG file (typical frame: 80-150KB)
-	MaxFrameSizeKB    = 200 // Max size to search backwards for frame start (prevents old frames)
-	MinFileSize       = 100 // Skip extraction if file too small (not enough data yet)
+	FrameBufferSizeKB = 256  // Default window read from the end of an MJPEG file (typical frame: 80-150KB)
+	MaxFrameWindowKB  = 1024 // The window doubles up to this when it holds no complete frame
+	MaxFrameSizeKB    = 200  // Max size to search backwards for frame start (prevents old frames)
+	MinFileSize       = 100  // Skip extraction if file too small (not enough data yet)
 	BytesPerKB        = 1024
 )
 
 // ExtractFrameFromLatestSegment extracts a JPEG frame from the most recent MJPEG segment
 // MJPEG is just concatenated JPEGs, so we read the last JPEG directly from the file
-// This is near-instantaneous (no FFmpeg overhead) and works even while recording
-func ExtractFrameFromLatestSegment(videoDir string, logger Logger) []byte {
+// This is near-instantaneous (no FFmpeg overhead) and works even while recording.
+// windowKB is how much of the file's tail is read first (0 = FrameBufferSizeKB).
+func ExtractFrameFromLatestSegment(videoDir string, windowKB int, logger Logger) []byte {
 	// Find the latest MJPEG file
 	entries, err := os.ReadDir(videoDir)
 	if err != nil {
-		logger.Printf("[WARN] Failed to read video directory '%s': %v", videoDir, err)
+		logger.Warnf("Failed to read video directory '%s': %v", videoDir, err)
 		return nil
 	}
 
@@ -65,7 +69,16 @@ func ExtractFrameFromLatestSegment(videoDir string, logger Logger) []byte {
 
 	// Extract the last JPEG frame directly from the MJPEG file
 	// MJPEG = concatenated JPEGs with markers: FFD8 (start) ... FFD9 (end)
-	frameData := extractLastJPEGFromMJPEG(latestFile)
+	// A small window suits low-res cameras; if a frame is bigger than the window
+	// (or the window ends mid-frame), double it and try again up to MaxFrameWindowKB
+	if windowKB <= 0 {
+		windowKB = FrameBufferSizeKB
+	}
+	frameData, fileSize := extractLastJPEGFromMJPEG(latestFile, int64(windowKB)*BytesPerKB)
+	for len(frameData) == 0 && windowKB < MaxFrameWindowKB && int64(windowKB)*BytesPerKB < fileSize {
+		windowKB = min(windowKB*2, MaxFrameWindowKB)
+		frameData, fileSize = extractLastJPEGFromMJPEG(latestFile, int64(windowKB)*BytesPerKB)
+	}
 	if len(frameData) == 0 {
 		logger.Debugf("Could not extract JPEG frame from '%s'", filepath.Base(latestFile))
 		return nil
@@ -74,54 +87,67 @@ func ExtractFrameFromLatestSegment(videoDir string, logger Logger) []byte {
 	return frameData
 }
 
-// extractLastJPEGFromMJPEG reads the last complete JPEG frame from an MJPEG file
-// by scanning backwards for JPEG markers. This is near-instantaneous (no FFmpeg).
-func extractLastJPEGFromMJPEG(filepath string) []byte {
+// extractLastJPEGFromMJPEG reads the last complete JPEG frame within the final
+// readSize bytes of an MJPEG file by scanning backwards for JPEG markers. This is
+// near-instantaneous (no FFmpeg). The file size is returned too so the caller can
+// tell whether a larger window would see more of the file.
+func extractLastJPEGFromMJPEG(filepath string, readSize int64) ([]byte, int64) {
 	file, err := os.Open(filepath)
 	if err != nil {
-		return nil
+		return nil, 0
 	}
 	defer file.Close()
 
 	// Get file size
 	fileInfo, err := file.Stat()
 	if err != nil {
-		return nil
+		return nil, 0
 	}
 	fileSize := fileInfo.Size()
 
-	if fileSize < 4 {
-		return nil // Too small to be a valid JPEG
+	if fileSize < MinFileSize {
+		return nil, fileSize // Not enough data yet for a frame
 	}
 
-	// Read the last 1MB of the file (should contain at least one complete JPEG frame)
-	readSize := int64(1024 * 1024) // 1MB
-	if readSize > fileSize {
-		readSize = fileSize
+	// Read the tail of the file (should contain at least one complete JPEG frame)
+	buf, err := readTail(file, fileSize, readSize)
+	if err != nil {
+		return nil, fileSize
 	}
+	return lastJPEGFrame(buf), fileSize
+}
 
-	startPos := fileSize - readSize
-	_, err = file.Seek(startPos, 0)
-	if err != nil {
-		return nil
+// readTail reads the final readSize bytes of r, which is size bytes long.
+// A single Read may return less than asked for on a slow SD card or while
+// ffmpeg is appending, which would miss the newest end marker; ReadFull keeps
+// reading until the window is full. The file can only come up short if it was
+// truncated since Stat, in which case whatever was read is returned.
+func readTail(r io.ReadSeeker, size, readSize int64) ([]byte, error) {
+	if readSize > size {
+		readSize = size
+	}
+	if _, err := r.Seek(size-readSize, io.SeekStart); err != nil {
+		return nil, err
 	}
 
 	buf := make([]byte, readSize)
-	n, err := file.Read(buf)
-	if err != nil && err != io.EOF {
-		return nil
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
 	}
-	buf = buf[:n]
-
-	// Scan backwards for JPEG end marker (FFD9) followed by next start marker (FFD8) or EOF
-	// Work backwards from the end to find the last complete JPEG frame
-	var jpegEnd int64 = -1
-	var jpegStart int64 = -1
+	return buf[:n], nil
+}
 
-	// Find the last FFD9 (JPEG end marker)
-	for i := len(buf) - 1; i > 0; i-- {
-		if buf[i] == 0xD9 && buf[i-1] == 0xFF {
-			jpegEnd = int64(i) + 1
+// lastJPEGFrame returns the last complete JPEG frame in buf, or nil if there is none
+func lastJPEGFrame(buf []byte) []byte {
+	// Scan backwards for the last JPEG end marker (FFD9) that actually closes a
+	// frame: one followed by the next frame's start marker or by EOF. An FFD9 that
+	// appears elsewhere (e.g. closing an EXIF thumbnail inside a frame's header) is
+	// followed by more of the frame instead and is skipped.
+	jpegEnd := -1
+	for i := len(buf) - 2; i >= 0; i-- {
+		if buf[i] == 0xFF && buf[i+1] == 0xD9 && endsFrame(buf[i+2:]) {
+			jpegEnd = i + 2
 			break
 		}
 	}
@@ -130,16 +156,20 @@ func extractLastJPEGFromMJPEG(filepath string) []byte {
 		return nil // No JPEG end marker found
 	}
 
-	// Find the FFD8 (JPEG start marker) before the end
+	// Find the matching FFD8 (JPEG start marker) before the end. A real start
+	// marker is followed by another marker (FF D8 FF), and parsing the image from
+	// it must lead exactly to the end marker; a nested image (EXIF thumbnail) or
+	// marker-like bytes inside the frame don't, and are stepped over.
 	// Limit search to MaxFrameSizeKB to avoid finding very old frames
-	searchLimit := int(jpegEnd) - (MaxFrameSizeKB * BytesPerKB)
+	searchLimit := jpegEnd - (MaxFrameSizeKB * BytesPerKB)
 	if searchLimit < 0 {
 		searchLimit = 0
 	}
 
-	for i := int(jpegEnd) - 2; i >= searchLimit; i-- {
-		if buf[i] == 0xD8 && buf[i-1] == 0xFF {
-			jpegStart = int64(i) - 1
+	jpegStart := -1
+	for i := jpegEnd - 3; i >= searchLimit; i-- {
+		if isJPEGStart(buf[i:]) && jpegLength(buf[i:jpegEnd]) == jpegEnd-i {
+			jpegStart = i
 			break
 		}
 	}
@@ -152,6 +182,141 @@ func extractLastJPEGFromMJPEG(filepath string) []byte {
 	return buf[jpegStart:jpegEnd]
 }
 
+// isJPEGStart reports whether b begins with a start-of-image marker followed by
+// another marker (FF D8 FF), which random bytes rarely match
+func isJPEGStart(b []byte) bool {
+	return len(b) >= 3 && b[0] == 0xFF && b[1] == 0xD8 && b[2] == 0xFF
+}
+
+// jpegLength returns the length of the image starting at b[0], or -1 if b
+// doesn't hold all of it. Header segments are skipped by their length, so
+// whatever they carry (a thumbnail, tables, comments) can't end the image early;
+// in entropy-coded data FF 00 is a stuffed 0xFF and FF D0-D7 a restart marker,
+// and any other marker ends the scan.
+func jpegLength(b []byte) int {
+	if !isJPEGStart(b) {
+		return -1
+	}
+	i := 2
+	for {
+		if i+1 >= len(b) || b[i] != 0xFF {
+			return -1
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xFF: // fill byte before a marker
+			i++
+			continue
+		case marker == 0xD9:
+			return i + 2
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7): // no length
+			i += 2
+			continue
+		}
+
+		if i+3 >= len(b) {
+			return -1
+		}
+		length := int(b[i+2])<<8 | int(b[i+3])
+		if length < 2 {
+			return -1
+		}
+		i += 2 + length
+		if marker != 0xDA {
+			continue
+		}
+
+		// Start of scan: step through the entropy-coded data to the next marker
+		for {
+			if i+1 >= len(b) {
+				return -1
+			}
+			if b[i] == 0xFF && b[i+1] != 0x00 && (b[i+1] < 0xD0 || b[i+1] > 0xD7) {
+				break
+			}
+			i++
+		}
+	}
+}
+
+// endsFrame reports whether rest, the bytes after an FFD9, is what follows a
+// complete frame: nothing, or the start (possibly still being written) of the next
+func endsFrame(rest []byte) bool {
+	soi := []byte{0xFF, 0xD8, 0xFF}
+	if len(rest) < len(soi) {
+		return bytes.Equal(rest, soi[:len(rest)])
+	}
+	return isJPEGStart(rest)
+}
+
+// ExtractFrameAtIndex returns the JPEG frame at the given 0-based index in an MJPEG
+// file by walking FFD8 start markers from the beginning of the file. No FFmpeg is
+// involved, so stepping through a recorded segment frame-by-frame stays cheap.
+// Returns nil if the file has fewer frames than requested.
+func ExtractFrameAtIndex(filepath string, index int) []byte {
+	if index < 0 {
+		return nil
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, FrameBufferSizeKB*BytesPerKB)
+
+	frameIndex := -1
+	capturing := false
+	depth := 0 // >0 inside a frame; an embedded image (EXIF thumbnail) nests deeper
+	var frame []byte
+	var prev byte
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil // EOF (out of range or truncated frame) or read error
+		}
+
+		// Only an FFD8 followed by another marker starts an image
+		if prev == 0xFF && b == 0xD8 {
+			if next, err := reader.Peek(1); err == nil && next[0] == 0xFF {
+				if depth == 0 {
+					frameIndex++
+					if frameIndex == index {
+						capturing = true
+						frame = append(frame[:0], 0xFF)
+					}
+				}
+				depth++
+			}
+		}
+
+		if capturing {
+			frame = append(frame, b)
+		}
+		if prev == 0xFF && b == 0xD9 && depth > 0 {
+			depth--
+			if capturing && depth == 0 {
+				return frame
+			}
+		}
+
+		prev = b
+	}
+}
+
+// EstimateFrameCount approximates how many frames an MJPEG file of the given
+// size holds from the size of its first frame. Frames of one segment share
+// resolution and quality, so this is close without scanning the whole file.
+func EstimateFrameCount(filepath string, size int64) int {
+	first := ExtractFrameAtIndex(filepath, 0)
+	if len(first) == 0 {
+		return 0
+	}
+	return int(size / int64(len(first)))
+}
+
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
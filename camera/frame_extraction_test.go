@@ -0,0 +1,162 @@
+package camera
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFrame returns a minimal JPEG: SOI, an empty APP0 segment, a start of
+// scan with n bytes of fill as its entropy-coded data, and EOI. fill mustn't
+// be 0xFF.
+func testFrame(fill byte, n int) []byte {
+	return craftFrame(nil, bytes.Repeat([]byte{fill}, n))
+}
+
+// craftFrame returns a JPEG with the given header segments (each a marker
+// byte and its payload) after an APP0, and entropy as its scan data
+func craftFrame(segments [][]byte, entropy []byte) []byte {
+	frame := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x02}
+	for _, segment := range segments {
+		length := len(segment) + 1 // the payload plus the two length bytes
+		frame = append(frame, 0xFF, segment[0], byte(length>>8), byte(length))
+		frame = append(frame, segment[1:]...)
+	}
+	frame = append(frame, 0xFF, 0xDA, 0x00, 0x02)
+	frame = append(frame, entropy...)
+	return append(frame, 0xFF, 0xD9)
+}
+
+// shortReader returns at most max bytes from each Read, as a slow SD card or
+// a file still being appended to may
+type shortReader struct {
+	*bytes.Reader
+	max   int
+	reads int
+}
+
+func (r *shortReader) Read(p []byte) (int, error) {
+	r.reads++
+	if len(p) > r.max {
+		p = p[:r.max]
+	}
+	return r.Reader.Read(p)
+}
+
+func TestReadTailShortReads(t *testing.T) {
+	var mjpeg []byte
+	for _, fill := range []byte{0x11, 0x22, 0x33} {
+		mjpeg = append(mjpeg, testFrame(fill, 100)...)
+	}
+	last := testFrame(0x33, 100)
+
+	r := &shortReader{Reader: bytes.NewReader(mjpeg), max: 7}
+	buf, err := readTail(r, int64(len(mjpeg)), 200)
+	if err != nil {
+		t.Fatalf("readTail: %v", err)
+	}
+	if r.reads < 2 {
+		t.Fatalf("window filled in %d read, the reader didn't come up short", r.reads)
+	}
+	if !bytes.Equal(buf, mjpeg[len(mjpeg)-200:]) {
+		t.Fatalf("got %d bytes, want the final 200 of the stream", len(buf))
+	}
+	if got := lastJPEGFrame(buf); !bytes.Equal(got, last) {
+		t.Errorf("got a %d byte frame, want the newest (%d bytes)", len(got), len(last))
+	}
+}
+
+func TestReadTailTruncated(t *testing.T) {
+	// The file shrank after its size was read: what's there is still scanned
+	frame := testFrame(0x11, 100)
+	r := &shortReader{Reader: bytes.NewReader(frame), max: 7}
+	buf, err := readTail(r, int64(len(frame))+50, 200)
+	if err != nil {
+		t.Fatalf("readTail: %v", err)
+	}
+	if got := lastJPEGFrame(buf); !bytes.Equal(got, frame) {
+		t.Errorf("got %x, want the whole frame", got)
+	}
+}
+
+func TestExtractLastJPEGFromMJPEG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment.mjpeg")
+	last := testFrame(0x22, 100)
+	mjpeg := append(testFrame(0x11, 100), last...)
+	// The next frame is still being written
+	mjpeg = append(mjpeg, testFrame(0x33, 100)[:50]...)
+	if err := os.WriteFile(path, mjpeg, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, size := extractLastJPEGFromMJPEG(path, 1024)
+	if size != int64(2*len(last)+50) {
+		t.Errorf("size %d, want %d", size, 2*len(last)+50)
+	}
+	if !bytes.Equal(got, last) {
+		t.Errorf("got %x, want the last complete frame", got)
+	}
+}
+
+func TestLastJPEGFrameMarkerLikeBytes(t *testing.T) {
+	thumbnail := testFrame(0x44, 20)
+	stuffed := bytes.Repeat([]byte{0x12, 0xFF, 0x00, 0xD9, 0xFF, 0x00, 0xD8, 0xFF, 0x00, 0xFF, 0xD3}, 10)
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{
+			name:  "stuffed bytes and restart markers in the scan",
+			frame: craftFrame(nil, stuffed),
+		},
+		{
+			name:  "end marker bytes in a comment",
+			frame: craftFrame([][]byte{append([]byte{0xFE}, 0xFF, 0xD9, 'h', 'i', 0xFF, 0xD9)}, stuffed),
+		},
+		{
+			name:  "end marker bytes in a quantization table",
+			frame: craftFrame([][]byte{append([]byte{0xDB, 0x00}, bytes.Repeat([]byte{0xFF, 0xD9}, 32)...)}, stuffed),
+		},
+		{
+			name:  "start marker bytes in a comment",
+			frame: craftFrame([][]byte{{0xFE, 0xFF, 0xD8, 0xFF, 0xE0, 0x00}}, stuffed),
+		},
+		{
+			name:  "EXIF thumbnail",
+			frame: craftFrame([][]byte{append([]byte{0xE1, 'E', 'x', 'i', 'f', 0, 0}, thumbnail...)}, stuffed),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if n := jpegLength(tt.frame); n != len(tt.frame) {
+				t.Fatalf("jpegLength = %d, want %d", n, len(tt.frame))
+			}
+
+			// Between an older frame and the start of one still being written
+			var mjpeg []byte
+			mjpeg = append(mjpeg, testFrame(0x11, 100)...)
+			mjpeg = append(mjpeg, tt.frame...)
+			mjpeg = append(mjpeg, testFrame(0x33, 100)[:50]...)
+			if got := lastJPEGFrame(mjpeg); !bytes.Equal(got, tt.frame) {
+				t.Errorf("got %x\nwant %x", got, tt.frame)
+			}
+
+			// As the newest thing in the file
+			if got := lastJPEGFrame(append(testFrame(0x11, 100), tt.frame...)); !bytes.Equal(got, tt.frame) {
+				t.Errorf("at EOF got %x\nwant %x", got, tt.frame)
+			}
+		})
+	}
+}
+
+func TestJPEGLengthIncomplete(t *testing.T) {
+	frame := craftFrame([][]byte{{0xFE, 'h', 'i'}}, []byte{0x12, 0xFF, 0x00, 0x34})
+	for n := 0; n < len(frame); n++ {
+		if got := jpegLength(frame[:n]); got != -1 {
+			t.Errorf("jpegLength of the first %d bytes = %d, want -1", n, got)
+		}
+	}
+}
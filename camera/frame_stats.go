@@ -0,0 +1,124 @@
+package camera
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// FrameStats counts frames ffmpeg dropped or duplicated while recording, and the
+// warnings it logged when its input buffers overflowed. A steady rise in either
+// means rtbufsize/thread_queue_size or the resolution/FPS need tuning.
+type FrameStats struct {
+	CameraID         string `json:"camera_id"`
+	DroppedFrames    int64  `json:"dropped_frames"`
+	DuplicatedFrames int64  `json:"duplicated_frames"`
+	BufferOverflows  int64  `json:"buffer_overflows"`
+}
+
+// frameCounters accumulates FrameStats across segments; guarded by mu because the
+// recording loop writes while the status API reads
+type frameCounters struct {
+	mu    sync.Mutex
+	stats FrameStats
+}
+
+func (fc *frameCounters) add(dropped, duplicated, overflows int64) {
+	fc.mu.Lock()
+	fc.stats.DroppedFrames += dropped
+	fc.stats.DuplicatedFrames += duplicated
+	fc.stats.BufferOverflows += overflows
+	fc.mu.Unlock()
+}
+
+func (fc *frameCounters) snapshot() FrameStats {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.stats
+}
+
+// FrameStats returns this camera's dropped/duplicated frame counts since it started
+func (c *Camera) FrameStats() FrameStats {
+	stats := c.frameCounters.snapshot()
+	stats.CameraID = c.camConfig.ID
+	return stats
+}
+
+// lineWriter splits what's written to it into lines and hands each to onLine
+type lineWriter struct {
+	partial []byte
+	onLine  func(line string)
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.partial = append(lw.partial, p...)
+	for {
+		i := bytes.IndexByte(lw.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lw.onLine(strings.TrimRight(string(lw.partial[:i]), "\r"))
+		lw.partial = lw.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// segmentFrameStats follows one ffmpeg process: its -progress output (cumulative
+// drop_frames/dup_frames for the process) and its stderr warnings. Deltas are
+// added to the camera's counters as they arrive so status stays current.
+type segmentFrameStats struct {
+	counters            *frameCounters
+	dropped, duplicated int64        // last cumulative values seen from -progress
+	frames              atomic.Int64 // frames encoded so far, from -progress; read while ffmpeg runs
+}
+
+// progressLine handles one key=value line from ffmpeg -progress
+func (s *segmentFrameStats) progressLine(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return
+	}
+	switch key {
+	case "frame":
+		s.frames.Store(n)
+	case "drop_frames":
+		if n > s.dropped {
+			s.counters.add(n-s.dropped, 0, 0)
+			s.dropped = n
+		}
+	case "dup_frames":
+		if n > s.duplicated {
+			s.counters.add(0, n-s.duplicated, 0)
+			s.duplicated = n
+		}
+	}
+}
+
+// stderrWriter returns the writer for a recorder's stderr, which -progress
+// shares with ffmpeg's warnings: key=value lines go to progressLine, and every
+// other line is checked for overflow warnings and kept in tail for errors
+func (s *segmentFrameStats) stderrWriter(tail *stderrTail) io.Writer {
+	return &lineWriter{onLine: func(line string) {
+		if key, _, ok := strings.Cut(line, "="); ok && key != "" && !strings.ContainsAny(key, " \t[") {
+			s.progressLine(line)
+			return
+		}
+		s.stderrLine(line)
+		tail.Write([]byte(line + "\n"))
+	}}
+}
+
+// stderrLine counts input overflow warnings: a full real-time buffer (v4l2/dshow
+// "too full ... frame dropped") or a blocked thread message queue
+func (s *segmentFrameStats) stderrLine(line string) {
+	if strings.Contains(line, "too full") || strings.Contains(line, "thread_queue_size") {
+		s.counters.add(0, 0, 1)
+	}
+}
@@ -0,0 +1,90 @@
+package camera
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Storage layouts: segments directly in <camera>/, or in a directory per day
+// (<camera>/YYYY-MM-DD/) that can be offloaded and deleted wholesale
+const (
+	StorageLayoutFlat  = "flat"
+	StorageLayoutDaily = "daily"
+
+	DayDirLayout = "2006-01-02"
+)
+
+// IsDayDir reports whether name is a daily-layout directory (YYYY-MM-DD)
+func IsDayDir(name string) bool {
+	if len(name) != len(DayDirLayout) {
+		return false
+	}
+	_, err := time.Parse(DayDirLayout, name)
+	return err == nil
+}
+
+// SegmentFile is a file found by ListSegmentFiles
+type SegmentFile struct {
+	Path string
+	Info os.FileInfo
+}
+
+// ListSegmentFiles returns the files directly in cameraDir and in its day
+// directories, so footage is found whichever layout it was recorded with. Other
+// subdirectories (snapshots, preview) are skipped.
+func ListSegmentFiles(cameraDir string) ([]SegmentFile, error) {
+	entries, err := os.ReadDir(cameraDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []SegmentFile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if !IsDayDir(entry.Name()) {
+				continue
+			}
+			dayDir := filepath.Join(cameraDir, entry.Name())
+			dayEntries, err := os.ReadDir(dayDir)
+			if err != nil {
+				continue
+			}
+			for _, dayEntry := range dayEntries {
+				if dayEntry.IsDir() {
+					continue
+				}
+				if info, err := dayEntry.Info(); err == nil {
+					files = append(files, SegmentFile{Path: filepath.Join(dayDir, dayEntry.Name()), Info: info})
+				}
+			}
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, SegmentFile{Path: filepath.Join(cameraDir, entry.Name()), Info: info})
+		}
+	}
+	return files, nil
+}
+
+// ResolveSegmentPath returns where the segment called name lives under
+// cameraDir: directly in it, or else in the day directory its filename's
+// timestamp points to. name must already be a bare file name.
+func ResolveSegmentPath(cameraDir, name string) string {
+	flat := filepath.Join(cameraDir, name)
+	if _, err := os.Stat(flat); err == nil {
+		return flat
+	}
+	if start, _, ok := ParseSegmentName(name); ok {
+		return filepath.Join(cameraDir, start.Format(DayDirLayout), name)
+	}
+	return flat
+}
+
+// segmentDir returns the directory a segment starting at t is written to
+func segmentDir(cameraDir, layout string, t time.Time) string {
+	if layout == StorageLayoutDaily {
+		return filepath.Join(cameraDir, t.Format(DayDirLayout))
+	}
+	return cameraDir
+}
@@ -1,13 +1,14 @@
 package camera
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // LibcameraCapture manages rpicam-vid process for CSI cameras
@@ -54,7 +55,7 @@ func isLibcameraAvailable(logger Logger) bool {
 // a usable camera. rpicam-still prints "No cameras available!" when none are usable —
 // that string contains "camera", so we match the real listing header instead.
 func IsCSICamera(logger Logger, device string) bool {
-	if !isLibcameraAvailable(logger) {
+	if IsTestDevice(device) || !isLibcameraAvailable(logger) {
 		return false
 	}
 
@@ -88,8 +89,9 @@ func v4l2Driver(device string) string {
 // recordAndStreamSegmentLibcamera records video using rpicam-vid (libcamera)
 func (c *Camera) recordAndStreamSegmentLibcamera(filename string) error {
 	// Build rpicam-vid command for MJPEG output
+	limits := c.getSegmentLimits()
 	args := []string{
-		"-t", fmt.Sprintf("%d", c.segmentLength*1000), // timeout in milliseconds
+		"-t", fmt.Sprintf("%d", limits.seconds*1000), // timeout in milliseconds; 0 = until stopped
 		"--width", fmt.Sprintf("%d", c.camConfig.ResWidth),
 		"--height", fmt.Sprintf("%d", c.camConfig.ResHeight),
 		"--framerate", fmt.Sprintf("%d", c.camConfig.FPS),
@@ -99,68 +101,65 @@ func (c *Camera) recordAndStreamSegmentLibcamera(filename string) error {
 	}
 
 	if c.camConfig.EmbedTimestamp {
-		c.logger.Printf("[WARN] Camera '%s': Timestamp embedding is not supported for CSI cameras (rpicam-vid). Ignoring.", c.camConfig.Name)
+		c.logger.Warnf("Camera '%s': Timestamp embedding is not supported for CSI cameras (rpicam-vid). Ignoring.", c.camConfig.Name)
+	}
+	if c.camConfig.LabelOverlay {
+		c.logger.Warnf("Camera '%s': Label overlay is not supported for CSI cameras (rpicam-vid). Ignoring.", c.camConfig.Name)
+	}
+	if c.camConfig.WatermarkFile != "" {
+		c.logger.Warnf("Camera '%s': Watermark is not supported for CSI cameras (rpicam-vid). Ignoring.", c.camConfig.Name)
 	}
 
-	if c.camConfig.Rotation != 0 {
-		// rpicam-vid MJPEG encoder does not support 90/270 degree rotation (transpose)
-		// See: https://github.com/raspberrypi/rpicam-apps/issues/505
-		if c.camConfig.Rotation == 90 || c.camConfig.Rotation == 270 {
-			c.logger.Printf("[WARN] Camera '%s': Rotation %d is not supported by rpicam-vid MJPEG encoder. Ignoring rotation to prevent crash.", c.camConfig.Name, c.camConfig.Rotation)
-		} else {
-			args = append(args, "--rotation", fmt.Sprintf("%d", c.camConfig.Rotation))
-		}
+	// Rotation and mirroring are applied by the sensor pipeline. NewCamera has already
+	// dropped the 90/270 values rpicam-vid can't handle, so only flips remain here.
+	_, hflip, vflip := orientation(c.camConfig.Rotation, c.camConfig.FlipHorizontal, c.camConfig.FlipVertical)
+	if hflip {
+		args = append(args, "--hflip")
+	}
+	if vflip {
+		args = append(args, "--vflip")
 	}
 
-	recordCmd := exec.Command("rpicam-vid", args...)
+	// Log stderr (rpicam-vid debugging) and keep the last 4KB for error reporting
+	stderrBuf := &stderrTail{
+		limit:   4096,
+		onWrite: func(p []byte) { c.logger.Debugf("rpicam-vid: %s", string(p)) },
+	}
 
+	name, args := PriorityArgs(c.nice, c.cpus, "rpicam-vid", args)
+	c.setLastCommand(name, args)
 	c.cmdMu.Lock()
-	c.recordCmd = recordCmd
-	c.cmdMu.Unlock()
-
-	// Capture stderr for debugging
-	stderr, err := recordCmd.StderrPipe()
+	proc, err := c.runner.Start(context.Background(), name, args, nil, stderrBuf)
 	if err != nil {
-		return err
-	}
-
-	if err := recordCmd.Start(); err != nil {
-		c.cmdMu.Lock()
-		c.recordCmd = nil
 		c.cmdMu.Unlock()
 		return err
 	}
+	c.recordProc = proc
+	exited := make(chan struct{})
+	c.recordExited = exited
+	c.cmdMu.Unlock()
+	if c.isStopped() || c.isPaused() {
+		c.interruptRecorder(proc, exited) // a stop or pause came in before recordProc was set
+	}
 
-	var stderrBuf bytes.Buffer
-
-	// Log stderr (rpicam-vid debugging)
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			n, err := stderr.Read(buf)
-			if n > 0 {
-				chunk := buf[:n]
-				// Keep last 4KB of logs for error reporting
-				if stderrBuf.Len()+n > 4096 {
-					stderrBuf.Reset()
-				}
-				stderrBuf.Write(chunk)
-				c.logger.Debugf("rpicam-vid: %s", string(chunk))
-			}
-			if err != nil {
-				break
-			}
-		}
-	}()
+	// rpicam-vid has no size limit, so a watcher ends the segment at the limit
+	var rotated atomic.Bool
+	watchDone := make(chan struct{})
+	if limits.maxBytes > 0 {
+		go watchSegmentSize(filename, limits.maxBytes, proc, watchDone, &rotated)
+	}
 
 	// Wait for recording to complete
-	recordErr := recordCmd.Wait()
+	recordErr := proc.Wait()
+	close(watchDone)
 
 	c.cmdMu.Lock()
-	c.recordCmd = nil
+	c.recordProc = nil
+	c.recordExited = nil
+	close(exited)
 	c.cmdMu.Unlock()
 
-	if recordErr != nil {
+	if recordErr != nil && !rotated.Load() {
 		return fmt.Errorf("%w: %s", recordErr, stderrBuf.String())
 	}
 
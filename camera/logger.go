@@ -4,5 +4,7 @@ package camera
 type Logger interface {
 	Printf(format string, v ...interface{})
 	Debugf(format string, v ...interface{})
+	Warnf(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
 	Fatalf(format string, v ...interface{})
 }
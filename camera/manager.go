@@ -2,25 +2,53 @@ package camera
 
 import (
 	"fmt"
-	"path/filepath"
+	"sort"
 	"sync"
+	"time"
 )
 
 // CameraManager manages multiple camera instances
 type CameraManager struct {
-	cameras        map[string]*Camera        // ID -> Camera
-	streamManagers map[string]*StreamManager // ID -> StreamManager
-	logger         Logger
-	videoDir       string
-	segmentLength  int
-	mu             sync.RWMutex
-	cameraWg       sync.WaitGroup // Wait group for camera goroutines
-	stopCh         chan struct{}
-	stopOnce       sync.Once
-}
-
-// NewCameraManager creates a new camera manager
-func NewCameraManager(configs []CameraConfig, segmentLength int, videoDir string, logger Logger) (*CameraManager, error) {
+	cameras         map[string]*Camera        // ID -> Camera
+	streamManagers  map[string]*StreamManager // ID -> StreamManager
+	logger          Logger
+	videoDir        string
+	segmentLength   int
+	segmentMode     string // see SetSegmentSize
+	segmentMaxBytes int64
+	mu              sync.RWMutex
+	cameraWg        sync.WaitGroup // Wait group for camera goroutines
+	restartMu       sync.Mutex     // serializes RestartWithConfigs and Stop
+	stopCh          chan struct{}
+	stopOnce        sync.Once
+	selfTests       map[string]SelfTestResult // ID -> last boot self-test result
+	pauseReasons    map[string]bool           // recording is paused while any reason is set
+	preBufferS      int                       // seconds of frames each stream manager keeps for event clips
+	runner          Runner                    // handed to every camera; nil means ExecRunner
+	videoEncoder    string                    // host-wide, so probed once at creation (see RefreshCapabilities)
+	encoderPref     string                    // EncoderAuto or a forced encoder name
+
+	// With autoDisableMissing, cameras whose device is absent when recording
+	// starts are not started and are listed in unavailable instead
+	autoDisableMissing bool
+	unavailable        map[string]bool // ID -> skipped because its device was missing
+	hotplugInterval    time.Duration   // 0 = don't watch for devices appearing/disappearing
+
+	recordNice int // see SetProcessPriority
+	recordCPUs string
+
+	storageLayout string // StorageLayoutFlat or StorageLayoutDaily
+
+	stopGrace time.Duration // see SetShutdownGraceSeconds
+
+	openAttempts int // see SetOpenAttempts; 0 = DefaultOpenAttempts
+
+	continuous bool // see SetContinuousRecording
+}
+
+// NewCameraManager creates a new camera manager. encoder is EncoderAuto to
+// detect the video encoder, or the name of one to use instead.
+func NewCameraManager(configs []CameraConfig, segmentLength int, videoDir, encoder string, logger Logger) (*CameraManager, error) {
 	cm := &CameraManager{
 		cameras:        make(map[string]*Camera),
 		streamManagers: make(map[string]*StreamManager),
@@ -28,8 +56,16 @@ func NewCameraManager(configs []CameraConfig, segmentLength int, videoDir string
 		videoDir:       videoDir,
 		segmentLength:  segmentLength,
 		stopCh:         make(chan struct{}),
+		pauseReasons:   make(map[string]bool),
+		unavailable:    make(map[string]bool),
+		encoderPref:    encoder,
 	}
 
+	// Host encoders don't change at runtime, so the probe (several ffmpeg
+	// processes) runs once here and every camera, including ones created by
+	// later restarts, reuses the result. RefreshCapabilities re-probes on demand.
+	cm.videoEncoder = resolveVideoEncoder(encoder, logger)
+
 	if err := cm.initializeCameras(configs, segmentLength); err != nil {
 		return nil, err
 	}
@@ -39,19 +75,22 @@ func NewCameraManager(configs []CameraConfig, segmentLength int, videoDir string
 
 // initializeCameras creates camera instances from configs
 func (cm *CameraManager) initializeCameras(configs []CameraConfig, segmentLength int) error {
+	encoder := cm.VideoEncoder()
+
 	for _, config := range configs {
 		if !config.Enabled {
 			cm.logger.Printf("Camera '%s' (%s) is disabled, skipping", config.Name, config.ID)
 			continue
 		}
 
-		camera, err := NewCamera(config, segmentLength, cm.logger)
+		camera, err := NewCamera(config, segmentLength, encoder, cm.logger)
 		if err != nil {
 			return fmt.Errorf("failed to create camera '%s': %w", config.Name, err)
 		}
 
 		streamMgr := NewStreamManager(cm.logger)
-		camera.SetStreamManager(streamMgr)
+		streamMgr.EnablePreBuffer(cm.getPreBufferSeconds())
+		cm.prepareCamera(camera, streamMgr)
 
 		cm.cameras[config.ID] = camera
 		cm.streamManagers[config.ID] = streamMgr
@@ -66,10 +105,102 @@ func (cm *CameraManager) initializeCameras(configs []CameraConfig, segmentLength
 	return nil
 }
 
+// prepareCamera applies the manager-wide settings to a newly created camera
+func (cm *CameraManager) prepareCamera(camera *Camera, streamMgr *StreamManager) {
+	if runner := cm.getRunner(); runner != nil {
+		camera.SetRunner(runner)
+	}
+	camera.SetSegmentSize(cm.getSegmentSize())
+	camera.SetProcessPriority(cm.getProcessPriority())
+	camera.SetStorageLayout(cm.getStorageLayout())
+	camera.SetStopGrace(cm.getStopGrace())
+	camera.SetContinuousRecording(cm.getContinuousRecording())
+	camera.SetOpenAttempts(cm.getOpenAttempts())
+	camera.SetStreamManager(streamMgr)
+	camera.SetPaused(cm.isPaused())
+}
+
+// RunSelfTest captures one frame from every enabled camera and records the results.
+// Failures are logged and reported via SelfTestResults but never abort startup.
+func (cm *CameraManager) RunSelfTest() {
+	cm.mu.RLock()
+	cameras := make([]*Camera, 0, len(cm.cameras))
+	for _, camera := range cm.cameras {
+		cameras = append(cameras, camera)
+	}
+	cm.mu.RUnlock()
+
+	results := make(map[string]SelfTestResult, len(cameras))
+	for _, camera := range cameras {
+		result := camera.SelfTest()
+		if result.Passed {
+			cm.logger.Printf("Self-test PASS: camera '%s' (%s) captured %dx%d frame", result.Name, result.CameraID, result.Width, result.Height)
+		} else {
+			cm.logger.Warnf("Self-test FAIL: camera '%s' (%s): %s", result.Name, result.CameraID, result.Error)
+		}
+		results[result.CameraID] = result
+	}
+
+	cm.mu.Lock()
+	cm.selfTests = results
+	cm.mu.Unlock()
+}
+
+// SelfTestResults returns the boot self-test results (empty if the self-test was not run)
+func (cm *CameraManager) SelfTestResults() []SelfTestResult {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	results := make([]SelfTestResult, 0, len(cm.selfTests))
+	for _, result := range cm.selfTests {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].CameraID < results[j].CameraID
+	})
+	return results
+}
+
+// FrameStats returns each camera's dropped/duplicated frame counts, sorted by camera ID
+func (cm *CameraManager) FrameStats() []FrameStats {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	stats := make([]FrameStats, 0, len(cm.cameras))
+	for _, cam := range cm.cameras {
+		stats = append(stats, cam.FrameStats())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].CameraID < stats[j].CameraID
+	})
+	return stats
+}
+
+// FrameUpdaterHealth returns every camera's live-frame updater health, sorted by camera ID
+func (cm *CameraManager) FrameUpdaterHealth() []FrameUpdaterHealth {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	health := make([]FrameUpdaterHealth, 0, len(cm.cameras))
+	for _, cam := range cm.cameras {
+		health = append(health, cam.FrameUpdaterHealth())
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].CameraID < health[j].CameraID
+	})
+	return health
+}
+
 // Start begins recording on all cameras
 func (cm *CameraManager) Start() error {
 	cm.startAllCameras()
 
+	if interval := cm.getHotplugInterval(); interval > 0 {
+		// Counted in cameraWg so the cameras it starts can't race the Wait below
+		cm.cameraWg.Add(1)
+		go cm.watchDevices(interval)
+	}
+
 	<-cm.stopCh
 	cm.cameraWg.Wait()
 	return nil
@@ -79,21 +210,54 @@ func (cm *CameraManager) Start() error {
 func (cm *CameraManager) Stop() {
 	cm.stopOnce.Do(func() { close(cm.stopCh) })
 
+	// Wait out a restart in progress, so none of its cameras are left running
+	cm.restartMu.Lock()
+	defer cm.restartMu.Unlock()
+
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 
+	cameras := make([]*Camera, 0, len(cm.cameras))
 	for id, camera := range cm.cameras {
 		cm.logger.Printf("Stopping camera: %s", id)
-		camera.Stop()
+		cameras = append(cameras, camera)
 	}
+	eachCamera(cameras, (*Camera).Stop)
 
 	for _, streamMgr := range cm.streamManagers {
 		streamMgr.Stop()
 	}
 }
 
-// RestartWithConfigs stops all cameras and starts them again with the provided configs
+// eachCamera runs fn (Stop, or a pause) on every camera in parallel and waits,
+// so each one's grace period for finishing its segment runs alongside the
+// others' instead of adding up
+func eachCamera(cameras []*Camera, fn func(*Camera)) {
+	var wg sync.WaitGroup
+	for _, camera := range cameras {
+		wg.Add(1)
+		go func(camera *Camera) {
+			defer wg.Done()
+			fn(camera)
+		}(camera)
+	}
+	wg.Wait()
+}
+
+// RestartWithConfigs stops all cameras and starts them again with the provided
+// configs. Overlapping calls run one after the other, so the last one's configs
+// win and no camera from an earlier one is left recording. After Stop it does
+// nothing.
 func (cm *CameraManager) RestartWithConfigs(configs []CameraConfig, segmentLength int, videoDir string) error {
+	cm.restartMu.Lock()
+	defer cm.restartMu.Unlock()
+
+	select {
+	case <-cm.stopCh:
+		return nil
+	default:
+	}
+
 	// Stop all existing cameras
 	cm.mu.RLock()
 	oldCameras := make([]*Camera, 0, len(cm.cameras))
@@ -106,10 +270,9 @@ func (cm *CameraManager) RestartWithConfigs(configs []CameraConfig, segmentLengt
 	}
 	cm.mu.RUnlock()
 
-	// Stop cameras (but don't lock mu during this)
-	for _, camera := range oldCameras {
-		camera.Stop()
-	}
+	// Stop cameras (but don't lock mu during this); each finishes its current
+	// segment first, so the footage up to the restart stays playable
+	eachCamera(oldCameras, (*Camera).Stop)
 	for _, sm := range oldStreamManagers {
 		sm.Stop()
 	}
@@ -133,26 +296,44 @@ func (cm *CameraManager) RestartWithConfigs(configs []CameraConfig, segmentLengt
 	return nil
 }
 
-// startAllCameras launches all configured cameras in their own goroutines.
+// startAllCameras launches all configured cameras in their own goroutines. With
+// auto-disable on, a camera whose device is missing is skipped rather than left
+// failing every segment.
 func (cm *CameraManager) startAllCameras() {
 	cm.mu.RLock()
 	cameras := make([]*Camera, 0, len(cm.cameras))
 	for _, camera := range cm.cameras {
 		cameras = append(cameras, camera)
 	}
+	autoDisable := cm.autoDisableMissing
 	cm.mu.RUnlock()
 
+	unavailable := make(map[string]bool)
 	for _, camera := range cameras {
+		config := camera.GetConfig()
+		if autoDisable && !DevicePresent(config.Device) {
+			cm.logger.Warnf("Camera '%s' (%s): Device %s not found, not recording from it", config.Name, config.ID, config.Device)
+			unavailable[config.ID] = true
+			continue
+		}
 		cm.startCamera(camera)
 	}
+
+	cm.mu.Lock()
+	cm.unavailable = unavailable
+	cm.mu.Unlock()
 }
 
 func (cm *CameraManager) startCamera(cam *Camera) {
+	cm.mu.RLock()
+	videoDir := cm.videoDir // a later restart may change it while this camera starts
+	cm.mu.RUnlock()
+
 	cm.cameraWg.Add(1)
 	go func(cam *Camera) {
 		defer cm.cameraWg.Done()
 		config := cam.GetConfig()
-		cameraVideoDir := filepath.Join(cm.videoDir, config.ID)
+		cameraVideoDir := config.StorageDir(videoDir)
 		cm.logger.Printf("Camera '%s': Saving videos to %s", config.Name, cameraVideoDir)
 		if err := cam.Start(cameraVideoDir); err != nil {
 			cm.logger.Printf("Camera '%s' stopped: %v", config.Name, err)
@@ -160,6 +341,396 @@ func (cm *CameraManager) startCamera(cam *Camera) {
 	}(cam)
 }
 
+// SetSegmentLength applies a new segment duration to every camera without
+// restarting them; it takes effect from each camera's next segment.
+func (cm *CameraManager) SetSegmentLength(seconds int) {
+	cm.mu.Lock()
+	cm.segmentLength = seconds
+	cameras := make([]*Camera, 0, len(cm.cameras))
+	for _, camera := range cm.cameras {
+		cameras = append(cameras, camera)
+	}
+	cm.mu.Unlock()
+
+	for _, camera := range cameras {
+		camera.SetSegmentLength(seconds)
+	}
+}
+
+// SetSegmentSize sets the segment mode (SegmentModeTime/Size/Both) and size limit
+// for every camera, including ones created by later restarts. Like
+// SetSegmentLength, it takes effect from each camera's next segment.
+func (cm *CameraManager) SetSegmentSize(mode string, maxBytes int64) {
+	cm.mu.Lock()
+	cm.segmentMode = mode
+	cm.segmentMaxBytes = maxBytes
+	cameras := make([]*Camera, 0, len(cm.cameras))
+	for _, camera := range cm.cameras {
+		cameras = append(cameras, camera)
+	}
+	cm.mu.Unlock()
+
+	for _, camera := range cameras {
+		camera.SetSegmentSize(mode, maxBytes)
+	}
+}
+
+func (cm *CameraManager) getSegmentLength() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.segmentLength
+}
+
+func (cm *CameraManager) getSegmentSize() (string, int64) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.segmentMode, cm.segmentMaxBytes
+}
+
+// VideoEncoder returns the H.264 encoder detected on this host
+func (cm *CameraManager) VideoEncoder() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.videoEncoder
+}
+
+// RefreshCapabilities probes the host's encoders again, e.g. after a driver
+// update, and returns the chosen one. Running cameras keep the encoder they were
+// created with; cameras created by the next restart use the new result.
+func (cm *CameraManager) RefreshCapabilities() string {
+	encoder := resolveVideoEncoder(cm.encoderPref, cm.logger)
+	cm.mu.Lock()
+	cm.videoEncoder = encoder
+	cm.mu.Unlock()
+	cm.logger.Printf("Re-probed video encoders: using %s", encoder)
+	return encoder
+}
+
+// SetAutoDisableMissing makes Start and RestartWithConfigs skip cameras whose
+// device doesn't exist (see UnavailableCameras). Must be called before Start.
+func (cm *CameraManager) SetAutoDisableMissing(enabled bool) {
+	cm.mu.Lock()
+	cm.autoDisableMissing = enabled
+	cm.mu.Unlock()
+}
+
+// SetHotplugPollSeconds makes Start poll this often for configured cameras whose
+// device appeared (started) or disappeared (stopped); 0 disables it. Must be
+// called before Start.
+func (cm *CameraManager) SetHotplugPollSeconds(seconds int) {
+	cm.mu.Lock()
+	cm.hotplugInterval = time.Duration(seconds) * time.Second
+	cm.mu.Unlock()
+}
+
+// SetShutdownGraceSeconds sets how long a stopping camera (shutdown, restart,
+// unplug) gets to finish writing its current segment before its recorder is
+// killed; 0 or less kills it straight away.
+func (cm *CameraManager) SetShutdownGraceSeconds(seconds int) {
+	grace := time.Duration(seconds) * time.Second
+	cm.mu.Lock()
+	cm.stopGrace = grace
+	cameras := make([]*Camera, 0, len(cm.cameras))
+	for _, camera := range cm.cameras {
+		cameras = append(cameras, camera)
+	}
+	cm.mu.Unlock()
+
+	for _, camera := range cameras {
+		camera.SetStopGrace(grace)
+	}
+}
+
+// SetOpenAttempts sets how many times each camera tries to open its device
+// quietly before reporting it as failed. Cameras already running keep counting
+// against the new limit.
+func (cm *CameraManager) SetOpenAttempts(n int) {
+	cm.mu.Lock()
+	cm.openAttempts = n
+	cameras := make([]*Camera, 0, len(cm.cameras))
+	for _, camera := range cm.cameras {
+		cameras = append(cameras, camera)
+	}
+	cm.mu.Unlock()
+
+	for _, camera := range cameras {
+		camera.SetOpenAttempts(n)
+	}
+}
+
+func (cm *CameraManager) getOpenAttempts() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.openAttempts
+}
+
+func (cm *CameraManager) getStopGrace() time.Duration {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.stopGrace
+}
+
+func (cm *CameraManager) getHotplugInterval() time.Duration {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.hotplugInterval
+}
+
+// watchDevices polls until Stop, starting unavailable cameras whose device has
+// appeared and stopping running cameras whose device has gone
+func (cm *CameraManager) watchDevices(interval time.Duration) {
+	defer cm.cameraWg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cm.stopCh:
+			return
+		case <-ticker.C:
+			cm.checkDevices()
+		}
+	}
+}
+
+func (cm *CameraManager) checkDevices() {
+	cm.mu.RLock()
+	cameras := make(map[string]*Camera, len(cm.cameras))
+	for id, camera := range cm.cameras {
+		cameras[id] = camera
+	}
+	cm.mu.RUnlock()
+
+	for id, cam := range cameras {
+		config := cam.GetConfig()
+		present := DevicePresent(config.Device)
+
+		cm.mu.Lock()
+		// A restart may have replaced the camera since the snapshot
+		if cm.cameras[id] != cam {
+			cm.mu.Unlock()
+			continue
+		}
+		unavailable := cm.unavailable[id]
+		if unavailable && present {
+			delete(cm.unavailable, id)
+			cm.mu.Unlock()
+
+			cm.logger.Printf("Camera '%s' (%s): Device %s appeared, starting recording", config.Name, id, config.Device)
+			cm.startCamera(cam)
+			continue
+		}
+		if unavailable || present {
+			cm.mu.Unlock()
+			continue
+		}
+		cm.unavailable[id] = true
+		streamMgr := cm.streamManagers[id]
+		cm.mu.Unlock()
+
+		// A stopped camera can't be started again, so an unstarted replacement
+		// (sharing the stream manager, so viewers stay connected) waits for the device
+		cm.logger.Warnf("Camera '%s' (%s): Device %s disappeared, stopping recording", config.Name, id, config.Device)
+		cam.Stop()
+		replacement, err := NewCamera(config, cm.getSegmentLength(), cm.VideoEncoder(), cm.logger)
+		if err != nil {
+			cm.logger.Errorf("Camera '%s' (%s): Failed to recreate after device removal: %v", config.Name, id, err)
+			continue
+		}
+		cm.prepareCamera(replacement, streamMgr)
+
+		cm.mu.Lock()
+		if cm.cameras[id] == cam {
+			cm.cameras[id] = replacement
+		}
+		cm.mu.Unlock()
+	}
+}
+
+// UnavailableCameras returns the IDs of cameras skipped because their device was
+// missing when recording last started, sorted
+func (cm *CameraManager) UnavailableCameras() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	ids := make([]string, 0, len(cm.unavailable))
+	for id := range cm.unavailable {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IsUnavailable reports whether a camera was skipped because its device was missing
+func (cm *CameraManager) IsUnavailable(id string) bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.unavailable[id]
+}
+
+// SetRunner sets how cameras launch ffmpeg/rpicam-vid, including cameras created
+// by later restarts. Must be called before Start.
+func (cm *CameraManager) SetRunner(r Runner) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.runner = r
+	for _, camera := range cm.cameras {
+		camera.SetRunner(r)
+	}
+}
+
+func (cm *CameraManager) getRunner() Runner {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.runner
+}
+
+// SetProcessPriority sets the niceness and taskset CPU list recording processes
+// run with (see PriorityArgs), including cameras created by later restarts. Must
+// be called before Start.
+func (cm *CameraManager) SetProcessPriority(nice int, cpus string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.recordNice, cm.recordCPUs = nice, cpus
+	for _, camera := range cm.cameras {
+		camera.SetProcessPriority(nice, cpus)
+	}
+}
+
+func (cm *CameraManager) getProcessPriority() (int, string) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.recordNice, cm.recordCPUs
+}
+
+// SetContinuousRecording sets whether cameras record through ffmpeg's segment
+// muxer, without gaps between segments (see Camera.SetContinuousRecording),
+// including cameras created by later restarts. Must be called before Start.
+func (cm *CameraManager) SetContinuousRecording(enabled bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.continuous = enabled
+	for _, camera := range cm.cameras {
+		camera.SetContinuousRecording(enabled)
+	}
+}
+
+func (cm *CameraManager) getContinuousRecording() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.continuous
+}
+
+// SetStorageLayout sets where every camera writes new segments (StorageLayoutFlat
+// or StorageLayoutDaily), including cameras created by later restarts
+func (cm *CameraManager) SetStorageLayout(layout string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.storageLayout = layout
+	for _, camera := range cm.cameras {
+		camera.SetStorageLayout(layout)
+	}
+}
+
+func (cm *CameraManager) getStorageLayout() string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.storageLayout
+}
+
+// SetPreBufferSeconds sets how many seconds of recent frames every camera keeps
+// in RAM for event clips (0 disables), including cameras created by a restart.
+func (cm *CameraManager) SetPreBufferSeconds(seconds int) {
+	cm.mu.Lock()
+	cm.preBufferS = seconds
+	streamMgrs := make([]*StreamManager, 0, len(cm.streamManagers))
+	for _, sm := range cm.streamManagers {
+		streamMgrs = append(streamMgrs, sm)
+	}
+	cm.mu.Unlock()
+
+	for _, sm := range streamMgrs {
+		sm.EnablePreBuffer(seconds)
+	}
+}
+
+func (cm *CameraManager) getPreBufferSeconds() int {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return cm.preBufferS
+}
+
+// PauseRecording stops all cameras from recording for the given reason (e.g.
+// "storage_full"), returning once their current segments are closed. Recording
+// resumes once every reason has been cleared.
+func (cm *CameraManager) PauseRecording(reason string) {
+	cm.setPauseReason(reason, true)
+}
+
+// ResumeRecording clears a pause reason set by PauseRecording
+func (cm *CameraManager) ResumeRecording(reason string) {
+	cm.setPauseReason(reason, false)
+}
+
+func (cm *CameraManager) setPauseReason(reason string, set bool) {
+	cm.mu.Lock()
+	wasPaused := len(cm.pauseReasons) > 0
+	if set {
+		cm.pauseReasons[reason] = true
+	} else {
+		delete(cm.pauseReasons, reason)
+	}
+	paused := len(cm.pauseReasons) > 0
+	cameras := make([]*Camera, 0, len(cm.cameras))
+	for _, camera := range cm.cameras {
+		cameras = append(cameras, camera)
+	}
+	cm.mu.Unlock()
+
+	if paused == wasPaused {
+		return
+	}
+	if paused {
+		cm.logger.Printf("Recording paused (%s)", reason)
+	} else {
+		cm.logger.Printf("Recording resumed")
+	}
+	eachCamera(cameras, func(camera *Camera) { camera.SetPaused(paused) })
+}
+
+// PauseReasons returns the reasons recording is currently paused (empty if recording)
+func (cm *CameraManager) PauseReasons() []string {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	reasons := make([]string, 0, len(cm.pauseReasons))
+	for reason := range cm.pauseReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// isPaused must be called without cm.mu held
+func (cm *CameraManager) isPaused() bool {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	return len(cm.pauseReasons) > 0
+}
+
+// MarkEvent flags t in the sidecar of the segment each camera (or just cameraID,
+// if set) is recording
+func (cm *CameraManager) MarkEvent(cameraID string, t time.Time) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	for id, camera := range cm.cameras {
+		if cameraID == "" || id == cameraID {
+			camera.MarkEvent(t)
+		}
+	}
+}
+
 // GetCamera returns a camera by ID
 func (cm *CameraManager) GetCamera(id string) (*Camera, bool) {
 	cm.mu.RLock()
@@ -0,0 +1,128 @@
+package camera
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCameraConfigs returns configs for cameras with the given IDs on the
+// synthetic test source
+func testCameraConfigs(ids ...string) []CameraConfig {
+	configs := make([]CameraConfig, len(ids))
+	for i, id := range ids {
+		configs[i] = CameraConfig{
+			ID:           id,
+			Name:         id,
+			Device:       TestDevicePrefix + "color",
+			ResWidth:     64,
+			ResHeight:    48,
+			FPS:          10,
+			MJPEGQuality: 5,
+			Enabled:      true,
+		}
+	}
+	return configs
+}
+
+func TestRestartWithConfigsOverlapping(t *testing.T) {
+	videoDir := t.TempDir()
+	// Recorders run until they're interrupted, so one a restart misses stays running
+	runner := &fakeRunner{}
+	cm, err := NewCameraManager(testCameraConfigs("a", "b"), 60, videoDir, "libx264", testLogger{})
+	if err != nil {
+		t.Fatalf("NewCameraManager: %v", err)
+	}
+	cm.SetRunner(runner)
+	cm.SetShutdownGraceSeconds(1)
+
+	returned := make(chan error, 1)
+	go func() { returned <- cm.Start() }()
+	waitFor(t, 5*time.Second, func() bool { return runner.running() == 2 })
+
+	// Each restart swaps in a different set of cameras
+	sets := [][]string{{"a"}, {"b", "c"}, {"c", "d", "e"}, {"a", "e"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(ids []string) {
+			defer wg.Done()
+			if err := cm.RestartWithConfigs(testCameraConfigs(ids...), 60, videoDir); err != nil {
+				t.Errorf("RestartWithConfigs(%v): %v", ids, err)
+			}
+		}(sets[i%len(sets)])
+	}
+	wg.Wait()
+
+	// The last restart wins outright: its cameras and nothing else are recording
+	cameras := cm.ListCameras()
+	got := make([]string, len(cameras))
+	for i, config := range cameras {
+		got[i] = config.ID
+	}
+	sort.Strings(got)
+	matched := false
+	for _, ids := range sets {
+		matched = matched || strings.Join(got, ",") == strings.Join(ids, ",")
+	}
+	if !matched {
+		t.Fatalf("cameras %v after the restarts, not any one restart's set", got)
+	}
+	for _, config := range cameras {
+		if _, ok := cm.GetStreamManager(config.ID); !ok {
+			t.Errorf("camera %s has no stream manager", config.ID)
+		}
+	}
+	waitFor(t, 5*time.Second, func() bool { return runner.running() == len(cameras) })
+
+	cm.Stop()
+	select {
+	case err := <-returned:
+		if err != nil {
+			t.Errorf("Start returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start didn't return after Stop")
+	}
+	if n := runner.running(); n != 0 {
+		t.Errorf("%d recorders still running after Stop", n)
+	}
+}
+
+func TestRestartWithConfigsAfterStop(t *testing.T) {
+	runner := &fakeRunner{}
+	cm, err := NewCameraManager(testCameraConfigs("a"), 60, t.TempDir(), "libx264", testLogger{})
+	if err != nil {
+		t.Fatalf("NewCameraManager: %v", err)
+	}
+	cm.SetRunner(runner)
+
+	returned := make(chan error, 1)
+	go func() { returned <- cm.Start() }()
+	waitFor(t, 5*time.Second, func() bool { return runner.running() == 1 })
+
+	// A reconfiguration racing shutdown must not start cameras nobody stops
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cm.RestartWithConfigs(testCameraConfigs(fmt.Sprintf("cam%d", i)), 60, t.TempDir())
+		}(i)
+	}
+	cm.Stop()
+	wg.Wait()
+
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Start didn't return after Stop")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := runner.running(); n != 0 {
+		t.Errorf("%d recorders running after Stop", n)
+	}
+}
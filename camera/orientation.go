@@ -0,0 +1,82 @@
+package camera
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ValidRotation reports whether rotation is one of the supported values (0, 90, 180, 270)
+func ValidRotation(rotation int) bool {
+	switch rotation {
+	case 0, 90, 180, 270:
+		return true
+	}
+	return false
+}
+
+// orientation reduces rotation plus flips to an equivalent (rotation, hflip, vflip)
+// using as few filters as possible. Flipping both axes is a 180 degree rotation, so
+// 180 folds into the flips (cheaper than two transposes, and it never swaps the
+// frame dimensions), and a 90/270 rotation with both flips becomes the other one.
+func orientation(rotation int, hflip, vflip bool) (int, bool, bool) {
+	if rotation == 180 {
+		rotation, hflip, vflip = 0, !hflip, !vflip
+	}
+	if hflip && vflip && rotation != 0 {
+		rotation, hflip, vflip = 360-rotation, false, false
+	}
+	return rotation, hflip, vflip
+}
+
+// orientationFilters returns the ffmpeg video filters implementing the configured
+// rotation followed by any mirroring.
+func orientationFilters(rotation int, hflip, vflip bool) []string {
+	rotation, hflip, vflip = orientation(rotation, hflip, vflip)
+
+	var filters []string
+	switch rotation {
+	case 90:
+		filters = append(filters, "transpose=1")
+	case 270:
+		filters = append(filters, "transpose=2")
+	}
+	if hflip {
+		filters = append(filters, "hflip")
+	}
+	if vflip {
+		filters = append(filters, "vflip")
+	}
+	return filters
+}
+
+// Orientation describes the effective transform applied to recorded frames,
+// e.g. "rotate 90, mirrored" or "none".
+func (c CameraConfig) Orientation() string {
+	rotation, hflip, vflip := orientation(c.Rotation, c.FlipHorizontal, c.FlipVertical)
+
+	var parts []string
+	if rotation != 0 {
+		parts = append(parts, "rotate "+strconv.Itoa(rotation))
+	}
+	switch {
+	case hflip && vflip:
+		parts = append(parts, "rotate 180")
+	case hflip:
+		parts = append(parts, "mirrored")
+	case vflip:
+		parts = append(parts, "flipped vertically")
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// OutputSize returns the dimensions of recorded frames once rotation is applied.
+// 90 and 270 degree rotations swap width and height.
+func (c CameraConfig) OutputSize() (width, height int) {
+	if c.Rotation == 90 || c.Rotation == 270 {
+		return c.ResHeight, c.ResWidth
+	}
+	return c.ResWidth, c.ResHeight
+}
@@ -0,0 +1,50 @@
+package camera
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// overlayFontPath is used for drawtext when present (Debian/Ubuntu/Raspberry Pi OS
+// usually have DejaVuSans); otherwise ffmpeg falls back to its default font
+const overlayFontPath = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
+
+// timestampText is the drawtext text for the UTC timestamp, already escaped for
+// the filtergraph
+const timestampText = "'%{gmtime\\:%Y-%m-%d %H\\\\\\:%M\\\\\\:%S} \\\\(UTC\\\\)'"
+
+// drawtextFilter builds a drawtext filter in the style shared by the timestamp and
+// label overlays. text must already be escaped; extra options are appended as-is.
+func drawtextFilter(text, x, y string, extra ...string) string {
+	filter := fmt.Sprintf("drawtext=text=%s:fontcolor=white:fontsize=24:box=1:boxcolor=black@0.5:boxborderw=5:x=%s:y=%s", text, x, y)
+	for _, opt := range extra {
+		filter += ":" + opt
+	}
+	if _, err := os.Stat(overlayFontPath); err == nil {
+		filter += fmt.Sprintf(":fontfile=%s", overlayFontPath)
+	}
+	return filter
+}
+
+// overlayFilters returns the drawtext filters for the camera's enabled overlays:
+// the timestamp top-left and the camera name top-right
+func overlayFilters(config CameraConfig) []string {
+	var filters []string
+	if config.EmbedTimestamp {
+		filters = append(filters, drawtextFilter(timestampText, "10", "10"))
+	}
+	if config.LabelOverlay && config.Name != "" {
+		// expansion=none keeps a '%' in the name literal
+		filters = append(filters, drawtextFilter(escapeDrawtext(config.Name), "w-tw-10", "10", "expansion=none"))
+	}
+	return filters
+}
+
+// escapeDrawtext escapes literal text for a drawtext option inside a -vf string:
+// once for the option parser (':' and quotes) and once more for the filtergraph
+// parser (brackets, ',' and ';'), per ffmpeg's filtergraph escaping rules
+func escapeDrawtext(s string) string {
+	option := strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(option)
+}
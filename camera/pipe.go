@@ -0,0 +1,191 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// PipeRestartDelay is how long a camera waits before restarting a pipe command
+// that exited
+const PipeRestartDelay = 5 * time.Second
+
+// PipeFrames writes every new frame to w as concatenated JPEGs (an MJPEG
+// stream) until stop is closed, the stream manager stops or a write fails. A
+// writer that falls behind misses frames rather than holding up the stream.
+func (sm *StreamManager) PipeFrames(w io.Writer, stop <-chan struct{}) error {
+	sink := make(chan []byte, frameSinkBuffer)
+
+	sm.mu.Lock()
+	sm.frameSinks[sink] = struct{}{}
+	sm.mu.Unlock()
+
+	defer func() {
+		sm.mu.Lock()
+		delete(sm.frameSinks, sink)
+		sm.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case frame := <-sink:
+			if _, err := w.Write(frame); err != nil {
+				return err
+			}
+		case <-stop:
+			return nil
+		case <-sm.done:
+			return nil
+		}
+	}
+}
+
+// maxPipeFrame is how much of the recorder's output mjpegSplitter holds while
+// waiting for a frame to end before it gives up on it
+const maxPipeFrame = MaxFrameWindowKB * BytesPerKB
+
+// pipeOutput returns the writer for the recorder's stdout: for a pipe command,
+// one that hands each recorded frame on to it; otherwise nil, discarding it
+func (c *Camera) pipeOutput() io.Writer {
+	if c.pipeFrames == nil {
+		return nil
+	}
+	return &mjpegSplitter{onFrame: func(frame []byte) {
+		select {
+		case c.pipeFrames <- frame:
+		default: // the command fell behind; drop whole frames rather than hold up the recorder
+		}
+	}}
+}
+
+// pipeRecordedFrames writes the frames from pipeOutput to w until stop is
+// closed, the camera stops or a write fails
+func (c *Camera) pipeRecordedFrames(w io.Writer, stop <-chan struct{}) error {
+	for {
+		select {
+		case frame := <-c.pipeFrames:
+			if _, err := w.Write(frame); err != nil {
+				return err
+			}
+		case <-stop:
+			return nil
+		case <-c.done:
+			return nil
+		}
+	}
+}
+
+// mjpegSplitter cuts the MJPEG stream written to it into frames, handing each
+// complete one to onFrame. Bytes before a frame's start marker, and a frame
+// that hasn't ended within maxPipeFrame, are skipped.
+type mjpegSplitter struct {
+	buf     []byte
+	onFrame func(frame []byte)
+}
+
+func (s *mjpegSplitter) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		start := bytes.Index(s.buf, []byte{0xFF, 0xD8, 0xFF})
+		if start < 0 {
+			// Keep a start marker that's been cut off
+			s.buf = s.buf[max(len(s.buf)-2, 0):]
+			break
+		}
+		s.buf = s.buf[start:]
+		n := jpegLength(s.buf)
+		if n < 0 {
+			if len(s.buf) > maxPipeFrame {
+				s.buf = s.buf[1:]
+				continue
+			}
+			break
+		}
+		s.onFrame(bytes.Clone(s.buf[:n]))
+		s.buf = s.buf[n:]
+	}
+	return len(p), nil
+}
+
+// runPipe keeps the camera's pipe command running until the camera stops,
+// restarting it PipeRestartDelay after it exits
+func (c *Camera) runPipe() {
+	for {
+		err := c.pipeOnce()
+		if c.isStopped() {
+			return
+		}
+		if err != nil {
+			c.logger.Warnf("Camera '%s': Pipe command exited, restarting in %v: %v", c.camConfig.Name, PipeRestartDelay, err)
+		} else {
+			c.logger.Warnf("Camera '%s': Pipe command exited, restarting in %v", c.camConfig.Name, PipeRestartDelay)
+		}
+		select {
+		case <-c.done:
+			return
+		case <-time.After(PipeRestartDelay):
+		}
+	}
+}
+
+// pipeOnce runs the pipe command through the shell with the recording on its
+// stdin (the live frames for a CSI camera) until it exits or the camera stops.
+// On stop its stdin is closed so it can finish up, and it's killed if it hasn't
+// exited within the stop grace period.
+func (c *Camera) pipeOnce() error {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	stderr := &lineWriter{onLine: func(line string) {
+		c.logger.Debugf("Camera '%s': Pipe command: %s", c.camConfig.Name, line)
+	}}
+	// Frames left over from before a restart are stale by now
+	for len(c.pipeFrames) > 0 {
+		<-c.pipeFrames
+	}
+	proc, stdin, err := c.runner.StartPiped(context.Background(), shell, []string{flag, c.camConfig.PipeCommand}, nil, stderr)
+	if err != nil {
+		return fmt.Errorf("failed to start pipe command: %w", err)
+	}
+	c.logger.Printf("Camera '%s': Piping frames to: %s", c.camConfig.Name, c.camConfig.PipeCommand)
+
+	exited := make(chan struct{})
+	waitErr := make(chan error, 1)
+	go func() {
+		err := proc.Wait()
+		close(exited)
+		waitErr <- err
+	}()
+
+	// Writes fail once the command exits, which ends the feed too
+	go func() {
+		feed := c.pipeRecordedFrames
+		if c.pipeFrames == nil {
+			feed = c.streamManager.PipeFrames
+		}
+		if err := feed(stdin, exited); err != nil {
+			c.logger.Debugf("Camera '%s': Stopped piping frames: %v", c.camConfig.Name, err)
+		}
+	}()
+
+	select {
+	case err := <-waitErr:
+		stdin.Close()
+		return err
+	case <-c.done:
+	}
+
+	stdin.Close()
+	grace := c.getStopGrace()
+	select {
+	case <-exited:
+	case <-time.After(grace):
+		c.logger.Warnf("Camera '%s': Pipe command didn't exit within %v of its input closing, killing it", c.camConfig.Name, grace)
+		proc.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package camera
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMJPEGSplitter(t *testing.T) {
+	frames := [][]byte{
+		testFrame(0x11, 100),
+		craftFrame([][]byte{{0xFE, 0xFF, 0xD9, 0xFF, 0xD8, 0xFF}}, []byte{0x12, 0xFF, 0x00, 0xD9, 0xFF, 0xD0}),
+		testFrame(0x22, 3000),
+	}
+	var stream []byte
+	stream = append(stream, 0x00, 0x01) // not a frame
+	for _, frame := range frames {
+		stream = append(stream, frame...)
+	}
+	stream = append(stream, testFrame(0x33, 100)[:50]...) // still being written
+
+	for _, chunk := range []int{1, 7, 4096, len(stream)} {
+		var got [][]byte
+		splitter := &mjpegSplitter{onFrame: func(frame []byte) { got = append(got, frame) }}
+		for rest := stream; len(rest) > 0; {
+			n := min(chunk, len(rest))
+			splitter.Write(rest[:n])
+			rest = rest[n:]
+		}
+		if len(got) != len(frames) {
+			t.Fatalf("%d byte writes: got %d frames, want %d", chunk, len(got), len(frames))
+		}
+		for i := range frames {
+			if !bytes.Equal(got[i], frames[i]) {
+				t.Errorf("%d byte writes: frame %d is %d bytes, want %d", chunk, i, len(got[i]), len(frames[i]))
+			}
+		}
+	}
+}
+
+func TestMJPEGSplitterResyncs(t *testing.T) {
+	// A frame that never ends is given up on once it passes maxPipeFrame
+	var got [][]byte
+	splitter := &mjpegSplitter{onFrame: func(frame []byte) { got = append(got, frame) }}
+	broken := append([]byte{0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02}, bytes.Repeat([]byte{0x12}, maxPipeFrame)...)
+	splitter.Write(broken)
+	frame := testFrame(0x22, 100)
+	splitter.Write(frame)
+
+	if len(got) != 1 || !bytes.Equal(got[0], frame) {
+		t.Fatalf("got %d frames, want just the one after the broken frame", len(got))
+	}
+	if len(splitter.buf) != 0 {
+		t.Errorf("%d bytes left buffered", len(splitter.buf))
+	}
+}
+
+func TestStderrWriter(t *testing.T) {
+	var counters frameCounters
+	stats := &segmentFrameStats{counters: &counters}
+	tail := &stderrTail{limit: 1024}
+	w := stats.stderrWriter(tail)
+
+	w.Write([]byte("frame=10\nfps=15.0\ndrop_frames=2\n[video4linux2,v4l2 @ 0x1] The buffer is too full, frame dropped\n"))
+	w.Write([]byte("dup_frames=1\nprogress=continue\nframe=2"))
+	w.Write([]byte("0\n[mjpeg @ 0x2] error, x=1\n"))
+
+	if n := stats.frames.Load(); n != 20 {
+		t.Errorf("frames %d, want 20", n)
+	}
+	want := FrameStats{DroppedFrames: 2, DuplicatedFrames: 1, BufferOverflows: 1}
+	if got := counters.snapshot(); got != want {
+		t.Errorf("counters %+v, want %+v", got, want)
+	}
+	wantTail := "[video4linux2,v4l2 @ 0x1] The buffer is too full, frame dropped\n[mjpeg @ 0x2] error, x=1\n"
+	if tail.String() != wantTail {
+		t.Errorf("tail %q, want only the warnings", tail.String())
+	}
+}
+
+func TestPipeGetsRecordedFrames(t *testing.T) {
+	config := CameraConfig{
+		ID:           "front",
+		Name:         "front",
+		Device:       TestDevicePrefix + "color",
+		ResWidth:     64,
+		ResHeight:    48,
+		FPS:          10,
+		MJPEGQuality: 5,
+		Enabled:      true,
+		PipeCommand:  "cat > /dev/null",
+	}
+	runner := &fakeRunner{}
+	cam, err := NewCamera(config, 1, "libx264", testLogger{})
+	if err != nil {
+		t.Fatalf("NewCamera: %v", err)
+	}
+	cam.SetRunner(runner)
+	cam.SetStopGrace(time.Second)
+
+	piped := make(chan struct{})
+	go func() {
+		cam.runPipe()
+		close(piped)
+	}()
+	waitFor(t, 5*time.Second, func() bool { return runner.startCount() == 1 })
+	runner.mu.Lock()
+	stdin := runner.stdins[0]
+	if args := strings.Join(runner.starts[0].args, " "); !strings.HasSuffix(args, config.PipeCommand) {
+		t.Errorf("started %q, want the pipe command through the shell", args)
+	}
+	runner.mu.Unlock()
+
+	// Every frame the recorder writes arrives, identical ones included
+	var stream []byte
+	for _, fill := range []byte{0x11, 0x11, 0x22} {
+		stream = append(stream, testFrame(fill, 500)...)
+	}
+	recorder := cam.pipeOutput()
+	for rest := stream; len(rest) > 0; rest = rest[min(100, len(rest)):] {
+		recorder.Write(rest[:min(100, len(rest))])
+	}
+	waitFor(t, 5*time.Second, func() bool { return len(stdin.bytes()) == len(stream) })
+	if !bytes.Equal(stdin.bytes(), stream) {
+		t.Error("the pipe command didn't get the recorder's frames as written")
+	}
+
+	cam.Stop()
+	select {
+	case <-piped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runPipe didn't return after Stop")
+	}
+	stdin.mu.Lock()
+	closed := stdin.closed
+	stdin.mu.Unlock()
+	if !closed {
+		t.Error("the pipe command's stdin wasn't closed on stop")
+	}
+}
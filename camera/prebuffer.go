@@ -0,0 +1,96 @@
+package camera
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// bufferedFrame is one JPEG held in a stream manager's pre-record buffer
+type bufferedFrame struct {
+	at   time.Time
+	data []byte
+}
+
+// frameSinkBuffer is how many frames an event clip or pipe command may fall
+// behind before new frames are dropped for it (the live stream is never held up)
+const frameSinkBuffer = 64
+
+// EnablePreBuffer keeps the frames of the last `seconds` in RAM so an event clip
+// can include footage from before it was marked. 0 disables the buffer.
+func (sm *StreamManager) EnablePreBuffer(seconds int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.preBufferWindow = time.Duration(seconds) * time.Second
+	if seconds <= 0 {
+		sm.preBuffer = nil
+	}
+}
+
+// bufferFrame adds a new frame to the pre-record buffer and hands it to any event
+// clips being written and pipe commands. Must be called with sm.mu held.
+func (sm *StreamManager) bufferFrame(frame []byte) {
+	now := time.Now()
+	if sm.preBufferWindow > 0 {
+		sm.preBuffer = append(sm.preBuffer, bufferedFrame{at: now, data: frame})
+		drop := 0
+		for drop < len(sm.preBuffer) && now.Sub(sm.preBuffer[drop].at) > sm.preBufferWindow {
+			drop++
+		}
+		if drop > 0 {
+			sm.preBuffer = append(sm.preBuffer[:0], sm.preBuffer[drop:]...)
+		}
+	}
+
+	for sink := range sm.frameSinks {
+		select {
+		case sink <- frame:
+		default:
+		}
+	}
+}
+
+// WriteEventClip writes the buffered pre-record frames followed by every new frame
+// for the next `post` duration to w as concatenated JPEGs (an MJPEG file). It
+// blocks until the clip is complete and returns the number of frames written.
+func (sm *StreamManager) WriteEventClip(w io.Writer, post time.Duration) (int, error) {
+	sink := make(chan []byte, frameSinkBuffer)
+
+	sm.mu.Lock()
+	pre := make([][]byte, len(sm.preBuffer))
+	for i, f := range sm.preBuffer {
+		pre[i] = f.data
+	}
+	sm.frameSinks[sink] = struct{}{}
+	sm.mu.Unlock()
+
+	defer func() {
+		sm.mu.Lock()
+		delete(sm.frameSinks, sink)
+		sm.mu.Unlock()
+	}()
+
+	frames := 0
+	for _, frame := range pre {
+		if _, err := w.Write(frame); err != nil {
+			return frames, fmt.Errorf("failed to write event clip: %w", err)
+		}
+		frames++
+	}
+
+	timer := time.NewTimer(post)
+	defer timer.Stop()
+	for {
+		select {
+		case frame := <-sink:
+			if _, err := w.Write(frame); err != nil {
+				return frames, fmt.Errorf("failed to write event clip: %w", err)
+			}
+			frames++
+		case <-timer.C:
+			return frames, nil
+		case <-sm.done:
+			return frames, nil
+		}
+	}
+}
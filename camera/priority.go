@@ -0,0 +1,48 @@
+package camera
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// PriorityArgs wraps a command in nice (when nice != 0) and taskset (when cpus,
+// a taskset CPU list like "2,3" or "1-3", is set), skipping either if it isn't
+// installed. Both exec the wrapped command, so killing the returned process
+// still kills it.
+func PriorityArgs(nice int, cpus, name string, args []string) (string, []string) {
+	cmdArgs := append([]string{}, args...)
+	if nice != 0 {
+		if _, err := exec.LookPath("nice"); err == nil {
+			cmdArgs = append([]string{"-n", fmt.Sprintf("%d", nice), name}, cmdArgs...)
+			name = "nice"
+		}
+	}
+	if cpus != "" {
+		if _, err := exec.LookPath("taskset"); err == nil {
+			cmdArgs = append([]string{"-c", cpus, name}, cmdArgs...)
+			name = "taskset"
+		}
+	}
+	return name, cmdArgs
+}
+
+// ValidCPUList reports whether s looks like a taskset CPU list (digits, ',' and
+// '-'), so a config value can't smuggle in extra arguments
+func ValidCPUList(s string) bool {
+	if s == "" || len(s) > 64 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c == ',' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// SetProcessPriority sets the niceness and CPU list (see PriorityArgs) this
+// camera's ffmpeg/rpicam-vid runs with. Must be called before Start.
+func (c *Camera) SetProcessPriority(nice int, cpus string) {
+	c.nice = nice
+	c.cpus = cpus
+}
@@ -1,152 +1,276 @@
 package camera
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	// FFmpeg stderr capture
-	FFmpegStderrBufferKB = 4 // 4KB buffer for FFmpeg error messages
+	// PreviewDirName is the per-camera subdirectory a downscaled preview is
+	// written to when preview_scale is set; the live frame is read from it
+	PreviewDirName = "preview"
+	previewFile    = "preview.mjpeg"
 )
 
 // recordAndStreamSegment records video to MJPEG (Motion JPEG) format
 // MJPEG supports real-time streaming and safe recovery from interrupted recordings
 // Each frame is a complete JPEG, so the file is always readable even while recording
 func (c *Camera) recordAndStreamSegment(filename string) error {
-	inputFormat, inputDevice := c.getCameraInput()
+	limits := c.getSegmentLimits()
+
+	preview := ""
+	if c.hasPreview() {
+		preview = filepath.Join(filepath.Dir(filename), PreviewDirName, previewFile)
+		if err := os.MkdirAll(filepath.Dir(preview), 0755); err != nil {
+			return fmt.Errorf("failed to create preview directory: %w", err)
+		}
+		// -n refuses to overwrite, and the preview is rewritten every segment
+		os.Remove(preview)
+	}
+	// With a preview or pipe output, -fs would only end the recording output and
+	// leave ffmpeg running for the other, so a watcher enforces the size limit instead
+	var sizeLimit int64
+	if preview != "" || c.camConfig.PipeCommand != "" {
+		sizeLimit, limits.maxBytes = limits.maxBytes, 0
+	}
+	args := buildRecordArgs(c.recordConfig(), limits, filename, preview)
+
+	// stderr carries the -progress drop/dup counts as well as warnings, which are
+	// scanned for buffer overflows; only the last ~16KB of them is kept for error
+	// reporting. stdout is the pipe command's copy of the recording, if any.
+	frameStats := &segmentFrameStats{counters: &c.frameCounters}
+	stderrOutput := &stderrTail{limit: 16 * 1024}
+	name, args := PriorityArgs(c.nice, c.cpus, "ffmpeg", args)
+	c.setLastCommand(name, args)
+	c.cmdMu.Lock()
+	proc, err := c.runner.Start(context.Background(), name, args, c.pipeOutput(), frameStats.stderrWriter(stderrOutput))
+	if err != nil {
+		c.cmdMu.Unlock()
+		return err
+	}
+	c.recordProc = proc
+	exited := make(chan struct{})
+	c.recordExited = exited
+	c.cmdMu.Unlock()
+	if c.isStopped() || c.isPaused() {
+		c.interruptRecorder(proc, exited) // a stop or pause came in before recordProc was set
+	}
+
+	var rotated atomic.Bool
+	watchDone := make(chan struct{})
+	if sizeLimit > 0 {
+		go watchSegmentSize(filename, sizeLimit, proc, watchDone, &rotated)
+	}
+
+	// Wait for recording to complete
+	recordErr := proc.Wait()
+	close(watchDone)
+	c.lastSegmentFrames = int(frameStats.frames.Load())
+
+	c.cmdMu.Lock()
+	c.recordProc = nil
+	c.recordExited = nil
+	close(exited)
+	c.cmdMu.Unlock()
+
+	if recordErr != nil && !rotated.Load() {
+		if stderrOutput.Len() > 0 {
+			return fmt.Errorf("%w: %s", recordErr, stderrOutput.String())
+		}
+		return recordErr
+	}
+
+	return nil
+}
+
+// buildRecordArgs returns the ffmpeg arguments that record one MJPEG segment
+// from a V4L2 (or platform/test) source. It runs nothing, so the flags for
+// rotation, timestamps and format can be checked without a camera. If preview
+// is set, the same input is also split into a preview copy (see recordInputArgs)
+// and written there, so the device is only opened once; with a PipeCommand, a
+// copy of the recording is written to stdout for it. A WatermarkFile is read as
+// a second input; recordConfig has already dropped one that's missing.
+func buildRecordArgs(config CameraConfig, limits segmentLimits, filename, preview string) []string {
+	args := recordInputArgs(config, preview != "")
+
+	// Encode to MJPEG (Motion JPEG) for real-time streaming and robust recovery
+	args = append(args,
+		"-c:v", "mjpeg",
+		"-q:v", fmt.Sprintf("%d", config.MJPEGQuality),
+		"-r", fmt.Sprintf("%d", config.FPS),
+	)
+	if limits.seconds > 0 {
+		args = append(args, "-t", fmt.Sprintf("%d", limits.seconds))
+	}
+	// -fs stops ffmpeg cleanly once the segment reaches the size limit
+	if limits.maxBytes > 0 {
+		args = append(args, "-fs", fmt.Sprintf("%d", limits.maxBytes))
+	}
+	args = append(args, "-f", "mjpeg", filename)
+
+	if preview != "" {
+		args = append(args,
+			"-map", "[preview]",
+			"-c:v", "mjpeg",
+			"-q:v", fmt.Sprintf("%d", config.MJPEGQuality),
+			"-r", fmt.Sprintf("%d", config.FPS),
+		)
+		if limits.seconds > 0 {
+			args = append(args, "-t", fmt.Sprintf("%d", limits.seconds))
+		}
+		args = append(args, "-f", "mjpeg", preview)
+	}
+
+	if config.PipeCommand != "" {
+		args = append(args,
+			"-map", "[pipe]",
+			"-c:v", "mjpeg",
+			"-q:v", fmt.Sprintf("%d", config.MJPEGQuality),
+			"-r", fmt.Sprintf("%d", config.FPS),
+		)
+		if limits.seconds > 0 {
+			args = append(args, "-t", fmt.Sprintf("%d", limits.seconds))
+		}
+		args = append(args, "-f", "mjpeg", "pipe:1")
+	}
+
+	return args
+}
+
+// recordInputArgs returns the recorder's arguments up to its first output: the
+// camera input, the watermark input if any, and the filters between them and the
+// recording. With preview, the filtergraph also produces a [preview] stream for
+// a second output to map: scaled by PreviewScale (if set), and with or without
+// the overlays depending on PreviewNoOverlay. With a PipeCommand, [rec] is also
+// split into a [pipe] stream for the output the command reads.
+func recordInputArgs(config CameraConfig, preview bool) []string {
+	inputFormat, inputDevice := cameraInput(config)
 
 	args := []string{
-		"-y",
+		"-n", // never overwrite an existing segment
 		"-loglevel", "warning",
+		"-progress", "pipe:2", // key=value stats (drop_frames, dup_frames) on stderr, leaving stdout for the pipe command
+		"-nostats", // the \r-separated stats line would run into them
 		"-f", inputFormat,
 	}
 
 	if inputFormat == "video4linux2" || inputFormat == "v4l2" {
 		args = append(args,
 			"-input_format", "mjpeg",
-			"-video_size", fmt.Sprintf("%dx%d", c.camConfig.ResWidth, c.camConfig.ResHeight),
+			"-video_size", fmt.Sprintf("%dx%d", config.ResWidth, config.ResHeight),
 		)
 	}
 
+	// lavfi sources carry their own rate in the filter graph, but must be read at
+	// native speed or a whole segment is generated in a few seconds
+	if inputFormat == "lavfi" {
+		args = append(args, "-re")
+	} else {
+		args = append(args, "-framerate", fmt.Sprintf("%d", config.FPS))
+	}
 	args = append(args,
-		"-framerate", fmt.Sprintf("%d", c.camConfig.FPS),
 		"-rtbufsize", "5M",
 		"-thread_queue_size", "16",
 		"-i", inputDevice,
 	)
+	if config.WatermarkFile != "" {
+		args = append(args, "-i", config.WatermarkFile)
+	}
 
 	// Build video filters
 	var videoFilters []string
 
-	// Apply rotation if specified
-	if c.camConfig.Rotation != 0 {
-		switch c.camConfig.Rotation {
-		case 90:
-			videoFilters = append(videoFilters, "transpose=1")
-		case 180:
-			videoFilters = append(videoFilters, "transpose=1,transpose=1")
-		case 270:
-			videoFilters = append(videoFilters, "transpose=2")
-		}
-	}
-
+	// Scale before rotating so the configured size is the sensor-orientation size
+	// on every platform (v4l2 already captures at that size)
 	if inputFormat != "video4linux2" && inputFormat != "v4l2" {
-		videoFilters = append(videoFilters, fmt.Sprintf("scale=%d:%d", c.camConfig.ResWidth, c.camConfig.ResHeight))
+		videoFilters = append(videoFilters, fmt.Sprintf("scale=%d:%d", config.ResWidth, config.ResHeight))
 	}
-	if c.camConfig.EmbedTimestamp {
-		timestampFilter := "drawtext=text='%{gmtime\\:%Y-%m-%d %H\\\\\\:%M\\\\\\:%S} \\\\(UTC\\\\)':fontcolor=white:fontsize=24:box=1:boxcolor=black@0.5:boxborderw=5:x=10:y=10"
 
-		// Check for common font locations to ensure drawtext works
-		// Debian/Ubuntu/Raspberry Pi OS usually have DejaVuSans
-		fontPath := "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
-		if _, err := os.Stat(fontPath); err == nil {
-			timestampFilter += fmt.Sprintf(":fontfile=%s", fontPath)
-		}
+	videoFilters = append(videoFilters, orientationFilters(config.Rotation, config.FlipHorizontal, config.FlipVertical)...)
 
-		videoFilters = append(videoFilters, timestampFilter)
-	}
-
-	if len(videoFilters) > 0 {
-		args = append(args, "-vf", strings.Join(videoFilters, ","))
+	if !preview && config.WatermarkFile == "" && config.PipeCommand == "" {
+		videoFilters = append(videoFilters, overlayFilters(config)...)
+		if len(videoFilters) > 0 {
+			args = append(args, "-vf", strings.Join(videoFilters, ","))
+		}
+		return args
 	}
 
-	// Encode to MJPEG (Motion JPEG) for real-time streaming and robust recovery
-	args = append(args,
-		"-c:v", "mjpeg",
-		"-q:v", fmt.Sprintf("%d", c.camConfig.MJPEGQuality),
-		"-r", fmt.Sprintf("%d", c.camConfig.FPS),
-		"-t", fmt.Sprintf("%d", c.segmentLength),
-		"-f", "mjpeg",
-		filename,
-	)
-
-	recordCmd := exec.Command("ffmpeg", args...)
-
-	stderr, err := recordCmd.StderrPipe()
-	if err != nil {
-		return err
+	// The preview normally shows the overlays too, so it's split off after them;
+	// with PreviewNoOverlay it's split off before, showing the bare picture
+	previewScale := "null"
+	if config.PreviewScale > 0 && config.PreviewScale < 1 {
+		previewScale = fmt.Sprintf("scale=trunc(iw*%g/2)*2:-2", config.PreviewScale)
 	}
-
-	c.cmdMu.Lock()
-	c.recordCmd = recordCmd
-	c.cmdMu.Unlock()
-
-	if err := recordCmd.Start(); err != nil {
-		c.cmdMu.Lock()
-		c.recordCmd = nil
-		c.cmdMu.Unlock()
-		return err
+	graph := "[0:v]"
+	if preview && config.PreviewNoOverlay {
+		videoFilters = append(videoFilters, "split=2[main][pv]")
+		graph += strings.Join(videoFilters, ",") + ";[pv]" + previewScale + "[preview];[main]"
+		videoFilters = nil
 	}
 
-	// Capture stderr for debugging
-	var stderrOutput strings.Builder
-	go func() {
-		buf := make([]byte, FFmpegStderrBufferKB*BytesPerKB)
-		for {
-			n, err := stderr.Read(buf)
-			if n > 0 {
-				// Prevent unbounded growth - keep only the last ~16KB
-				if stderrOutput.Len() > 16*1024 {
-					stderrOutput.Reset()
-				}
-				stderrOutput.Write(buf[:n])
-			}
-			if err != nil {
-				break
-			}
+	// The watermark goes on after rotation so it stays upright in its corner, and
+	// under the timestamp and label so it never hides them. It needs a filtergraph
+	// with two inputs, so the filters so far are given a label to overlay onto.
+	if config.WatermarkFile != "" {
+		if len(videoFilters) > 0 {
+			graph += strings.Join(videoFilters, ",") + "[oriented];[oriented]"
 		}
-	}()
-
-	// Wait for recording to complete
-	recordErr := recordCmd.Wait()
-
-	c.cmdMu.Lock()
-	c.recordCmd = nil
-	c.cmdMu.Unlock()
+		graph += "[1:v]"
+		videoFilters = []string{WatermarkOverlay(config.WatermarkPosition)}
+	}
+	videoFilters = append(videoFilters, overlayFilters(config)...)
 
-	if recordErr != nil {
-		if stderrOutput.Len() > 0 {
-			return fmt.Errorf("%w: %s", recordErr, stderrOutput.String())
+	// The pipe command gets a copy of exactly what's recorded
+	recording := []string{"[rec]"}
+	if config.PipeCommand != "" {
+		recording = append(recording, "[pipe]")
+	}
+	if preview && !config.PreviewNoOverlay {
+		videoFilters = append(videoFilters, fmt.Sprintf("split=%d%s[pv];[pv]%s[preview]", len(recording)+1, strings.Join(recording, ""), previewScale))
+	} else if len(recording) > 1 {
+		videoFilters = append(videoFilters, fmt.Sprintf("split=%d%s", len(recording), strings.Join(recording, "")))
+	} else {
+		if len(videoFilters) == 0 {
+			videoFilters = []string{"null"}
 		}
-		return recordErr
+		videoFilters[len(videoFilters)-1] += "[rec]"
 	}
+	return append(args, "-filter_complex", graph+strings.Join(videoFilters, ","), "-map", "[rec]")
+}
 
-	return nil
+// hasPreview reports whether the camera records a separate preview: downscaled
+// (preview_scale), without overlays (preview_no_overlay) or both. USB cameras
+// only; rpicam-vid has a single output.
+func (c *Camera) hasPreview() bool {
+	scaled := c.camConfig.PreviewScale > 0 && c.camConfig.PreviewScale < 1
+	return !c.isCSI && (scaled || c.camConfig.PreviewNoOverlay)
 }
 
-// getCameraInput returns the format and device based on OS
+// getCameraInput returns the ffmpeg input format and device for this camera
 func (c *Camera) getCameraInput() (string, string) {
+	return cameraInput(c.camConfig)
+}
+
+// cameraInput returns the ffmpeg input format and device based on OS
+func cameraInput(config CameraConfig) (string, string) {
+	if IsTestDevice(config.Device) {
+		return "lavfi", testSourceInput(config)
+	}
+
 	switch runtime.GOOS {
 	case "darwin":
 		return "avfoundation", "0"
 	case "windows":
 		return "dshow", "video=\"USB Video Device\""
 	default:
-		device := c.camConfig.Device
+		device := config.Device
 		if device == "" {
 			device = "/dev/video0"
 		}
@@ -154,12 +278,53 @@ func (c *Camera) getCameraInput() (string, string) {
 	}
 }
 
-// Stop halts the recording
+// Stop halts the recording, leaving the last segment complete (see endSegment)
 func (c *Camera) Stop() {
-	close(c.done)
+	// The hot-plug watcher and a restart can both stop the same camera
+	c.stopOnce.Do(func() { close(c.done) })
+	c.endSegment()
+}
+
+// endSegment ends the running segment, if any, and returns once the recorder has
+// exited. The recorder is interrupted rather than killed so it writes out the
+// frame in progress and closes the file; it's only killed if it hasn't exited
+// within the stop grace period.
+func (c *Camera) endSegment() {
 	c.cmdMu.Lock()
-	defer c.cmdMu.Unlock()
-	if c.recordCmd != nil && c.recordCmd.Process != nil {
-		c.recordCmd.Process.Kill()
+	proc, exited := c.recordProc, c.recordExited
+	c.cmdMu.Unlock()
+	if proc == nil {
+		return
+	}
+
+	grace := c.getStopGrace()
+	if grace <= 0 || proc.Interrupt() != nil {
+		proc.Kill()
+		return
+	}
+	select {
+	case <-exited:
+	case <-time.After(grace):
+		c.logger.Warnf("Camera '%s': Recorder didn't exit within %v of being interrupted, killing it", c.camConfig.Name, grace)
+		proc.Kill()
 	}
 }
+
+// interruptRecorder ends a recorder that Stop or SetPaused missed because it
+// was started just after them, like endSegment but without waiting: it's
+// killed if it hasn't exited within the stop grace period
+func (c *Camera) interruptRecorder(proc Process, exited <-chan struct{}) {
+	grace := c.getStopGrace()
+	if grace <= 0 || proc.Interrupt() != nil {
+		proc.Kill()
+		return
+	}
+	go func() {
+		select {
+		case <-exited:
+		case <-time.After(grace):
+			c.logger.Warnf("Camera '%s': Recorder didn't exit within %v of being interrupted, killing it", c.camConfig.Name, grace)
+			proc.Kill()
+		}
+	}()
+}
@@ -0,0 +1,327 @@
+package camera
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// flagValues returns the value after every occurrence of flag in args
+func flagValues(args []string, flag string) []string {
+	var values []string
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			values = append(values, args[i+1])
+		}
+	}
+	return values
+}
+
+// testRecordConfig is a camera on the synthetic test source; lavfi input is the
+// same on every platform, so the filters can be checked exactly
+func testRecordConfig() CameraConfig {
+	return CameraConfig{
+		ID:           "front",
+		Name:         "Front",
+		Device:       TestDevicePrefix + "color",
+		ResWidth:     640,
+		ResHeight:    480,
+		FPS:          15,
+		MJPEGQuality: 5,
+	}
+}
+
+func TestBuildRecordArgs(t *testing.T) {
+	timestamp := drawtextFilter(timestampText, "10", "10")
+	label := drawtextFilter(escapeDrawtext("Front"), "w-tw-10", "10", "expansion=none")
+	halfScale := "scale=trunc(iw*0.5/2)*2:-2"
+
+	tests := []struct {
+		name    string
+		modify  func(*CameraConfig)
+		limits  segmentLimits
+		preview string
+		want    map[string][]string // flag -> every value it's given
+		absent  []string            // flags that mustn't appear
+	}{
+		{
+			name:   "no filters beyond the scale",
+			limits: segmentLimits{seconds: 60},
+			want: map[string][]string{
+				"-vf": {"scale=640:480"},
+				"-t":  {"60"},
+				"-f":  {"lavfi", "mjpeg"},
+				"-r":  {"15"},
+				"-i":  {"color=c=gray:size=640x480:rate=15"},
+			},
+			absent: []string{"-fs", "-filter_complex", "-map"},
+		},
+		{
+			name:   "rotation 90",
+			modify: func(c *CameraConfig) { c.Rotation = 90 },
+			limits: segmentLimits{seconds: 60},
+			want:   map[string][]string{"-vf": {"scale=640:480,transpose=1"}},
+		},
+		{
+			name:   "rotation 270",
+			modify: func(c *CameraConfig) { c.Rotation = 270 },
+			limits: segmentLimits{seconds: 60},
+			want:   map[string][]string{"-vf": {"scale=640:480,transpose=2"}},
+		},
+		{
+			name:   "horizontal flip",
+			modify: func(c *CameraConfig) { c.FlipHorizontal = true },
+			limits: segmentLimits{seconds: 60},
+			want:   map[string][]string{"-vf": {"scale=640:480,hflip"}},
+		},
+		{
+			name:   "timestamp after rotation",
+			modify: func(c *CameraConfig) { c.Rotation = 90; c.EmbedTimestamp = true },
+			limits: segmentLimits{seconds: 60},
+			want:   map[string][]string{"-vf": {"scale=640:480,transpose=1," + timestamp}},
+		},
+		{
+			name:   "timestamp and label",
+			modify: func(c *CameraConfig) { c.EmbedTimestamp = true; c.LabelOverlay = true },
+			limits: segmentLimits{seconds: 60},
+			want:   map[string][]string{"-vf": {"scale=640:480," + timestamp + "," + label}},
+		},
+		{
+			name:   "size limit",
+			limits: segmentLimits{seconds: 60, maxBytes: 50 << 20},
+			want:   map[string][]string{"-t": {"60"}, "-fs": {"52428800"}},
+		},
+		{
+			name:   "size limit only",
+			limits: segmentLimits{maxBytes: 1000},
+			want:   map[string][]string{"-fs": {"1000"}},
+			absent: []string{"-t"},
+		},
+		{
+			name:    "downscaled preview",
+			modify:  func(c *CameraConfig) { c.PreviewScale = 0.5; c.EmbedTimestamp = true },
+			limits:  segmentLimits{seconds: 60},
+			preview: "preview.mjpeg",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480," + timestamp + ",split=2[rec][pv];[pv]" + halfScale + "[preview]"},
+				"-map":            {"[rec]", "[preview]"},
+				"-t":              {"60", "60"},
+				"-f":              {"lavfi", "mjpeg", "mjpeg"},
+			},
+			absent: []string{"-vf"},
+		},
+		{
+			name:    "preview without overlays",
+			modify:  func(c *CameraConfig) { c.PreviewNoOverlay = true; c.EmbedTimestamp = true },
+			limits:  segmentLimits{seconds: 60},
+			preview: "preview.mjpeg",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480,split=2[main][pv];[pv]null[preview];[main]" + timestamp + "[rec]"},
+				"-map":            {"[rec]", "[preview]"},
+			},
+		},
+		{
+			name:    "downscaled preview without overlays",
+			modify:  func(c *CameraConfig) { c.PreviewScale = 0.5; c.PreviewNoOverlay = true; c.Rotation = 90 },
+			limits:  segmentLimits{seconds: 60},
+			preview: "preview.mjpeg",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480,transpose=1,split=2[main][pv];[pv]" + halfScale + "[preview];[main]null[rec]"},
+			},
+		},
+		{
+			name:   "watermark",
+			modify: func(c *CameraConfig) { c.WatermarkFile = "/logo.png"; c.Rotation = 90 },
+			limits: segmentLimits{seconds: 60},
+			want: map[string][]string{
+				"-i":              {"color=c=gray:size=640x480:rate=15", "/logo.png"},
+				"-filter_complex": {"[0:v]scale=640:480,transpose=1[oriented];[oriented][1:v]overlay=x=W-w-10:y=H-h-10[rec]"},
+				"-map":            {"[rec]"},
+			},
+			absent: []string{"-vf"},
+		},
+		{
+			name: "watermark under the timestamp",
+			modify: func(c *CameraConfig) {
+				c.WatermarkFile = "/logo.png"
+				c.WatermarkPosition = WatermarkTopLeft
+				c.EmbedTimestamp = true
+			},
+			limits: segmentLimits{seconds: 60},
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480[oriented];[oriented][1:v]overlay=x=10:y=10," + timestamp + "[rec]"},
+			},
+		},
+		{
+			name:    "watermark with a downscaled preview",
+			modify:  func(c *CameraConfig) { c.WatermarkFile = "/logo.png"; c.PreviewScale = 0.5 },
+			limits:  segmentLimits{seconds: 60},
+			preview: "preview.mjpeg",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480[oriented];[oriented][1:v]overlay=x=W-w-10:y=H-h-10,split=2[rec][pv];[pv]" + halfScale + "[preview]"},
+				"-map":            {"[rec]", "[preview]"},
+			},
+		},
+		{
+			name: "watermark with a preview without overlays",
+			modify: func(c *CameraConfig) {
+				c.WatermarkFile = "/logo.png"
+				c.PreviewNoOverlay = true
+				c.EmbedTimestamp = true
+			},
+			limits:  segmentLimits{seconds: 60},
+			preview: "preview.mjpeg",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480,split=2[main][pv];[pv]null[preview];[main][1:v]overlay=x=W-w-10:y=H-h-10," + timestamp + "[rec]"},
+			},
+		},
+		{
+			name:   "pipe command",
+			modify: func(c *CameraConfig) { c.PipeCommand = "cat"; c.EmbedTimestamp = true },
+			limits: segmentLimits{seconds: 60},
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480," + timestamp + ",split=2[rec][pipe]"},
+				"-map":            {"[rec]", "[pipe]"},
+				"-t":              {"60", "60"},
+				"-f":              {"lavfi", "mjpeg", "mjpeg"},
+				"-progress":       {"pipe:2"},
+			},
+			absent: []string{"-vf"},
+		},
+		{
+			name:    "pipe command with a downscaled preview",
+			modify:  func(c *CameraConfig) { c.PipeCommand = "cat"; c.PreviewScale = 0.5 },
+			limits:  segmentLimits{seconds: 60},
+			preview: "preview.mjpeg",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480,split=3[rec][pipe][pv];[pv]" + halfScale + "[preview]"},
+				"-map":            {"[rec]", "[preview]", "[pipe]"},
+			},
+		},
+		{
+			name: "pipe command with a watermark and a preview without overlays",
+			modify: func(c *CameraConfig) {
+				c.PipeCommand = "cat"
+				c.WatermarkFile = "/logo.png"
+				c.PreviewNoOverlay = true
+			},
+			limits:  segmentLimits{seconds: 60},
+			preview: "preview.mjpeg",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v]scale=640:480,split=2[main][pv];[pv]null[preview];[main][1:v]overlay=x=W-w-10:y=H-h-10,split=2[rec][pipe]"},
+				"-map":            {"[rec]", "[preview]", "[pipe]"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testRecordConfig()
+			if tt.modify != nil {
+				tt.modify(&config)
+			}
+			args := buildRecordArgs(config, tt.limits, "segment.mjpeg", tt.preview)
+
+			for flag, want := range tt.want {
+				if got := flagValues(args, flag); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %q, want %q\nargs: %s", flag, got, want, strings.Join(args, " "))
+				}
+			}
+			for _, flag := range tt.absent {
+				if got := flagValues(args, flag); len(got) > 0 {
+					t.Errorf("unexpected %s %q", flag, got)
+				}
+			}
+			if args[0] != "-n" {
+				t.Errorf("args start with %q, want -n so a segment is never overwritten", args[0])
+			}
+			outputs := []string{"segment.mjpeg"}
+			if tt.preview != "" {
+				outputs = append(outputs, tt.preview)
+			}
+			if config.PipeCommand != "" {
+				outputs = append(outputs, "pipe:1")
+			}
+			if last := args[len(args)-1]; last != outputs[len(outputs)-1] {
+				t.Errorf("last argument %q, want output %q", last, outputs[len(outputs)-1])
+			}
+		})
+	}
+}
+
+func TestBuildRecordArgsV4L2(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("V4L2 input is Linux only")
+	}
+	config := testRecordConfig()
+	config.Device = "/dev/video2"
+	config.Rotation = 180
+	args := buildRecordArgs(config, segmentLimits{seconds: 60}, "segment.mjpeg", "")
+
+	want := map[string][]string{
+		"-f":            {"v4l2", "mjpeg"},
+		"-input_format": {"mjpeg"},
+		"-video_size":   {"640x480"},
+		"-framerate":    {"15"},
+		"-i":            {"/dev/video2"},
+		// Captured at the configured size, so there's no scale; 180 is both flips
+		"-vf": {"hflip,vflip"},
+	}
+	for flag, w := range want {
+		if got := flagValues(args, flag); !reflect.DeepEqual(got, w) {
+			t.Errorf("%s = %q, want %q", flag, got, w)
+		}
+	}
+	if got := flagValues(args, "-re"); len(got) > 0 {
+		t.Error("a camera must not be read with -re")
+	}
+}
+
+func TestBuildContinuousRecordArgs(t *testing.T) {
+	config := testRecordConfig()
+	config.PreviewScale = 0.5
+	args := buildContinuousRecordArgs(config, 60, "staging/"+stagedNamePattern, "preview/preview_%d.mjpeg")
+
+	want := map[string][]string{
+		"-f":                {"lavfi", "segment", "segment"},
+		"-segment_format":   {"mjpeg", "mjpeg"},
+		"-segment_time":     {"60", "60"},
+		"-reset_timestamps": {"1"},
+		"-strftime":         {"1"},
+		"-segment_wrap":     {"2"},
+		"-map":              {"[rec]", "[preview]"},
+	}
+	for flag, w := range want {
+		if got := flagValues(args, flag); !reflect.DeepEqual(got, w) {
+			t.Errorf("%s = %q, want %q", flag, got, w)
+		}
+	}
+	if got := flagValues(args, "-t"); len(got) > 0 {
+		t.Errorf("the segment muxer ends segments itself, got -t %q", got)
+	}
+	if !strings.Contains(strings.Join(args, " "), "staging/"+stagedNamePattern+" -map [preview]") {
+		t.Errorf("recording output isn't the strftime pattern: %s", strings.Join(args, " "))
+	}
+}
+
+func TestBuildContinuousRecordArgsPipe(t *testing.T) {
+	config := testRecordConfig()
+	config.PipeCommand = "cat"
+	args := buildContinuousRecordArgs(config, 60, "staging/"+stagedNamePattern, "")
+
+	want := map[string][]string{
+		"-filter_complex": {"[0:v]scale=640:480,split=2[rec][pipe]"},
+		"-map":            {"[rec]", "[pipe]"},
+		"-f":              {"lavfi", "segment", "mjpeg"},
+		"-segment_time":   {"60"},
+	}
+	for flag, w := range want {
+		if got := flagValues(args, flag); !reflect.DeepEqual(got, w) {
+			t.Errorf("%s = %q, want %q", flag, got, w)
+		}
+	}
+	if last := args[len(args)-1]; last != "pipe:1" {
+		t.Errorf("last argument %q, want the pipe output", last)
+	}
+}
@@ -0,0 +1,105 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// Runner starts the external programs recording depends on (ffmpeg, rpicam-vid).
+// Camera and the export code go through a Runner instead of os/exec directly so
+// a fake can stand in for real processes, e.g. to exercise segment rotation,
+// error backoff and cancellation without a camera or ffmpeg installed.
+type Runner interface {
+	// Run executes the command to completion. stdout and stderr may be nil.
+	Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error
+	// Start launches the command and returns without waiting for it to exit
+	Start(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (Process, error)
+	// StartPiped is Start with a pipe to the command's stdin, which the caller
+	// writes to and closes. Writes fail once the command has exited.
+	StartPiped(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (Process, io.WriteCloser, error)
+}
+
+// Process is a command launched by Runner.Start
+type Process interface {
+	Wait() error
+	Kill() error
+	// Interrupt asks the process to finish up and exit (SIGINT)
+	Interrupt() error
+}
+
+// ExecRunner is the Runner backed by os/exec
+type ExecRunner struct{}
+
+func (ExecRunner) command(ctx context.Context, name string, args []string, stdout, stderr io.Writer) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	if stderr != nil {
+		cmd.Stderr = stderr
+	}
+	return cmd
+}
+
+// Run implements Runner
+func (r ExecRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	return r.command(ctx, name, args, stdout, stderr).Run()
+}
+
+// Start implements Runner
+func (r ExecRunner) Start(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (Process, error) {
+	cmd := r.command(ctx, name, args, stdout, stderr)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return execProcess{cmd}, nil
+}
+
+// StartPiped implements Runner
+func (r ExecRunner) StartPiped(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (Process, io.WriteCloser, error) {
+	cmd := r.command(ctx, name, args, stdout, stderr)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return execProcess{cmd}, stdin, nil
+}
+
+type execProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p execProcess) Wait() error { return p.cmd.Wait() }
+
+func (p execProcess) Kill() error { return p.cmd.Process.Kill() }
+
+func (p execProcess) Interrupt() error { return p.cmd.Process.Signal(os.Interrupt) }
+
+// stderrTail keeps the most recent output of a process for error messages,
+// starting over once it exceeds limit bytes. onWrite, if set, sees every chunk.
+type stderrTail struct {
+	limit   int
+	buf     bytes.Buffer
+	onWrite func(p []byte)
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	if t.buf.Len()+len(p) > t.limit {
+		t.buf.Reset()
+	}
+	t.buf.Write(p)
+	if t.onWrite != nil {
+		t.onWrite(p)
+	}
+	return len(p), nil
+}
+
+func (t *stderrTail) Len() int { return t.buf.Len() }
+
+func (t *stderrTail) String() string { return t.buf.String() }
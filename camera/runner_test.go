@@ -0,0 +1,327 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLogger discards everything; Fatalf fails loudly instead of exiting
+type testLogger struct{}
+
+func (testLogger) Printf(format string, v ...interface{}) {}
+func (testLogger) Debugf(format string, v ...interface{}) {}
+func (testLogger) Warnf(format string, v ...interface{})  {}
+func (testLogger) Errorf(format string, v ...interface{}) {}
+func (testLogger) Fatalf(format string, v ...interface{}) { panic("Fatalf called") }
+
+// fakeJPEG is the frame a fake recorder writes to its output
+var fakeJPEG = []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x02, 0xFF, 0xD9}
+
+// fakeRunner stands in for ffmpeg. Each Start is recorded; unless it's one of
+// the first fail starts, the process writes fakeJPEG to its output (the last
+// argument) and runs for runFor, or until interrupted if runFor is 0.
+// StartPiped processes collect their stdin instead.
+type fakeRunner struct {
+	fail   int
+	runFor time.Duration
+
+	mu     sync.Mutex
+	starts []fakeStart
+	procs  []*fakeProcess
+	stdins []*fakeStdin // of the StartPiped processes
+}
+
+// fakeStart is one Start call seen by a fakeRunner
+type fakeStart struct {
+	at   time.Time
+	args []string
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	return errors.New("fakeRunner: Run not supported")
+}
+
+func (r *fakeRunner) Start(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (Process, error) {
+	proc := newFakeProcess()
+	r.mu.Lock()
+	r.starts = append(r.starts, fakeStart{at: time.Now(), args: args})
+	r.procs = append(r.procs, proc)
+	failing := len(r.starts) <= r.fail
+	r.mu.Unlock()
+
+	if failing {
+		proc.exit(errors.New("exit status 1"))
+		return proc, nil
+	}
+	if err := os.WriteFile(args[len(args)-1], fakeJPEG, 0644); err != nil {
+		return nil, err
+	}
+	if r.runFor > 0 {
+		time.AfterFunc(r.runFor, func() { proc.exit(nil) })
+	}
+	return proc, nil
+}
+
+// StartPiped runs a command that reads its stdin until it's closed, then exits
+func (r *fakeRunner) StartPiped(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (Process, io.WriteCloser, error) {
+	proc := newFakeProcess()
+	stdin := &fakeStdin{proc: proc}
+	r.mu.Lock()
+	r.starts = append(r.starts, fakeStart{at: time.Now(), args: args})
+	r.procs = append(r.procs, proc)
+	r.stdins = append(r.stdins, stdin)
+	r.mu.Unlock()
+	return proc, stdin, nil
+}
+
+// fakeStdin collects what's written to a piped fake process
+type fakeStdin struct {
+	proc *fakeProcess
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (s *fakeStdin) Write(p []byte) (int, error) {
+	select {
+	case <-s.proc.exited:
+		return 0, errors.New("write |1: broken pipe")
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *fakeStdin) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.proc.exit(nil)
+	return nil
+}
+
+// bytes returns a copy of what's been written so far
+func (s *fakeStdin) bytes() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bytes.Clone(s.buf.Bytes())
+}
+
+// startCount returns how many times Start has been called
+func (r *fakeRunner) startCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.starts)
+}
+
+// running returns how many started processes haven't exited
+func (r *fakeRunner) running() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, proc := range r.procs {
+		select {
+		case <-proc.exited:
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// startTimes returns when each Start was called
+func (r *fakeRunner) startTimes() []time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	times := make([]time.Time, len(r.starts))
+	for i, s := range r.starts {
+		times[i] = s.at
+	}
+	return times
+}
+
+// fakeProcess exits once, on its own or when interrupted or killed
+type fakeProcess struct {
+	once   sync.Once
+	exited chan struct{}
+	err    error
+}
+
+func newFakeProcess() *fakeProcess {
+	return &fakeProcess{exited: make(chan struct{})}
+}
+
+func (p *fakeProcess) exit(err error) {
+	p.once.Do(func() {
+		p.err = err
+		close(p.exited)
+	})
+}
+
+func (p *fakeProcess) Wait() error {
+	<-p.exited
+	return p.err
+}
+
+func (p *fakeProcess) Kill() error {
+	p.exit(errors.New("signal: killed"))
+	return nil
+}
+
+func (p *fakeProcess) Interrupt() error {
+	p.exit(nil)
+	return nil
+}
+
+// newTestCamera returns a camera on the synthetic test source that records
+// through runner
+func newTestCamera(t *testing.T, id string, runner Runner) *Camera {
+	t.Helper()
+	config := CameraConfig{
+		ID:           id,
+		Name:         id,
+		Device:       TestDevicePrefix + "color",
+		ResWidth:     64,
+		ResHeight:    48,
+		FPS:          10,
+		MJPEGQuality: 5,
+		Enabled:      true,
+	}
+	cam, err := NewCamera(config, 1, "libx264", testLogger{})
+	if err != nil {
+		t.Fatalf("NewCamera: %v", err)
+	}
+	cam.SetRunner(runner)
+	return cam
+}
+
+// waitFor polls cond until it's true or the deadline passes
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %v", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// runCamera starts cam in videoDir and returns a function that stops it and
+// waits for Start to return
+func runCamera(t *testing.T, cam *Camera, videoDir string) func() {
+	t.Helper()
+	returned := make(chan error, 1)
+	go func() { returned <- cam.Start(videoDir) }()
+	return func() {
+		cam.Stop()
+		select {
+		case err := <-returned:
+			if err != nil {
+				t.Errorf("Start returned %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Start didn't return after Stop")
+		}
+	}
+}
+
+func TestSegmentRotation(t *testing.T) {
+	runner := &fakeRunner{runFor: 20 * time.Millisecond}
+	cam := newTestCamera(t, "front", runner)
+	videoDir := t.TempDir()
+
+	stop := runCamera(t, cam, videoDir)
+	waitFor(t, 5*time.Second, func() bool { return runner.startCount() >= 4 })
+	stop()
+
+	for i, start := range runner.starts {
+		args := strings.Join(start.args, " ")
+		if !strings.Contains(args, "-t 1 ") {
+			t.Errorf("start %d: segment length not passed as -t 1: %s", i, args)
+		}
+	}
+
+	files, err := ListSegmentFiles(videoDir)
+	if err != nil {
+		t.Fatalf("ListSegmentFiles: %v", err)
+	}
+	var seqs []int
+	for _, file := range files {
+		if filepath.Ext(file.Info.Name()) != ".mjpeg" {
+			continue // sidecar
+		}
+		_, seq, ok := ParseSegmentName(file.Info.Name())
+		if !ok {
+			t.Fatalf("unparseable segment name %q", file.Info.Name())
+		}
+		seqs = append(seqs, seq)
+		if _, ok := ReadSegmentMeta(file.Path); !ok {
+			t.Errorf("segment %s has no sidecar", file.Info.Name())
+		}
+	}
+	if len(seqs) != runner.startCount() {
+		t.Fatalf("got %d segments for %d recorder starts", len(seqs), runner.startCount())
+	}
+	sort.Ints(seqs)
+	for i, seq := range seqs {
+		if seq != i {
+			t.Fatalf("sequence numbers %v, want 0..%d in order", seqs, len(seqs)-1)
+		}
+	}
+}
+
+func TestSegmentRotationContinuesSequence(t *testing.T) {
+	videoDir := t.TempDir()
+	existing := filepath.Join(videoDir, SegmentFilename("front", time.Now().Add(-time.Hour), 41))
+	if err := os.WriteFile(existing, fakeJPEG, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &fakeRunner{runFor: 20 * time.Millisecond}
+	cam := newTestCamera(t, "front", runner)
+	stop := runCamera(t, cam, videoDir)
+	waitFor(t, 5*time.Second, func() bool { return runner.startCount() >= 1 })
+	stop()
+
+	if _, seq, _ := ParseSegmentName(filepath.Base(runner.starts[0].args[len(runner.starts[0].args)-1])); seq != 42 {
+		t.Errorf("first new segment has sequence %d, want 42", seq)
+	}
+}
+
+func TestOpenRetryBackoff(t *testing.T) {
+	// The first two opens fail; with two attempts the camera is reported as
+	// failed after the second, then keeps retrying until the third succeeds
+	runner := &fakeRunner{fail: 2, runFor: 20 * time.Millisecond}
+	cam := newTestCamera(t, "front", runner)
+	cam.SetOpenAttempts(2)
+
+	stop := runCamera(t, cam, t.TempDir())
+	waitFor(t, 3*OpenRetryDelay+5*time.Second, func() bool { return runner.startCount() >= 4 })
+	stop()
+
+	times := runner.startTimes()
+	for i := 1; i <= 2; i++ {
+		if gap := times[i].Sub(times[i-1]); gap < OpenRetryDelay {
+			t.Errorf("attempt %d came %v after a failed open, want at least %v", i+1, gap, OpenRetryDelay)
+		}
+	}
+	// Once a segment has recorded, the next one starts straight away
+	if gap := times[3].Sub(times[2]); gap >= OpenRetryDelay {
+		t.Errorf("segment after a successful open started %v later, want no backoff", gap)
+	}
+	if cam.lastErrorTime.IsZero() {
+		t.Error("camera wasn't reported as failed after running out of open attempts")
+	}
+}
@@ -0,0 +1,66 @@
+package camera
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Segment modes: what ends a segment
+const (
+	SegmentModeTime = "time" // segment length only (default)
+	SegmentModeSize = "size" // file size only
+	SegmentModeBoth = "both" // whichever limit is hit first
+)
+
+// segmentLimits bounds one segment; a zero field means no limit of that kind
+type segmentLimits struct {
+	seconds  int
+	maxBytes int64
+}
+
+// SetSegmentSize sets the segment mode and size limit; like SetSegmentLength it
+// applies from the next segment. Modes other than time need maxBytes > 0.
+func (c *Camera) SetSegmentSize(mode string, maxBytes int64) {
+	c.stateMu.Lock()
+	c.segmentMode = mode
+	c.segmentMaxBytes = maxBytes
+	c.stateMu.Unlock()
+}
+
+func (c *Camera) getSegmentLimits() segmentLimits {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	if c.segmentMaxBytes <= 0 {
+		return segmentLimits{seconds: c.segmentLength}
+	}
+	switch c.segmentMode {
+	case SegmentModeSize:
+		return segmentLimits{maxBytes: c.segmentMaxBytes}
+	case SegmentModeBoth:
+		return segmentLimits{seconds: c.segmentLength, maxBytes: c.segmentMaxBytes}
+	default:
+		return segmentLimits{seconds: c.segmentLength}
+	}
+}
+
+// watchSegmentSize kills proc once filename reaches maxBytes, for recorders that
+// can't limit their own output size (rpicam-vid). It returns when done is closed
+// and reports through rotated whether it ended the segment.
+func watchSegmentSize(filename string, maxBytes int64, proc Process, done <-chan struct{}, rotated *atomic.Bool) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if info, err := os.Stat(filename); err == nil && info.Size() >= maxBytes {
+				rotated.Store(true)
+				proc.Kill()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package camera
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SegmentTimeLayout is the wall-clock timestamp embedded in segment filenames
+	SegmentTimeLayout = "2006-01-02_15-04-05"
+)
+
+// SegmentFilename builds a segment name: dashcam_<camera>_<timestamp>_<seq>.mjpeg.
+// The sequence number only ever increases for a camera, so segment order survives
+// wall-clock jumps (e.g. an RTC-less Pi syncing NTP after boot).
+func SegmentFilename(cameraID string, start time.Time, seq int) string {
+	return fmt.Sprintf("dashcam_%s_%s_%06d.mjpeg", cameraID, start.Format(SegmentTimeLayout), seq)
+}
+
+// ParseSegmentName extracts the start timestamp and sequence number from a segment
+// filename. seq is -1 for older segments recorded before sequence numbers existed.
+func ParseSegmentName(name string) (start time.Time, seq int, ok bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	parts := strings.Split(base, "_")
+	if len(parts) < 4 || parts[0] != "dashcam" {
+		return time.Time{}, -1, false
+	}
+
+	seq = -1
+	if n, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+		seq = n
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) < 4 {
+		return time.Time{}, -1, false
+	}
+
+	stamp := parts[len(parts)-2] + "_" + parts[len(parts)-1]
+	start, err := time.ParseInLocation(SegmentTimeLayout, stamp, time.Local)
+	if err != nil {
+		return time.Time{}, -1, false
+	}
+	return start, seq, true
+}
+
+// nextSegmentSeq returns one past the highest sequence number already used in dir
+// (including its day directories), so numbering continues across restarts
+func nextSegmentSeq(dir string) int {
+	files, err := ListSegmentFiles(dir)
+	if err != nil {
+		return 0
+	}
+
+	next := 0
+	for _, file := range files {
+		if _, seq, ok := ParseSegmentName(file.Info.Name()); ok && seq >= next {
+			next = seq + 1
+		}
+	}
+	return next
+}
+
+// uniqueSegmentPath returns a segment path in dir that doesn't exist yet, bumping
+// seq past any name already taken. Returns the path and the sequence number used.
+func uniqueSegmentPath(dir, cameraID string, start time.Time, seq int) (string, int) {
+	for {
+		path := filepath.Join(dir, SegmentFilename(cameraID, start, seq))
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path, seq
+		}
+		seq++
+	}
+}
@@ -0,0 +1,90 @@
+package camera
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/jpeg"
+	"time"
+)
+
+const (
+	// SelfTestTimeout bounds a single camera's self-test capture
+	SelfTestTimeout = 15 * time.Second
+)
+
+// SelfTestResult is the outcome of capturing a single frame from a camera at boot
+type SelfTestResult struct {
+	CameraID string    `json:"camera_id"`
+	Name     string    `json:"name"`
+	Passed   bool      `json:"passed"`
+	Width    int       `json:"width,omitempty"`
+	Height   int       `json:"height,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	TestedAt time.Time `json:"tested_at"`
+}
+
+// SelfTest captures one JPEG frame from the camera and reports its dimensions.
+// Must run before Start: the device can only be opened by one process at a time.
+func (c *Camera) SelfTest() SelfTestResult {
+	result := SelfTestResult{
+		CameraID: c.camConfig.ID,
+		Name:     c.camConfig.Name,
+		TestedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SelfTestTimeout)
+	defer cancel()
+
+	var name string
+	var args []string
+	if c.isCSI {
+		name = "rpicam-still"
+		args = []string{
+			"-n",         // no preview window
+			"-t", "1000", // give auto-exposure a moment to settle
+			"--width", fmt.Sprintf("%d", c.camConfig.ResWidth),
+			"--height", fmt.Sprintf("%d", c.camConfig.ResHeight),
+			"-e", "jpg",
+			"-o", "-",
+		}
+	} else {
+		inputFormat, inputDevice := c.getCameraInput()
+		name = "ffmpeg"
+		args = []string{"-loglevel", "error", "-f", inputFormat}
+		if inputFormat == "video4linux2" || inputFormat == "v4l2" {
+			args = append(args,
+				"-input_format", "mjpeg",
+				"-video_size", fmt.Sprintf("%dx%d", c.camConfig.ResWidth, c.camConfig.ResHeight),
+			)
+		}
+		args = append(args,
+			"-i", inputDevice,
+			"-frames:v", "1",
+			"-c:v", "mjpeg",
+			"-f", "image2pipe",
+			"-",
+		)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := c.runner.Run(ctx, name, args, &stdout, &stderr); err != nil {
+		if stderr.Len() > 0 {
+			result.Error = fmt.Sprintf("%v: %s", err, stderr.String())
+		} else {
+			result.Error = err.Error()
+		}
+		return result
+	}
+
+	imgConfig, err := jpeg.DecodeConfig(bytes.NewReader(stdout.Bytes()))
+	if err != nil {
+		result.Error = fmt.Sprintf("captured data is not a valid JPEG: %v", err)
+		return result
+	}
+
+	result.Passed = true
+	result.Width = imgConfig.Width
+	result.Height = imgConfig.Height
+	return result
+}
@@ -0,0 +1,101 @@
+package camera
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SegmentMeta is the sidecar written next to each finished segment
+// (<segment>.json), so listings and exports don't have to stat and scan the
+// MJPEG file, and the record survives the segment being transcoded
+type SegmentMeta struct {
+	CameraID  string      `json:"camera_id"`
+	StartTime time.Time   `json:"start_time"`
+	EndTime   time.Time   `json:"end_time"`
+	Frames    int         `json:"frames"`
+	Width     int         `json:"width"`
+	Height    int         `json:"height"`
+	FPS       int         `json:"fps"`
+	Events    []time.Time `json:"events,omitempty"` // events marked while the segment was recording
+}
+
+// SidecarPath returns the metadata sidecar path for a segment
+func SidecarPath(segment string) string {
+	return strings.TrimSuffix(segment, filepath.Ext(segment)) + ".json"
+}
+
+// ReadSegmentMeta loads a segment's sidecar; ok is false if there is none or it
+// can't be parsed
+func ReadSegmentMeta(segment string) (meta SegmentMeta, ok bool) {
+	data, err := os.ReadFile(SidecarPath(segment))
+	if err != nil {
+		return SegmentMeta{}, false
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return SegmentMeta{}, false
+	}
+	return meta, true
+}
+
+// writeSegmentMeta writes the sidecar through a temp file and rename, so a
+// reader never sees a half-written one
+func writeSegmentMeta(segment string, meta SegmentMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	path := SidecarPath(segment)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// MarkEvent flags t as an event for the segment being recorded; it is listed
+// in that segment's sidecar
+func (c *Camera) MarkEvent(t time.Time) {
+	c.stateMu.Lock()
+	c.pendingEvents = append(c.pendingEvents, t)
+	c.stateMu.Unlock()
+}
+
+// finishSegment writes the sidecar for a segment that just ended. frames is
+// what ffmpeg reported; 0 (rpicam-vid, or no progress output) falls back to an
+// estimate from the file size.
+func (c *Camera) finishSegment(filename string, start time.Time, frames int) {
+	info, err := os.Stat(filename)
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	if frames <= 0 {
+		frames = EstimateFrameCount(filename, info.Size())
+	}
+
+	c.stateMu.Lock()
+	events := c.pendingEvents
+	c.pendingEvents = nil
+	c.stateMu.Unlock()
+
+	width, height := c.camConfig.OutputSize()
+	meta := SegmentMeta{
+		CameraID:  c.camConfig.ID,
+		StartTime: start,
+		EndTime:   time.Now(),
+		Frames:    frames,
+		Width:     width,
+		Height:    height,
+		FPS:       c.camConfig.FPS,
+		Events:    events,
+	}
+	if err := writeSegmentMeta(filename, meta); err != nil {
+		c.logger.Warnf("Camera '%s': Failed to write segment metadata for %s: %v", c.camConfig.Name, filepath.Base(filename), err)
+	}
+}
@@ -0,0 +1,90 @@
+package camera
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// SnapshotDirName is the per-camera subdirectory interval snapshots go in
+	SnapshotDirName = "snapshots"
+
+	// DefaultSnapshotRetain is how many snapshots a camera keeps when snapshot_retain is unset
+	DefaultSnapshotRetain = 1440 // one day at one per minute
+)
+
+// SnapshotFilename builds a snapshot name: snapshot_<camera>_<timestamp>.jpg
+func SnapshotFilename(cameraID string, t time.Time) string {
+	return fmt.Sprintf("snapshot_%s_%s.jpg", cameraID, t.Format(SegmentTimeLayout))
+}
+
+// snapshotLoop saves the stream manager's cached frame to videoDir/snapshots every
+// SnapshotIntervalS seconds and prunes the oldest beyond SnapshotRetain. Nothing is
+// decoded or captured for this; it only writes out a frame that's already in memory.
+func (c *Camera) snapshotLoop(videoDir string) {
+	snapDir := filepath.Join(videoDir, SnapshotDirName)
+	if err := os.MkdirAll(snapDir, 0755); err != nil {
+		c.logger.Warnf("Camera '%s': Snapshots disabled, can't create %s: %v", c.camConfig.Name, snapDir, err)
+		return
+	}
+
+	retain := c.camConfig.SnapshotRetain
+	if retain <= 0 {
+		retain = DefaultSnapshotRetain
+	}
+
+	ticker := time.NewTicker(time.Duration(c.camConfig.SnapshotIntervalS) * time.Second)
+	defer ticker.Stop()
+
+	var last []byte
+	for {
+		select {
+		case <-c.done:
+			return
+		case now := <-ticker.C:
+			if c.isPaused() || c.streamManager == nil {
+				continue
+			}
+			// A frame that hasn't changed means the camera has stalled; don't save duplicates
+			frame := c.streamManager.GetLatestFrame()
+			if len(frame) == 0 || bytes.Equal(frame, last) {
+				continue
+			}
+			last = frame
+
+			path := filepath.Join(snapDir, SnapshotFilename(c.camConfig.ID, now))
+			if err := os.WriteFile(path, frame, 0644); err != nil {
+				c.logger.Warnf("Camera '%s': Failed to save snapshot: %v", c.camConfig.Name, err)
+				continue
+			}
+			pruneSnapshots(snapDir, retain)
+		}
+	}
+}
+
+// pruneSnapshots deletes the oldest snapshots in dir so at most keep remain.
+// Timestamped names sort chronologically.
+func pruneSnapshots(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), "snapshot_") && strings.HasSuffix(e.Name(), ".jpg") {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) <= keep {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-keep] {
+		os.Remove(filepath.Join(dir, name))
+	}
+}
@@ -1,9 +1,11 @@
 package camera
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 )
 
 // StreamManager handles HTTP streaming of video to clients
@@ -13,12 +15,20 @@ type StreamManager struct {
 	stopOnce    sync.Once
 	mu          sync.RWMutex
 	latestFrame []byte
+	latestAt    time.Time // when latestFrame was extracted from the recording
+
+	// Optional pre-record ring (see EnablePreBuffer), and the event clips and
+	// pipe commands (see PipeFrames) new frames are handed to
+	preBufferWindow time.Duration
+	preBuffer       []bufferedFrame
+	frameSinks      map[chan []byte]struct{}
 }
 
 func NewStreamManager(logger Logger) *StreamManager {
 	return &StreamManager{
-		logger: logger,
-		done:   make(chan struct{}),
+		logger:     logger,
+		done:       make(chan struct{}),
+		frameSinks: make(map[chan []byte]struct{}),
 	}
 }
 
@@ -39,8 +49,14 @@ func (sm *StreamManager) UpdateFrame(frameData []byte) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	if len(frameData) > 0 {
+		// The frame poller re-reads the same frame until the segment grows
+		if bytes.Equal(frameData, sm.latestFrame) {
+			return
+		}
 		sm.latestFrame = make([]byte, len(frameData))
 		copy(sm.latestFrame, frameData)
+		sm.latestAt = time.Now()
+		sm.bufferFrame(sm.latestFrame)
 	}
 }
 
@@ -62,14 +78,22 @@ func (sm *StreamManager) ServeJPEG(w http.ResponseWriter, r *http.Request) {
 
 // GetLatestFrame returns the latest JPEG frame
 func (sm *StreamManager) GetLatestFrame() []byte {
+	frame, _ := sm.GetLatestFrameWithTime()
+	return frame
+}
+
+// GetLatestFrameWithTime returns the latest JPEG frame and the wall-clock time it
+// was extracted from the recording. A capture time that stops advancing means
+// the feed is frozen even though the same frame is still served.
+func (sm *StreamManager) GetLatestFrameWithTime() ([]byte, time.Time) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
 	if len(sm.latestFrame) == 0 {
-		return nil
+		return nil, time.Time{}
 	}
 
 	frame := make([]byte, len(sm.latestFrame))
 	copy(frame, sm.latestFrame)
-	return frame
+	return frame, sm.latestAt
 }
@@ -0,0 +1,32 @@
+package camera
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TestDevicePrefix marks a camera Device as a synthetic ffmpeg lavfi source
+// instead of real hardware, so the whole record -> segment -> extract -> stream
+// -> export pipeline can run in CI or on a dev machine without a camera.
+//
+//	"test:"         moving testsrc2 pattern (default)
+//	"test:testsrc2" same as above
+//	"test:color"    solid gray; smallest frames
+const TestDevicePrefix = "test:"
+
+// IsTestDevice reports whether device selects the synthetic test source
+func IsTestDevice(device string) bool {
+	return strings.HasPrefix(device, TestDevicePrefix)
+}
+
+// testSourceInput returns the lavfi graph for a test device at the configured
+// resolution and frame rate
+func testSourceInput(config CameraConfig) string {
+	size := fmt.Sprintf("%dx%d", config.ResWidth, config.ResHeight)
+	switch strings.TrimPrefix(config.Device, TestDevicePrefix) {
+	case "color":
+		return fmt.Sprintf("color=c=gray:size=%s:rate=%d", size, config.FPS)
+	default:
+		return fmt.Sprintf("testsrc2=size=%s:rate=%d", size, config.FPS)
+	}
+}
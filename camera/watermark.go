@@ -0,0 +1,65 @@
+package camera
+
+import (
+	"fmt"
+	"os"
+)
+
+// Watermark corners, as watermark_position values
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right" // default: the timestamp and label sit along the top
+
+	watermarkMargin = 10 // pixels between the watermark and the frame edges
+)
+
+// ValidWatermarkPosition reports whether position is a watermark corner or
+// empty (the default)
+func ValidWatermarkPosition(position string) bool {
+	switch position {
+	case "", WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight:
+		return true
+	}
+	return false
+}
+
+// WatermarkOverlay returns the overlay filter that places the second input (the
+// watermark image) in the given corner of the first. The image is read once,
+// and overlay repeats its only frame for as long as the video runs.
+func WatermarkOverlay(position string) string {
+	x, y := "W-w-%d", "H-h-%d"
+	switch position {
+	case WatermarkTopLeft:
+		x, y = "%d", "%d"
+	case WatermarkTopRight:
+		y = "%d"
+	case WatermarkBottomLeft:
+		x = "%d"
+	}
+	return fmt.Sprintf("overlay=x="+x+":y="+y, watermarkMargin, watermarkMargin)
+}
+
+// recordConfig returns the settings the next segment records with: camConfig,
+// minus the watermark while its file is missing (e.g. on a drive that isn't
+// mounted yet), since ffmpeg would fail every segment on it
+func (c *Camera) recordConfig() CameraConfig {
+	config := c.camConfig
+	if config.WatermarkFile == "" {
+		return config
+	}
+	if _, err := os.Stat(config.WatermarkFile); err != nil {
+		if !c.watermarkMissing {
+			c.logger.Warnf("Camera '%s': Watermark unavailable, recording without it: %v", config.Name, err)
+			c.watermarkMissing = true
+		}
+		config.WatermarkFile = ""
+		return config
+	}
+	if c.watermarkMissing {
+		c.logger.Printf("Camera '%s': Watermark %s found, recording with it again", config.Name, config.WatermarkFile)
+		c.watermarkMissing = false
+	}
+	return config
+}
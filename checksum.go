@@ -0,0 +1,81 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileSHA256 returns the hex SHA-256 of the file at path
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// digestHeader formats a hex SHA-256 as an RFC 3230 Digest header value
+func digestHeader(hexSum string) string {
+	raw, err := hex.DecodeString(hexSum)
+	if err != nil {
+		return ""
+	}
+	return "sha-256=" + base64.StdEncoding.EncodeToString(raw)
+}
+
+// checksumCache remembers segment hashes so repeated checksum requests don't
+// re-read the file; an entry is reused only while size and modtime are unchanged
+type checksumCache struct {
+	mu      sync.Mutex
+	entries map[string]checksumEntry // file path -> last computed hash
+}
+
+type checksumEntry struct {
+	modTime time.Time
+	size    int64
+	sum     string
+}
+
+func newChecksumCache() *checksumCache {
+	return &checksumCache{entries: make(map[string]checksumEntry)}
+}
+
+// sum returns the SHA-256 of path, computing it only if the file changed since
+// the cached hash. Entries for files that no longer exist are dropped.
+func (cc *checksumCache) sum(path string) (string, os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		cc.mu.Lock()
+		delete(cc.entries, path)
+		cc.mu.Unlock()
+		return "", nil, err
+	}
+
+	cc.mu.Lock()
+	entry, ok := cc.entries[path]
+	cc.mu.Unlock()
+	if ok && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.sum, info, nil
+	}
+
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cc.mu.Lock()
+	cc.entries[path] = checksumEntry{modTime: info.ModTime(), size: info.Size(), sum: sum}
+	cc.mu.Unlock()
+	return sum, info, nil
+}
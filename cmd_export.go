@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"dash-of-pi/camera"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// runExportCommand implements `dash-of-pi export`: it exports footage straight
+// from the video directory to a file, without the HTTP server or the cameras,
+// e.g. from a script on a stopped device. It returns the exit code.
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to config file (default: XDG config directory)")
+	startStr := fs.String("start", "", "Start of the range: RFC 3339 (2024-05-01T08:00:00Z) or a local date (2024-05-01)")
+	endStr := fs.String("end", "", "End of the range, in the same forms as -start (a date means the end of that day)")
+	out := fs.String("out", "", "File to write; a .gif extension exports a GIF, anything else an MP4")
+	cameraID := fs.String("camera", "", "Only export this camera ID (default: all cameras)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *startStr == "" || *endStr == "" || *out == "" {
+		fmt.Fprintln(os.Stderr, "export: -start, -end and -out are required")
+		fs.Usage()
+		return 2
+	}
+
+	startTime, err := parseExportTime(*startStr, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: invalid -start: %v\n", err)
+		return 2
+	}
+	endTime, err := parseExportTime(*endStr, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: invalid -end: %v\n", err)
+		return 2
+	}
+	if !endTime.After(startTime) {
+		fmt.Fprintln(os.Stderr, "export: -end must be after -start")
+		return 2
+	}
+
+	if *configPath == "" {
+		*configPath = defaultConfigPath()
+	}
+	// Unlike the server, don't create a config: an export needs the real one
+	if _, err := os.Stat(*configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "export: can't read config: %v\n", err)
+		return 1
+	}
+	config, err := LoadOrCreateConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: failed to load config: %v\n", err)
+		return 1
+	}
+
+	logger := NewLogger(LevelInfo)
+	if level, err := ParseLogLevel(config.LogLevel); err == nil {
+		logger.SetLevel(level)
+	}
+
+	format := ExportFormatMP4
+	if strings.EqualFold(filepath.Ext(*out), ".gif") {
+		format = ExportFormatGIF
+		if endTime.Sub(startTime) > time.Duration(config.GIFMaxSeconds)*time.Second {
+			fmt.Fprintf(os.Stderr, "export: GIF exports are limited to %d seconds (gif_max_seconds)\n", config.GIFMaxSeconds)
+			return 2
+		}
+	}
+
+	// Staged where the server stages exports, under a name the server's resume
+	// and stale-dir cleanup leave alone
+	tempRoot := config.ExportTempDir
+	if tempRoot == "" {
+		tempRoot = config.VideoDir
+	}
+	tempDir, err := os.MkdirTemp(tempRoot, ".cli_export_")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: failed to create temp directory: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Ctrl-C kills ffmpeg and returns here, so the temp dir is still removed
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	e := &exporter{config: config, logger: logger, runner: camera.ExecRunner{}}
+	opts := ExportOptions{
+		Start:    startTime,
+		End:      endTime,
+		Format:   format,
+		CameraID: *cameraID,
+		TempDir:  tempDir,
+	}
+	// Print each new progress message, as the dashboard would show it
+	var last ExportProgress
+	outputFile, err := e.GenerateExport(ctx, opts, func(p ExportProgress) {
+		if p.Message != last.Message {
+			logger.Printf("%s", p.Message)
+		}
+		last = p
+	})
+	if errors.Is(err, errNoExportSegments) {
+		fmt.Fprintln(os.Stderr, "export: no videos found in the specified date range")
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	info, err := os.Stat(outputFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return 1
+	}
+	if err := moveFile(outputFile, *out); err != nil {
+		fmt.Fprintf(os.Stderr, "export: failed to write %s: %v\n", *out, err)
+		return 1
+	}
+	logger.Printf("Wrote %s: %.2f MB from %d segments", *out, float64(info.Size())/BytesPerMB, last.TotalSegments)
+	return 0
+}
+
+// parseExportTime accepts RFC 3339 or a date in local time; a date is the start
+// of that day, or with endOfDay the start of the next
+func parseExportTime(s string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither RFC 3339 nor YYYY-MM-DD", s)
+	}
+	if endOfDay {
+		return day.AddDate(0, 0, 1), nil
+	}
+	return day, nil
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"dash-of-pi/camera"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/adrg/xdg"
 )
@@ -13,23 +16,180 @@ type CameraConfig struct {
 	ID             string `json:"id"`
 	Name           string `json:"name"`
 	Device         string `json:"device"`
-	Rotation       int    `json:"rotation"` // 0, 90, 180, 270 degrees
+	Rotation       int    `json:"rotation"`        // 0, 90, 180, 270 degrees
+	FlipHorizontal bool   `json:"flip_horizontal"` // mirror left-right (typical for rear-view cameras)
+	FlipVertical   bool   `json:"flip_vertical"`
 	ResWidth       int    `json:"res_width"`
 	ResHeight      int    `json:"res_height"`
 	Bitrate        int    `json:"bitrate"` // kbps
 	FPS            int    `json:"fps"`
 	MJPEGQuality   int    `json:"mjpeg_quality"`   // 2-31, lower = higher quality
 	EmbedTimestamp bool   `json:"embed_timestamp"` // USB cameras only
+	LabelOverlay   bool   `json:"label_overlay"`   // draw Name top-right; USB cameras only
 	Enabled        bool   `json:"enabled"`
+
+	// Newest segments storage cleanup never deletes, even if that means exceeding the cap
+	MinRetainSegments int `json:"min_retain_segments"`
+
+	// Save the live frame to <camera>/snapshots every SnapshotIntervalS seconds (0 = off),
+	// keeping the newest SnapshotRetain (0 = 1440)
+	SnapshotIntervalS int `json:"snapshot_interval_s"`
+	SnapshotRetain    int `json:"snapshot_retain"`
+
+	// KB read from the end of the newest segment for the live frame (0 = 256); grows
+	// automatically when a frame doesn't fit, so low-res cameras can go much lower
+	FrameWindowKB int `json:"frame_window_kb"`
+
+	// Also record a copy scaled by this factor (e.g. 0.25) from the same ffmpeg
+	// process and serve the live frame from it; 0 = off. USB cameras only
+	PreviewScale float64 `json:"preview_scale"`
+
+	// Record the preview without the timestamp, label and watermark, so the live
+	// view is clean while segments keep them; implies a preview. USB cameras only
+	PreviewNoOverlay bool `json:"preview_no_overlay"`
+
+	// Record to this directory instead of <video_dir>/<id>, e.g. a faster disk
+	// than the other cameras use; empty = the default
+	VideoDir string `json:"video_dir,omitempty"`
+
+	// Image (e.g. a PNG logo) overlaid on every recorded frame, in the
+	// WatermarkPosition corner (default bottom-right). USB cameras only
+	WatermarkFile     string `json:"watermark_file,omitempty"`
+	WatermarkPosition string `json:"watermark_position,omitempty"`
+
+	// Overrides the global continuous_recording for this camera, e.g. false for
+	// one that misbehaves with the segment muxer; unset = follow it
+	ContinuousRecording *bool `json:"continuous_recording,omitempty"`
+
+	// Shell command the recording is piped to as MJPEG on stdin, e.g. an RTSP
+	// restreamer; restarted when it exits. CSI cameras pipe the live frames
+	// instead, at most 10 per second. Config file only, not the API
+	PipeCommand string `json:"pipe_command,omitempty"`
 }
 
 type Config struct {
-	Port           int            `json:"port"`
-	VideoDir       string         `json:"video_dir"`
-	StorageCapGB   int            `json:"storage_cap_gb"`
-	AuthToken      string         `json:"auth_token"`
-	SegmentLengthS int            `json:"segment_length_s"` // seconds
-	Cameras        []CameraConfig `json:"cameras"`          // Multiple camera configurations
+	Port                  int            `json:"port"`
+	VideoDir              string         `json:"video_dir"`
+	StorageCapGB          int            `json:"storage_cap_gb"`
+	FullDiskPolicy        string         `json:"full_disk_policy"`         // "overwrite" (default) or "stop"
+	StorageCheckIntervalS int            `json:"storage_check_interval_s"` // seconds between storage cap checks
+	AuthToken             string         `json:"auth_token"`
+	BasicAuthUser         string         `json:"basic_auth_user"`  // username for HTTP Basic auth (password = auth_token); empty = any
+	PublicStream          bool           `json:"public_stream"`    // serve /api/stream/frame, /mjpeg and /montage without auth
+	SegmentLengthS        int            `json:"segment_length_s"` // seconds
+	GIFMaxSeconds         int            `json:"gif_max_seconds"`  // longest range accepted for format=gif exports
+	MJPEGBoundary         string         `json:"mjpeg_boundary"`   // multipart boundary for /api/stream/mjpeg
+	SelfTestOnBoot        bool           `json:"selftest_on_boot"` // capture one frame per camera before recording starts
+	LogLevel              string         `json:"log_level"`        // "error", "warn", "info" (default) or "debug"
+	Cameras               []CameraConfig `json:"cameras"`          // Multiple camera configurations
+
+	// Minimum gap between /api/stream/frame polls per client; -1 disables the limit
+	StreamFrameMinIntervalMS int `json:"stream_frame_min_interval_ms"`
+
+	// What ends a segment: "time" (segment_length_s, the default), "size"
+	// (segment_max_bytes) or "both", whichever is reached first
+	SegmentMode     string `json:"segment_mode"`
+	SegmentMaxBytes int64  `json:"segment_max_bytes"`
+
+	// Record each camera with one ffmpeg whose segment muxer starts every
+	// segment, so nothing is lost between them; time segment mode, USB cameras only
+	ContinuousRecording bool `json:"continuous_recording"`
+
+	// "flat" (default): segments directly in <video_dir>/<camera>/; "daily": in
+	// <video_dir>/<camera>/YYYY-MM-DD/, removed once cleanup empties them
+	StorageLayout string `json:"storage_layout"`
+
+	// H.264 encoder: "auto" (default) probes for the best one; a name such as
+	// "libx264" forces it, as long as `ffmpeg -encoders` lists it
+	Encoder string `json:"encoder"`
+
+	// Where exports stage their working files; empty keeps them in video_dir
+	ExportTempDir string `json:"export_temp_dir"`
+
+	// Optional copy of the log in a file, rotated at LogMaxSizeMB keeping
+	// LogMaxBackups old files no older than LogMaxAgeDays (0 = no age limit)
+	LogFile       string `json:"log_file"`
+	LogMaxSizeMB  int    `json:"log_max_size_mb"`
+	LogMaxBackups int    `json:"log_max_backups"`
+	LogMaxAgeDays int    `json:"log_max_age_days"`
+
+	// Pixel format MP4 exports are re-encoded to for players that show
+	// full-range MJPEG with wrong colors (default yuv420p); "copy" copies the
+	// frames unchanged
+	ExportPixFmt string `json:"export_pix_fmt"`
+
+	// ffmpeg threads for exports (decode and, for GIF/export_pix_fmt, encode);
+	// 0 = one fewer than the CPU count, leaving a core for recording
+	ExportThreads int `json:"export_threads"`
+
+	// Image overlaid on exports in the ExportWatermarkPosition corner (default
+	// bottom-right); MP4 exports are then re-encoded like with export_pix_fmt
+	ExportWatermarkFile     string `json:"export_watermark_file"`
+	ExportWatermarkPosition string `json:"export_watermark_position"`
+
+	// Mux a silent AAC track into MP4 exports for editors that reject video-only files
+	ExportSilentAudio bool `json:"export_silent_audio"`
+
+	// Finished exports older than this are deleted by the storage cleanup loop (0 = keep)
+	ExportTTLHours int `json:"export_ttl_hours"`
+
+	// Deliver finished exports: PUT to an S3-compatible bucket and/or POST to
+	// UploadURL, after every export with AutoUpload or on /api/videos/upload-export
+	AutoUpload       bool   `json:"auto_upload"`
+	UploadURL        string `json:"upload_url"`
+	UploadAuthHeader string `json:"upload_auth_header"` // sent as Authorization to upload_url
+	S3Endpoint       string `json:"s3_endpoint"`        // e.g. "https://s3.eu-west-1.amazonaws.com"
+	S3Bucket         string `json:"s3_bucket"`
+	S3Region         string `json:"s3_region"` // default "us-east-1"
+	S3AccessKey      string `json:"s3_access_key"`
+	S3SecretKey      string `json:"s3_secret_key"`
+	S3Prefix         string `json:"s3_prefix"` // prepended to the object name, e.g. "dashcam/"
+
+	// Exports generated automatically every day, e.g. the previous day each morning
+	ScheduledExports []ScheduledExport `json:"scheduled_exports"`
+
+	// HTTP server limits (0 = the built-in default); raise the header limit for
+	// proxies that add large headers, or lower everything for hardening
+	HTTPMaxHeaderBytes     int `json:"http_max_header_bytes"`
+	HTTPReadTimeoutS       int `json:"http_read_timeout_s"`
+	HTTPReadHeaderTimeoutS int `json:"http_read_header_timeout_s"`
+	HTTPIdleTimeoutS       int `json:"http_idle_timeout_s"`
+
+	// Niceness (-20..19) and taskset CPU list (e.g. "0-2") for the recording
+	// ffmpeg/rpicam-vid and for export/remux ffmpeg. record_nice 0 leaves
+	// recording unchanged; export_nice 0 means the default of 19
+	RecordNice int    `json:"record_nice"`
+	RecordCPUs string `json:"record_cpus"`
+	ExportNice int    `json:"export_nice"`
+	ExportCPUs string `json:"export_cpus"`
+
+	// /api/stream/montage: JPEG quality (1-100, default 75) and cell width
+	// (default 640; cells are 16:9)
+	MontageQuality   int `json:"montage_quality"`
+	MontageCellWidth int `json:"montage_cell_width"`
+
+	// Skip cameras whose device is absent when recording starts (boot or restart)
+	// instead of letting them fail every segment
+	AutoDisableMissing bool `json:"auto_disable_missing"`
+
+	// Poll every HotplugPollS seconds for camera devices appearing (start
+	// recording) or disappearing (stop it); 0 = off
+	HotplugPollS int `json:"hotplug_poll_s"`
+
+	// Seconds a stopping camera (shutdown or restart) gets to close its current
+	// segment cleanly before its recorder is killed (0 = 5); -1 kills it at once
+	ShutdownGraceS int `json:"shutdown_grace_s"`
+
+	// Times a camera tries to open its device, 2s apart, before it's reported
+	// as failed (default 3; 1 reports the first failure)
+	CameraOpenAttempts int `json:"camera_open_attempts"`
+
+	// Largest JSON request body accepted by the API (0 = 1MB); larger get 413
+	MaxRequestBodyBytes int64 `json:"max_request_body_bytes"`
+
+	// Event clips: seconds of frames kept in RAM per camera (0 = off) and recorded after a mark
+	PreBufferSeconds int `json:"pre_buffer_seconds"`
+	PostEventSeconds int `json:"post_event_seconds"`
 }
 
 func DefaultConfig() *Config {
@@ -52,10 +212,36 @@ func DefaultConfig() *Config {
 	}
 
 	return &Config{
-		Port:           DefaultPort,
-		VideoDir:       videoDir,
-		StorageCapGB:   DefaultStorageCapGB,
-		SegmentLengthS: DefaultSegmentLengthS,
+		Port:                  DefaultPort,
+		VideoDir:              videoDir,
+		StorageCapGB:          DefaultStorageCapGB,
+		FullDiskPolicy:        FullDiskPolicyOverwrite,
+		StorageCheckIntervalS: DefaultStorageCheckIntervalS,
+		SegmentLengthS:        DefaultSegmentLengthS,
+		SegmentMode:           camera.SegmentModeTime,
+		StorageLayout:         camera.StorageLayoutFlat,
+		Encoder:               camera.EncoderAuto,
+		ShutdownGraceS:        DefaultShutdownGraceS,
+		CameraOpenAttempts:    camera.DefaultOpenAttempts,
+		GIFMaxSeconds:         DefaultGIFMaxSeconds,
+		MJPEGBoundary:         DefaultMJPEGBoundary,
+		LogLevel:              DefaultLogLevel,
+		LogMaxSizeMB:          DefaultLogMaxSizeMB,
+		LogMaxBackups:         DefaultLogMaxBackups,
+
+		HTTPMaxHeaderBytes:     HTTPMaxHeaderBytes,
+		HTTPReadTimeoutS:       int(ServerReadTimeout / time.Second),
+		HTTPReadHeaderTimeoutS: int(ServerReadHeaderTimeout / time.Second),
+		HTTPIdleTimeoutS:       int(ServerIdleTimeout / time.Second),
+		MaxRequestBodyBytes:    DefaultMaxRequestBodyBytes,
+		ExportNice:             DefaultExportNice,
+		ExportPixFmt:           DefaultExportPixFmt,
+		MontageQuality:         DefaultMontageQuality,
+		MontageCellWidth:       DefaultMontageCellWidth,
+
+		StreamFrameMinIntervalMS: DefaultStreamFrameMinIntervalMS,
+		PostEventSeconds:         DefaultPostEventSeconds,
+
 		Cameras: []CameraConfig{
 			{
 				ID:             "default",
@@ -87,7 +273,137 @@ func LoadOrCreateConfig(configPath string) (*Config, error) {
 			return nil, fmt.Errorf("failed to parse config: %w", err)
 		}
 
+		if config.StorageCheckIntervalS == 0 {
+			config.StorageCheckIntervalS = DefaultStorageCheckIntervalS
+		} else if config.StorageCheckIntervalS < MinStorageCheckIntervalS {
+			config.StorageCheckIntervalS = MinStorageCheckIntervalS
+		}
+		if config.FullDiskPolicy != FullDiskPolicyStop {
+			config.FullDiskPolicy = FullDiskPolicyOverwrite
+		}
+		if config.Encoder == "" {
+			config.Encoder = camera.EncoderAuto
+		} else if !isValidPixFmt(config.Encoder) {
+			// Encoder names follow the same rules as pixel format names
+			fmt.Printf("Ignoring invalid encoder %q\n", config.Encoder)
+			config.Encoder = camera.EncoderAuto
+		}
+		if config.StorageLayout != camera.StorageLayoutDaily {
+			config.StorageLayout = camera.StorageLayoutFlat
+		}
+		if config.GIFMaxSeconds == 0 {
+			config.GIFMaxSeconds = DefaultGIFMaxSeconds
+		}
+		if config.StreamFrameMinIntervalMS == 0 {
+			config.StreamFrameMinIntervalMS = DefaultStreamFrameMinIntervalMS
+		}
+		if config.ExportPixFmt == "" {
+			config.ExportPixFmt = DefaultExportPixFmt
+		} else if !isValidPixFmt(config.ExportPixFmt) {
+			fmt.Printf("Ignoring invalid export_pix_fmt %q\n", config.ExportPixFmt)
+			config.ExportPixFmt = DefaultExportPixFmt
+		}
+		if !camera.ValidWatermarkPosition(config.ExportWatermarkPosition) {
+			fmt.Printf("Ignoring invalid export_watermark_position %q\n", config.ExportWatermarkPosition)
+			config.ExportWatermarkPosition = ""
+		}
+		if config.ExportWatermarkFile != "" {
+			warnMissingWatermark(config.ExportWatermarkFile)
+		}
+		if config.ExportThreads < 0 {
+			config.ExportThreads = 0
+		}
+		if config.ExportTTLHours < 0 {
+			config.ExportTTLHours = 0
+		}
+		if config.UploadURL != "" && !validUploadEndpoint(config.UploadURL) {
+			fmt.Printf("Ignoring invalid upload_url %q (expected an http or https URL)\n", config.UploadURL)
+			config.UploadURL = ""
+		}
+		scheduled := config.ScheduledExports[:0]
+		for _, se := range config.ScheduledExports {
+			if err := se.validate(config.GIFMaxSeconds); err != nil {
+				fmt.Printf("Ignoring scheduled export at %q: %v\n", se.At, err)
+				continue
+			}
+			scheduled = append(scheduled, se)
+		}
+		config.ScheduledExports = scheduled
+		if config.S3Bucket != "" {
+			if !validUploadEndpoint(config.S3Endpoint) || config.S3AccessKey == "" || config.S3SecretKey == "" {
+				fmt.Printf("Ignoring s3_bucket: s3_endpoint (an http or https URL), s3_access_key and s3_secret_key are required\n")
+				config.S3Bucket = ""
+			}
+			if config.S3Region == "" {
+				config.S3Region = DefaultS3Region
+			}
+		}
+		if config.PreBufferSeconds < 0 {
+			config.PreBufferSeconds = 0
+		}
+		if config.PostEventSeconds <= 0 {
+			config.PostEventSeconds = DefaultPostEventSeconds
+		}
+		if config.LogMaxSizeMB <= 0 {
+			config.LogMaxSizeMB = DefaultLogMaxSizeMB
+		}
+		if config.LogMaxBackups < 0 {
+			config.LogMaxBackups = 0
+		} else if config.LogMaxBackups == 0 {
+			config.LogMaxBackups = DefaultLogMaxBackups
+		}
+		if config.LogMaxAgeDays < 0 {
+			config.LogMaxAgeDays = 0
+		}
+		if _, err := ParseLogLevel(config.LogLevel); err != nil {
+			config.LogLevel = DefaultLogLevel
+		}
+		applyHTTPLimitDefault(&config.HTTPMaxHeaderBytes, HTTPMaxHeaderBytes, "http_max_header_bytes")
+		applyHTTPLimitDefault(&config.HTTPReadTimeoutS, int(ServerReadTimeout/time.Second), "http_read_timeout_s")
+		applyHTTPLimitDefault(&config.HTTPReadHeaderTimeoutS, int(ServerReadHeaderTimeout/time.Second), "http_read_header_timeout_s")
+		applyHTTPLimitDefault(&config.HTTPIdleTimeoutS, int(ServerIdleTimeout/time.Second), "http_idle_timeout_s")
+		if config.RecordNice < -20 || config.RecordNice > 19 {
+			fmt.Printf("Ignoring out-of-range record_nice %d\n", config.RecordNice)
+			config.RecordNice = 0
+		}
+		if config.ExportNice == 0 || config.ExportNice < -20 || config.ExportNice > 19 {
+			config.ExportNice = DefaultExportNice
+		}
+		if config.RecordCPUs != "" && !camera.ValidCPUList(config.RecordCPUs) {
+			fmt.Printf("Ignoring invalid record_cpus %q\n", config.RecordCPUs)
+			config.RecordCPUs = ""
+		}
+		if config.ExportCPUs != "" && !camera.ValidCPUList(config.ExportCPUs) {
+			fmt.Printf("Ignoring invalid export_cpus %q\n", config.ExportCPUs)
+			config.ExportCPUs = ""
+		}
+		if config.MontageQuality <= 0 || config.MontageQuality > 100 {
+			config.MontageQuality = DefaultMontageQuality
+		}
+		if config.MontageCellWidth < 16 || config.MontageCellWidth > MontageMaxCellSize {
+			config.MontageCellWidth = DefaultMontageCellWidth
+		}
+		if config.HotplugPollS < 0 {
+			config.HotplugPollS = 0
+		}
+		if config.CameraOpenAttempts <= 0 {
+			config.CameraOpenAttempts = camera.DefaultOpenAttempts
+		}
+		if config.ShutdownGraceS == 0 {
+			config.ShutdownGraceS = DefaultShutdownGraceS
+		} else if config.ShutdownGraceS < -1 {
+			fmt.Printf("Ignoring invalid shutdown_grace_s %d\n", config.ShutdownGraceS)
+			config.ShutdownGraceS = DefaultShutdownGraceS
+		}
+		if config.MaxRequestBodyBytes <= 0 {
+			config.MaxRequestBodyBytes = DefaultMaxRequestBodyBytes
+		}
+		if !isValidMultipartBoundary(config.MJPEGBoundary) {
+			config.MJPEGBoundary = DefaultMJPEGBoundary
+		}
+
 		// Ensure camera configs have defaults
+		usedDirs := make(map[string]bool) // video_dir overrides, which cameras can't share
 		for i := range config.Cameras {
 			cam := &config.Cameras[i]
 			if cam.ID == "" {
@@ -108,6 +424,32 @@ func LoadOrCreateConfig(configPath string) (*Config, error) {
 			if cam.MJPEGQuality == 0 {
 				cam.MJPEGQuality = DefaultMJPEGQuality
 			}
+			if cam.MinRetainSegments < 0 {
+				cam.MinRetainSegments = 0
+			}
+			if cam.SnapshotIntervalS < 0 {
+				cam.SnapshotIntervalS = 0
+			}
+			if cam.FrameWindowKB < 0 {
+				cam.FrameWindowKB = 0
+			}
+			if cam.PreviewScale < 0 || cam.PreviewScale >= 1 {
+				cam.PreviewScale = 0
+			}
+			if cam.VideoDir != "" {
+				dir, err := cleanCameraVideoDir(cam.VideoDir, config.VideoDir, usedDirs)
+				if err != nil {
+					fmt.Printf("Ignoring %v for camera %s, using the default\n", err, cam.ID)
+				}
+				cam.VideoDir = dir
+			}
+			if !camera.ValidWatermarkPosition(cam.WatermarkPosition) {
+				fmt.Printf("Ignoring invalid watermark_position %q for camera %s\n", cam.WatermarkPosition, cam.ID)
+				cam.WatermarkPosition = ""
+			}
+			if cam.WatermarkFile != "" {
+				warnMissingWatermark(cam.WatermarkFile)
+			}
 		}
 
 		return config, nil
@@ -154,9 +496,106 @@ func SaveConfig(config *Config, configPath string) error {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0600); err != nil {
+	// Write then move into place so a power cut can't leave a truncated config
+	tmpPath := configPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := moveFile(tmpPath, configPath); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
 	return nil
 }
+
+// applyHTTPLimitDefault fills in an unset HTTP server limit and replaces a
+// negative one, which net/http would otherwise treat as "no limit"
+func applyHTTPLimitDefault(v *int, def int, name string) {
+	if *v < 0 {
+		fmt.Printf("Ignoring negative %s %d\n", name, *v)
+		*v = def
+	} else if *v == 0 {
+		*v = def
+	}
+}
+
+// isValidMultipartBoundary reports whether b is usable as a multipart boundary.
+// RFC 2046 allows more characters, but those would need quoting in the
+// Content-Type header, so only letters, digits, '-', '_' and '.' are accepted.
+func isValidMultipartBoundary(b string) bool {
+	if len(b) == 0 || len(b) > 70 {
+		return false
+	}
+	for _, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("-_.", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// exportPixFmt returns the pixel format MP4 exports are re-encoded to, or ""
+// to copy the frames unchanged
+func (c *Config) exportPixFmt() string {
+	if c.ExportPixFmt == ExportPixFmtCopy {
+		return ""
+	}
+	return c.ExportPixFmt
+}
+
+// isValidPixFmt reports whether p looks like an ffmpeg pixel format name
+// (yuv420p, nv12, ...), so a config value can't smuggle in extra arguments
+func isValidPixFmt(p string) bool {
+	if len(p) > 32 {
+		return false
+	}
+	for _, c := range p {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanCameraVideoDir returns a camera's video_dir override cleaned, or "" and
+// an error if it isn't an absolute path of its own: not the main videoDir and
+// not in used, the overrides of the cameras before it (which it's then added to).
+func cleanCameraVideoDir(dir, videoDir string, used map[string]bool) (string, error) {
+	clean := filepath.Clean(dir)
+	if !filepath.IsAbs(clean) || clean == filepath.Clean(videoDir) || used[clean] {
+		return "", fmt.Errorf("invalid video_dir %q (must be an absolute path of its own)", dir)
+	}
+	used[clean] = true
+	return clean, nil
+}
+
+// validateCameraVideoDirs cleans the video_dir overrides of cameras, a full
+// camera list, and returns an error naming the first camera whose override
+// cleanCameraVideoDir rejects
+func validateCameraVideoDirs(cameras []CameraConfig, videoDir string) error {
+	used := make(map[string]bool)
+	for i := range cameras {
+		if cameras[i].VideoDir == "" {
+			continue
+		}
+		dir, err := cleanCameraVideoDir(cameras[i].VideoDir, videoDir, used)
+		if err != nil {
+			return fmt.Errorf("camera %s: %w", cameras[i].ID, err)
+		}
+		cameras[i].VideoDir = dir
+	}
+	return nil
+}
+
+// warnMissingWatermark flags a watermark file that doesn't exist yet. It's kept
+// in the config, since it may be on a drive mounted later; until then recording
+// and exports go ahead without it.
+func warnMissingWatermark(path string) {
+	if _, err := os.Stat(path); err != nil {
+		fmt.Printf("Warning: watermark %q not found; recording and exports skip it until it exists\n", path)
+	}
+}
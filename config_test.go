@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigExportPixFmt(t *testing.T) {
+	tests := []struct {
+		json string
+		want string // exportPixFmt()
+	}{
+		{json: `{}`, want: DefaultExportPixFmt},
+		{json: `{"export_pix_fmt": ""}`, want: DefaultExportPixFmt},
+		{json: `{"export_pix_fmt": "copy"}`, want: ""},
+		{json: `{"export_pix_fmt": "nv12"}`, want: "nv12"},
+		{json: `{"export_pix_fmt": "yuv420p -y"}`, want: DefaultExportPixFmt},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tt.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := LoadOrCreateConfig(path)
+		if err != nil {
+			t.Fatalf("%s: LoadOrCreateConfig: %v", tt.json, err)
+		}
+		if got := config.exportPixFmt(); got != tt.want {
+			t.Errorf("%s: exports use pixel format %q, want %q", tt.json, got, tt.want)
+		}
+	}
+}
@@ -11,6 +11,13 @@ const (
 	TargetStreamFPS       = 24 // Target FPS from camera
 	MJPEGStreamIntervalMS = 33 // Send frames every 33ms = 30 FPS stream
 
+	// /api/stream/montage: tile size, stream rate and JPEG quality. Every frame is
+	// decoded, scaled and re-encoded in Go, so keep the rate low
+	DefaultMontageCellWidth = 640 // cells are 16:9 unless ?cell= says otherwise
+	DefaultMontageQuality   = 75
+	MontageMaxCellSize      = 1920
+	MontageStreamIntervalMS = 500 // 2 FPS
+
 	// Timeouts and intervals
 	MJPEGNoFrameTimeout   = 50 // Disconnect after 50 missed frames
 	StatusUpdateIntervalS = 5  // Frontend polls server status every 5 seconds
@@ -18,23 +25,28 @@ const (
 	// Retry and reconnect
 	StreamRetryAttempts = 3     // Attempt to reconnect 3 times before giving up
 	StreamStallCheckMS  = 10000 // Check if stream stalled every 10 seconds
+
+	// Weight of the newest throughput sample in the export ETA's moving average
+	// (lower = steadier but slower to react)
+	ExportETASmoothing = 0.3
+
+	// Segments remuxed per MP4 export part; finished parts survive a restart
+	ExportChunkSegments = 30
+
+	// A camera's newest segment modified more recently than this is taken to be
+	// still recording (ffmpeg appends every frame)
+	ActiveSegmentWindow = 5 * time.Second
 )
 
 // =============================================================================
 // Buffer Sizes and Memory Limits
 // =============================================================================
 
+// The frame extraction buffer sizes (FrameBufferSizeKB and friends) live in
+// camera/frame_extraction.go, the only code that reads them.
 const (
-	// Frame extraction buffers
-	FrameBufferSizeKB = 256 // Read last 256KB from MJPEG file (typical frame: 80-150KB)
-	MaxFrameSizeKB    = 200 // Max size to search backwards for frame start (prevents old frames)
-	MinFileSize       = 100 // Skip extraction if file too small (not enough data yet)
-
-	// FFmpeg stderr capture
-	FFmpegStderrBufferKB = 4 // 4KB buffer for FFmpeg error messages
-
 	// HTTP and network
-	HTTPMaxHeaderBytes = 1 << 20 // 1MB = maximum HTTP header size (security limit)
+	HTTPMaxHeaderBytes = 1 << 20 // 1MB = default maximum HTTP header size (http_max_header_bytes)
 )
 
 // =============================================================================
@@ -43,6 +55,7 @@ const (
 
 const (
 	// Why: Protects against slow-read attacks and hung connections
+	// Defaults for http_read_timeout_s, http_idle_timeout_s and http_read_header_timeout_s
 	ServerReadTimeout       = 30 * time.Second  // 30s max to read entire request body
 	ServerIdleTimeout       = 120 * time.Second // 2min max idle before closing connection
 	ServerReadHeaderTimeout = 10 * time.Second  // 10s max to read HTTP headers
@@ -58,9 +71,6 @@ const (
 	BytesPerKB = 1024
 	BytesPerMB = 1024 * 1024
 	BytesPerGB = 1024 * 1024 * 1024
-
-	// Bitrate to storage estimation multiplier
-	BitrateToStorageMultiplier = 128 // bytes / (bitrate * 128) = seconds
 )
 
 // =============================================================================
@@ -79,6 +89,59 @@ const (
 	DefaultSegmentLengthS = 60   // seconds
 	DefaultMJPEGQuality   = 8    // 2-31 scale, lower is better, 8=good balance
 	DefaultEmbedTimestamp = true // Embed timestamp by default
+	DefaultGIFMaxSeconds  = 30   // Longest range allowed for a GIF export
+	DefaultMJPEGBoundary  = "frame"
+	DefaultLogLevel       = "info"
+
+	// Log file rotation (log_file)
+	DefaultLogMaxSizeMB  = 10 // rotate once the file reaches this size
+	DefaultLogMaxBackups = 5  // rotated files kept (app.log.1 ... app.log.5)
+
+	// Largest JSON body accepted by the config, camera and other POST endpoints (413 if larger)
+	DefaultMaxRequestBodyBytes = 1 << 20 // 1MB
+
+	// Niceness of export/remux ffmpeg (export_nice); lowest priority so recording wins
+	DefaultExportNice = 19
+
+	// MP4 exports are re-encoded to this pixel format (export_pix_fmt) so players
+	// like QuickTime show MJPEG's full-range colors correctly; ExportPixFmtCopy
+	// opts out and copies the frames unchanged
+	DefaultExportPixFmt = "yuv420p"
+	ExportPixFmtCopy    = "copy"
+
+	// Seconds a stopping camera gets to finish its segment (shutdown_grace_s)
+	DefaultShutdownGraceS = 5
+
+	// scheduled_exports: how often due entries are checked for, and how long one
+	// waits for a running export (or after a missed slot) before it's skipped
+	ScheduledExportCheckInterval = 30 * time.Second
+	ScheduledExportMaxDelay      = time.Hour
+
+	// Region S3 uploads are signed for when s3_region is unset
+	DefaultS3Region = "us-east-1"
+
+	// Event clips (/api/events/mark)
+	DefaultPostEventSeconds = 10 // seconds recorded after the mark
+
+	// Storage cap enforcement
+	DefaultStorageCheckIntervalS = 30 // seconds between storage cap checks
+	MinStorageCheckIntervalS     = 5  // floor so the cleanup loop can't spin
+
+	// Minimum gap between /api/stream/frame requests from one client (429 if faster)
+	DefaultStreamFrameMinIntervalMS = 200
+
+	// Lifetime of signed frame URLs from /api/stream/frame/sign (?ttl= overrides, up to the max)
+	DefaultSignedFrameTTLS = 3600
+	MaxSignedFrameTTLS     = 365 * 24 * 3600
+
+	// FullDiskPolicy values
+	FullDiskPolicyOverwrite = "overwrite" // delete the oldest footage to stay under the cap
+	FullDiskPolicyStop      = "stop"      // keep all footage and stop recording at the cap
+
+	// Reasons passed to CameraManager.PauseRecording
+	PauseReasonStorageFull = "storage_full" // cap reached under FullDiskPolicyStop
+	PauseReasonStopped     = "stopped"      // master switch via /api/recording/stop
+	PauseReasonMaintenance = "maintenance"  // /api/system/maintenance, e.g. before swapping the SD card
 
 	// Device defaults
 	DefaultCameraDevice = "/dev/video0"
@@ -91,6 +154,13 @@ const (
 const (
 	// MPEG-4 quality for exports (q:v scale)
 	ExportVideoQuality = 2 // 1-31 scale, lower=better quality (2=very high)
+
+	// Sample rate of the optional silent audio track (export_silent_audio)
+	ExportSilentAudioRate = 48000
+
+	// GIF exports are downscaled and decimated to keep the file shareable
+	GIFExportFPS   = 10  // frames per second in the output GIF
+	GIFExportWidth = 480 // output width in pixels (height keeps aspect ratio)
 )
 
 // =============================================================================
@@ -102,6 +172,10 @@ const (
 	FrameLogInterval  = 30  // Log frame stats every 30 frames
 	StreamLogInterval = 100 // Log stream stats every 100 frames
 
+	// Lines buffered for the log file before new ones are dropped, so a stalled
+	// SD card can't block the code that logs
+	LogFileQueueLines = 1024
+
 	// Error throttling
 	ErrorLogThrottleS = 5 // Don't log same error more than once per 5 seconds
 )
@@ -115,8 +189,13 @@ const (
 	ExtensionMP4   = ".mp4"
 	ExtensionWebM  = ".webm"
 
-	// Export filename
-	ExportFilename = "current_export.mp4"
+	// Export filenames
+	ExportFilename    = "current_export.mp4"
+	ExportGIFFilename = "current_export.gif"
+
+	// Export formats (?format= on generate-export)
+	ExportFormatMP4 = "mp4"
+	ExportFormatGIF = "gif"
 )
 
 // =============================================================================
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"dash-of-pi/camera"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// errNoExportSegments means no segment ended in the requested range
+var errNoExportSegments = errors.New("no videos found in the specified date range")
+
+// errExportInterrupted means an ffmpeg run was stopped for maintenance mode and
+// is to be redone once hold lets the export carry on
+var errExportInterrupted = errors.New("interrupted for maintenance")
+
+// ExportOptions says what GenerateExport exports and where it works
+type ExportOptions struct {
+	Start    time.Time // segments that ended in [Start, End] are exported
+	End      time.Time
+	Format   string // ExportFormatMP4 or ExportFormatGIF
+	CameraID string // "" = every camera
+	TempDir  string // parts, the checkpoint and the output go here; created if missing
+
+	Upload bool // recorded in the checkpoint, so a resumed export is still uploaded
+}
+
+// ExportProgress is how far an export has got; GenerateExport hands a copy to
+// its callback on every change
+type ExportProgress struct {
+	Message        string // e.g. "Remuxing segments 1-30 of 120..."
+	TotalSegments  int
+	ProcessedFiles int     // segments remuxed so far
+	Percent        float64 // through the final encode, from ffmpeg -progress
+	CurrentSizeMB  float64 // output written so far
+	ETASeconds     int     // 0 = unknown
+}
+
+// exporter turns recorded segments into one export file. It knows nothing of
+// HTTP: the API server runs it for generate-export and scheduled exports, and
+// the export subcommand runs it straight against the video directory.
+type exporter struct {
+	config *Config
+	logger *Logger
+	runner camera.Runner
+
+	// hold is called before each ffmpeg run, which is skipped and the export
+	// abandoned if it returns false; the server waits out maintenance mode in it
+	hold func() bool
+
+	// interrupt, if set, is called as each ffmpeg run starts and returns a
+	// channel closed when it must stop: the server's is closed when maintenance
+	// mode begins. The run's output is discarded and it's redone after hold.
+	interrupt func() <-chan struct{}
+}
+
+// exportReporter keeps an export's progress and passes it on after each change
+type exportReporter struct {
+	state ExportProgress
+	fn    func(ExportProgress) // nil = nobody's watching
+}
+
+func (r *exportReporter) update(change func(p *ExportProgress)) {
+	change(&r.state)
+	if r.fn != nil {
+		r.fn(r.state)
+	}
+}
+
+func (r *exportReporter) setMessage(msg string) {
+	r.update(func(p *ExportProgress) { p.Message = msg })
+}
+
+// proceed reports whether the next ffmpeg run may start
+func (e *exporter) proceed(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.hold != nil && !e.hold() {
+		return fmt.Errorf("server stopped")
+	}
+	return nil
+}
+
+// runContext returns the context for one ffmpeg run: ctx, also cancelled with
+// errExportInterrupted if interrupt fires first
+func (e *exporter) runContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	if e.interrupt != nil {
+		interrupt := e.interrupt()
+		go func() {
+			select {
+			case <-interrupt:
+				cancel(errExportInterrupted)
+			case <-runCtx.Done():
+			}
+		}()
+	}
+	return runCtx, func() { cancel(context.Canceled) }
+}
+
+// interrupted reports whether a run that failed with err was stopped by interrupt
+func interrupted(runCtx context.Context, err error) bool {
+	return err != nil && context.Cause(runCtx) == errExportInterrupted
+}
+
+// GenerateExport exports the segments opts selects into opts.TempDir and
+// returns the finished file's path, calling progress (if set) on every change.
+// Cancelling ctx kills ffmpeg. The caller moves the file where it belongs and
+// removes TempDir. errNoExportSegments means there was nothing to export; other
+// errors read as the reason to show the user, with ffmpeg's output logged.
+func (e *exporter) GenerateExport(ctx context.Context, opts ExportOptions, progress func(ExportProgress)) (string, error) {
+	rep := &exportReporter{fn: progress}
+	rep.setMessage("Scanning for video files...")
+
+	cp, err := e.plan(opts)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(opts.TempDir, 0755); err != nil {
+		e.logger.Errorf("Failed to create temp directory: %v", err)
+		return "", fmt.Errorf("failed to create temp directory")
+	}
+	if err := cp.save(opts.TempDir); err != nil {
+		e.logger.Warnf("Failed to write export checkpoint, this export can't be resumed: %v", err)
+	}
+	return e.encode(ctx, cp, opts.TempDir, rep)
+}
+
+// resume carries on with the export checkpointed in tempDir, as GenerateExport
+// would have
+func (e *exporter) resume(ctx context.Context, cp *exportCheckpoint, tempDir string, progress func(ExportProgress)) (string, error) {
+	return e.encode(ctx, cp, tempDir, &exportReporter{fn: progress})
+}
+
+// plan selects the segments opts asks for, in recording order
+func (e *exporter) plan(opts ExportOptions) (*exportCheckpoint, error) {
+	startTime, endTime, cameraID := opts.Start, opts.End, opts.CameraID
+	dirs, err := cameraDirs(e.config.VideoDir, cameraVideoDirs(e.config.Cameras))
+	if err != nil {
+		e.logger.Errorf("Failed to scan video directory: %v", err)
+		return nil, fmt.Errorf("failed to scan video directory")
+	}
+	mjpegFiles, err := walkCameraVideos(dirs, func(id, _ string, info os.FileInfo) bool {
+		if cameraID != "" && id != cameraID {
+			return false
+		}
+		t := info.ModTime()
+		return (t.After(startTime) || t.Equal(startTime)) && !t.After(endTime)
+	})
+	if err != nil {
+		e.logger.Errorf("Failed to scan video directory: %v", err)
+		return nil, fmt.Errorf("failed to scan video directory")
+	}
+
+	// Sort in recording order; precompute to avoid repeated os.Stat calls
+	type fileEntry struct {
+		path    string
+		modTime time.Time
+		order   segmentOrder
+	}
+	entries := make([]fileEntry, 0, len(mjpegFiles))
+	for _, video := range mjpegFiles {
+		if info, err := os.Stat(video.path); err == nil {
+			entries = append(entries, fileEntry{video.path, info.ModTime(), newSegmentOrder(video.cameraID, filepath.Base(video.path), info.ModTime())})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errNoExportSegments
+	}
+	orders := make([]segmentOrder, len(entries))
+	for i, entry := range entries {
+		orders[i] = entry.order
+	}
+	sorted := make([]fileEntry, 0, len(entries))
+	for _, i := range recordingOrder(orders) {
+		sorted = append(sorted, entries[i])
+	}
+	entries = sorted
+
+	cp := &exportCheckpoint{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Format:    opts.Format,
+		CameraID:  cameraID,
+		PixFmt:    e.config.exportPixFmt(),
+
+		Watermark:         e.watermark(),
+		WatermarkPosition: e.config.ExportWatermarkPosition,
+
+		SilentAudio: e.config.ExportSilentAudio,
+		Upload:      opts.Upload,
+	}
+	for _, entry := range entries {
+		cp.Segments = append(cp.Segments, entry.path)
+	}
+	if opts.Format == ExportFormatGIF {
+		// Segments are selected by end time, so the first one may start well before
+		// the requested range; trim to the range so the GIF is only the short clip.
+		firstStart := entries[0].modTime.Add(-time.Duration(e.config.SegmentLengthS) * time.Second)
+		cp.Offset = startTime.Sub(firstStart)
+		if cp.Offset < 0 {
+			cp.Offset = 0
+		}
+	}
+	return cp, nil
+}
+
+// watermark returns export_watermark_file, or "" if it's unset or missing
+func (e *exporter) watermark() string {
+	path := e.config.ExportWatermarkFile
+	if path == "" {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		e.logger.Warnf("Export watermark unavailable, exporting without it: %v", err)
+		return ""
+	}
+	return path
+}
+
+// encode writes the export described by cp into tempDir, skipping any chunks a
+// previous run already finished, and returns the finished file's path
+func (e *exporter) encode(ctx context.Context, cp *exportCheckpoint, tempDir string, rep *exportReporter) (string, error) {
+	rep.update(func(p *ExportProgress) {
+		p.Message = "Preparing export..."
+		p.TotalSegments = len(cp.Segments)
+		p.ProcessedFiles = cp.Completed
+	})
+
+	exportFilename := ExportFilename
+	if cp.Format == ExportFormatGIF {
+		exportFilename = ExportGIFFilename
+	}
+	outputFile := filepath.Join(tempDir, exportFilename)
+
+	var args []string
+	var message string
+	var expectedBytes int64
+	var inputDuration time.Duration // what -progress positions are measured against
+	if cp.Format == ExportFormatGIF {
+		// GIFs are capped at a short range, so they're encoded in one pass and an
+		// interrupted one simply starts over
+		concatFile := filepath.Join(tempDir, "concat_list.txt")
+		if _, err := writeConcatList(concatFile, cp.Segments); err != nil {
+			e.logger.Errorf("Failed to write concat file: %v", err)
+			return "", fmt.Errorf("failed to write concat list")
+		}
+		message = fmt.Sprintf("Encoding GIF from %d segments...", len(cp.Segments))
+		e.logger.Printf("Encoding %d MJPEG segments to GIF...", len(cp.Segments))
+		args = buildExportArgs(concatFile, outputFile, cp.Format, "", cp.Watermark, cp.WatermarkPosition, false, exportThreads(e.config), cp.Offset, cp.EndTime.Sub(cp.StartTime))
+		inputDuration = min(cp.EndTime.Sub(cp.StartTime), exportInputDuration(cp.Segments, time.Duration(e.config.SegmentLengthS)*time.Second)-cp.Offset)
+	} else {
+		if err := e.remuxChunks(ctx, cp, tempDir, rep); err != nil {
+			e.logger.Errorf("Export failed: %v", err)
+			return "", err
+		}
+
+		partPaths := make([]string, len(cp.Parts))
+		for i, p := range cp.Parts {
+			partPaths[i] = filepath.Join(tempDir, p)
+			if info, err := os.Stat(partPaths[i]); err == nil {
+				expectedBytes += info.Size()
+			}
+		}
+		concatFile := filepath.Join(tempDir, "parts_list.txt")
+		if _, err := writeConcatList(concatFile, partPaths); err != nil {
+			e.logger.Errorf("Failed to write concat file: %v", err)
+			return "", fmt.Errorf("failed to write concat list")
+		}
+		message = fmt.Sprintf("Joining %d parts...", len(cp.Parts))
+		e.logger.Printf("Joining %d export parts into MP4...", len(cp.Parts))
+		// The parts are already watermarked and in their final pixel format; joining
+		// them is a copy. The silent audio track, if wanted, is added here once for the whole file.
+		args = buildExportArgs(concatFile, outputFile, cp.Format, "", "", "", cp.SilentAudio, exportThreads(e.config), 0, 0)
+		inputDuration = exportInputDuration(cp.Segments, time.Duration(e.config.SegmentLengthS)*time.Second)
+	}
+
+	// Progress as key=value lines on stdout, measured in output time
+	args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+
+	for {
+		if err := e.proceed(ctx); err != nil {
+			return "", err
+		}
+		rep.setMessage(message)
+		err := e.runEncode(ctx, args, outputFile, expectedBytes, inputDuration, rep)
+		if err == errExportInterrupted {
+			e.logger.Printf("Export encode stopped for maintenance mode, starting it over once that ends")
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return outputFile, nil
+	}
+}
+
+// runEncode runs the ffmpeg that writes outputFile, reporting its progress
+// until it exits. expectedBytes, if known, is about how big the output will be
+// and inputDuration how much footage goes into it, for the ETA. If the run is
+// interrupted, the partial output is removed and errExportInterrupted returned.
+func (e *exporter) runEncode(ctx context.Context, args []string, outputFile string, expectedBytes int64, inputDuration time.Duration, rep *exportReporter) error {
+	runCtx, cancel := e.runContext(ctx)
+	defer cancel()
+
+	// Run ffmpeg at low CPU priority so SSH and other services remain responsive.
+	name, args := lowPriorityArgs(e.config, "ffmpeg", args...)
+
+	var stderrBuf strings.Builder
+	progress := &ffmpegProgress{}
+	proc, err := e.runner.Start(runCtx, name, args, progress, &stderrBuf)
+	if err != nil {
+		e.logger.Errorf("Failed to start ffmpeg: %v", err)
+		return fmt.Errorf("failed to start FFmpeg")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- proc.Wait() }()
+
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+	lastSize := int64(0)
+	smoothedBps := 0.0 // exponential moving average of write throughput
+
+	for {
+		select {
+		case err := <-done:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if interrupted(runCtx, err) {
+				os.Remove(outputFile)
+				return errExportInterrupted
+			}
+			if err != nil {
+				e.logger.Errorf("FFmpeg error: %s", stderrBuf.String())
+				return fmt.Errorf("FFmpeg failed -  %s", stderrBuf.String())
+			}
+			info, err := os.Stat(outputFile)
+			if err != nil || info.Size() == 0 {
+				e.logger.Printf("Export output file missing or empty")
+				return fmt.Errorf("output file missing or empty")
+			}
+			return nil
+		case <-ticker.C:
+			if outTime, speed, ok := progress.position(); ok && inputDuration > 0 {
+				percent := min(100*outTime.Seconds()/inputDuration.Seconds(), 99.9)
+				eta := 0
+				if speed > 0 && outTime < inputDuration {
+					eta = int((inputDuration-outTime).Seconds()/speed) + 1
+				}
+				msg := fmt.Sprintf("Encoding... %.0f%%", percent)
+				if speed > 0 {
+					msg += fmt.Sprintf(" (%.1fx)", speed)
+				}
+				if eta > 0 {
+					msg += fmt.Sprintf(", about %s left", (time.Duration(eta) * time.Second).String())
+				}
+				var sizeMB float64
+				if info, err := os.Stat(outputFile); err == nil {
+					sizeMB = float64(info.Size()) / BytesPerMB
+				}
+				rep.update(func(p *ExportProgress) {
+					p.Message = msg
+					p.Percent = percent
+					p.CurrentSizeMB = sizeMB
+					p.ETASeconds = eta
+				})
+				continue
+			}
+			// Without -progress output (an ffmpeg that lacks it, or none yet),
+			// fall back to the growth of the output file
+			if info, err := os.Stat(outputFile); err == nil {
+				sizeMB := float64(info.Size()) / BytesPerMB
+				bps := float64(info.Size()-lastSize) / 3.0
+				lastSize = info.Size()
+				if smoothedBps == 0 {
+					smoothedBps = bps
+				} else {
+					smoothedBps = ExportETASmoothing*bps + (1-ExportETASmoothing)*smoothedBps
+				}
+
+				// Joining copy-codec parts writes about as many bytes as the parts
+				// hold, so the remaining bytes over the smoothed throughput give the
+				// ETA. A GIF's size can't be predicted, so it gets no ETA.
+				eta := 0
+				if expectedBytes > info.Size() && smoothedBps > 0 {
+					eta = int(float64(expectedBytes-info.Size())/smoothedBps) + 1
+				}
+
+				progress := fmt.Sprintf("Writing... %.1f MB (%.1f MB/s)", sizeMB, bps/BytesPerMB)
+				if eta > 0 {
+					progress += fmt.Sprintf(", about %s left", (time.Duration(eta) * time.Second).String())
+				}
+				rep.update(func(p *ExportProgress) {
+					p.Message = progress
+					p.CurrentSizeMB = sizeMB
+					p.ETASeconds = eta
+				})
+			}
+		}
+	}
+}
+
+// remuxChunks remuxes the segments cp hasn't covered yet into MP4 parts of up
+// to ExportChunkSegments segments each, saving the checkpoint after every part
+func (e *exporter) remuxChunks(ctx context.Context, cp *exportCheckpoint, tempDir string, rep *exportReporter) error {
+	if cp.Completed > 0 {
+		e.logger.Printf("Resuming export: %d of %d segments already remuxed", cp.Completed, len(cp.Segments))
+	}
+
+	smoothedRate := 0.0 // exponential moving average of segments remuxed per second
+	for cp.Completed < len(cp.Segments) {
+		end := cp.Completed + ExportChunkSegments
+		if end > len(cp.Segments) {
+			end = len(cp.Segments)
+		}
+		chunk := cp.Segments[cp.Completed:end]
+
+		partName := fmt.Sprintf("part_%05d.mp4", len(cp.Parts))
+		listFile := filepath.Join(tempDir, "chunk_list.txt")
+		// Storage cleanup may have removed segments since the export was planned
+		written, err := writeConcatList(listFile, chunk)
+		if err != nil {
+			return fmt.Errorf("failed to write concat list: %w", err)
+		}
+
+		if written > 0 {
+			var started time.Time
+			for {
+				if err := e.proceed(ctx); err != nil {
+					return err
+				}
+				rep.setMessage(fmt.Sprintf("Remuxing segments %d-%d of %d...", cp.Completed+1, end, len(cp.Segments)))
+				started = time.Now()
+				err = e.remuxChunk(ctx, listFile, filepath.Join(tempDir, partName), cp)
+				if err != errExportInterrupted {
+					break
+				}
+				// The checkpoint still ends before this chunk, so it's simply redone
+				e.logger.Printf("Export stopped for maintenance mode at segment %d of %d, carrying on once that ends", cp.Completed+1, len(cp.Segments))
+			}
+			if err != nil {
+				return err
+			}
+			cp.Parts = append(cp.Parts, partName)
+
+			if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+				rate := float64(len(chunk)) / elapsed
+				if smoothedRate == 0 {
+					smoothedRate = rate
+				} else {
+					smoothedRate = ExportETASmoothing*rate + (1-ExportETASmoothing)*smoothedRate
+				}
+			}
+		}
+		cp.Completed = end
+
+		if err := cp.save(tempDir); err != nil {
+			e.logger.Warnf("Failed to update export checkpoint: %v", err)
+		}
+
+		eta := 0
+		if smoothedRate > 0 && cp.Completed < len(cp.Segments) {
+			eta = int(float64(len(cp.Segments)-cp.Completed)/smoothedRate) + 1
+		}
+		rep.update(func(p *ExportProgress) {
+			p.ProcessedFiles = cp.Completed
+			p.ETASeconds = eta
+		})
+	}
+	os.Remove(filepath.Join(tempDir, "chunk_list.txt"))
+
+	if len(cp.Parts) == 0 {
+		return fmt.Errorf("none of the selected segments exist anymore")
+	}
+	return nil
+}
+
+// remuxChunk remuxes the segments listed in listFile into the MP4 part at
+// partPath. If the run is interrupted, the partial part is removed and
+// errExportInterrupted returned.
+func (e *exporter) remuxChunk(ctx context.Context, listFile, partPath string, cp *exportCheckpoint) error {
+	runCtx, cancel := e.runContext(ctx)
+	defer cancel()
+
+	name, args := lowPriorityArgs(e.config, "ffmpeg", buildExportArgs(listFile, partPath, ExportFormatMP4, cp.PixFmt, cp.Watermark, cp.WatermarkPosition, false, exportThreads(e.config), 0, 0)...)
+	var stderrBuf strings.Builder
+	err := e.runner.Run(runCtx, name, args, nil, &stderrBuf)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if interrupted(runCtx, err) {
+		os.Remove(partPath)
+		return errExportInterrupted
+	}
+	if err != nil {
+		e.logger.Errorf("FFmpeg error: %s", stderrBuf.String())
+		return fmt.Errorf("FFmpeg failed -  %s", stderrBuf.String())
+	}
+	return nil
+}
+
+// exportThreads is export_threads, or by default every core but one so the
+// recording ffmpegs aren't starved while an export encodes
+func exportThreads(config *Config) int {
+	if config.ExportThreads > 0 {
+		return config.ExportThreads
+	}
+	if n := runtime.NumCPU() - 1; n > 1 {
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exportCheckpointFile is written into an export's temp dir and updated as parts finish
+const exportCheckpointFile = "checkpoint.json"
+
+// exportCheckpoint records what an export was asked for and how far it got, so
+// an export interrupted by a restart can carry on instead of starting over
+type exportCheckpoint struct {
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	Format    string        `json:"format"`
+	CameraID  string        `json:"camera_id,omitempty"`
+	Offset    time.Duration `json:"offset,omitempty"`  // GIF trim from the start of the first segment
+	PixFmt    string        `json:"pix_fmt,omitempty"` // MP4 parts re-encoded to this; "" = stream copy
+	Segments  []string      `json:"segments"`          // source segments in recording order
+	Completed int           `json:"completed"`         // segments already remuxed into parts
+	Parts     []string      `json:"parts"`             // finished part files in the temp dir, in order
+
+	// Image overlaid on the GIF or on every MP4 part, in WatermarkPosition's corner
+	Watermark         string `json:"watermark,omitempty"`
+	WatermarkPosition string `json:"watermark_position,omitempty"`
+
+	SilentAudio bool `json:"silent_audio,omitempty"` // add a silent AAC track when joining the parts
+	Upload      bool `json:"upload,omitempty"`       // upload when done even without auto_upload
+}
+
+// save writes the checkpoint via a temp file so a crash mid-write keeps the previous one
+func (cp *exportCheckpoint) save(tempDir string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(tempDir, exportCheckpointFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// loadExportCheckpoint reads the checkpoint in tempDir, rejecting one whose parts
+// have gone missing since it was written
+func loadExportCheckpoint(tempDir string) (*exportCheckpoint, error) {
+	data, err := os.ReadFile(filepath.Join(tempDir, exportCheckpointFile))
+	if err != nil {
+		return nil, err
+	}
+	var cp exportCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	if len(cp.Segments) == 0 || cp.Completed > len(cp.Segments) {
+		return nil, fmt.Errorf("checkpoint is inconsistent")
+	}
+	for _, p := range cp.Parts {
+		if _, err := os.Stat(filepath.Join(tempDir, p)); err != nil {
+			return nil, fmt.Errorf("part %s is missing", p)
+		}
+	}
+	return &cp, nil
+}
+
+// findResumableExport returns the path of the newest temp export dir in tempRoot
+// holding a usable checkpoint, or "" if there's nothing to resume
+func findResumableExport(tempRoot string) (string, *exportCheckpoint) {
+	entries, err := os.ReadDir(tempRoot)
+	if err != nil {
+		return "", nil
+	}
+	// Names end in a Unix timestamp, so the last match is the newest
+	for i := len(entries) - 1; i >= 0; i-- {
+		name := entries[i].Name()
+		if !entries[i].IsDir() || !strings.HasPrefix(name, ".temp_export_") {
+			continue
+		}
+		dir := filepath.Join(tempRoot, name)
+		if cp, err := loadExportCheckpoint(dir); err == nil {
+			return dir, cp
+		}
+	}
+	return "", nil
+}
+
+// writeConcatList writes an ffmpeg concat list of the paths that still exist and
+// returns how many were listed
+func writeConcatList(listFile string, paths []string) (int, error) {
+	var content strings.Builder
+	written := 0
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		fmt.Fprintf(&content, "file '%s'\n", p)
+		written++
+	}
+	return written, os.WriteFile(listFile, []byte(content.String()), 0644)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"dash-of-pi/camera"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ffmpegProgress follows the key=value lines ffmpeg writes with -progress, so
+// an export can report how far through its input it is rather than guessing
+// from the output size
+type ffmpegProgress struct {
+	mu      sync.Mutex
+	partial []byte
+	seen    bool          // an out_time arrived; until then callers fall back to the file size
+	outTime time.Duration // position reached in the output
+	speed   float64       // multiple of realtime; 0 = not known yet
+}
+
+func (p *ffmpegProgress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partial = append(p.partial, b...)
+	for {
+		i := bytes.IndexByte(p.partial, '\n')
+		if i < 0 {
+			break
+		}
+		p.line(strings.TrimSpace(string(p.partial[:i])))
+		p.partial = p.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+// line handles one key=value line; mu is held
+func (p *ffmpegProgress) line(line string) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return
+	}
+	switch key {
+	// out_time_ms is in microseconds too, a long-standing ffmpeg quirk
+	case "out_time_us", "out_time_ms":
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+			p.outTime = time.Duration(us) * time.Microsecond
+			p.seen = true
+		}
+	case "speed":
+		if x, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+			p.speed = x
+		}
+	}
+}
+
+// position returns the output position and speed, and false until ffmpeg has
+// reported any
+func (p *ffmpegProgress) position() (time.Duration, float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.outTime, p.speed, p.seen
+}
+
+// exportInputDuration adds up how long the segments that still exist run,
+// from their sidecars where there are any and segmentLength otherwise
+func exportInputDuration(segments []string, segmentLength time.Duration) time.Duration {
+	var total time.Duration
+	for _, path := range segments {
+		if _, err := os.Stat(path); err != nil {
+			continue // deleted by storage cleanup; writeConcatList skips it too
+		}
+		if meta, ok := camera.ReadSegmentMeta(path); ok && meta.EndTime.After(meta.StartTime) {
+			total += meta.EndTime.Sub(meta.StartTime)
+		} else {
+			total += segmentLength
+		}
+	}
+	return total
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduledExport is one scheduled_exports entry: every day at At (local time)
+// the server exports Range and, with Upload, uploads the result
+type ScheduledExport struct {
+	At     string `json:"at"`     // "HH:MM", 24-hour local time
+	Range  string `json:"range"`  // "previous day" or "previous <duration>", e.g. "previous 24h"
+	Format string `json:"format"` // "mp4" (default) or "gif"
+	Camera string `json:"camera"` // camera ID; empty = all cameras
+	Upload bool   `json:"upload"` // upload the export when done, even without auto_upload
+}
+
+// validate checks the entry and fills in defaults; gifMax is gif_max_seconds
+func (se *ScheduledExport) validate(gifMax int) error {
+	if _, err := time.Parse("15:04", se.At); err != nil {
+		return fmt.Errorf("invalid at %q (expected HH:MM)", se.At)
+	}
+	if se.Format == "" {
+		se.Format = ExportFormatMP4
+	}
+	if se.Format != ExportFormatMP4 && se.Format != ExportFormatGIF {
+		return fmt.Errorf("invalid format %q (expected mp4 or gif)", se.Format)
+	}
+	start, end, err := exportRange(se.Range, time.Now())
+	if err != nil {
+		return err
+	}
+	if se.Format == ExportFormatGIF && end.Sub(start) > time.Duration(gifMax)*time.Second {
+		return fmt.Errorf("range %q is longer than gif_max_seconds", se.Range)
+	}
+	return nil
+}
+
+// slot returns the time the entry is due on the day of now
+func (se ScheduledExport) slot(now time.Time) time.Time {
+	at, _ := time.Parse("15:04", se.At)
+	return time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, now.Location())
+}
+
+// exportRange resolves a range spec relative to at: "previous day" is the
+// calendar day before at's, "previous <duration>" the duration ending at at
+func exportRange(spec string, at time.Time) (time.Time, time.Time, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "previous day" {
+		end := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, at.Location())
+		return end.AddDate(0, 0, -1), end, nil
+	}
+	if rest, ok := strings.CutPrefix(spec, "previous "); ok {
+		if d, err := time.ParseDuration(strings.TrimSpace(rest)); err == nil && d > 0 {
+			return at.Add(-d), at, nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf(`invalid range %q (expected "previous day" or "previous <duration>", e.g. "previous 24h")`, spec)
+}
+
+// runExportSchedule starts each scheduled export when it's due, until Stop. An
+// entry that comes due while another export runs waits for it, for up to
+// ScheduledExportMaxDelay, and is skipped after that; the same applies to a slot
+// missed because the service was down.
+func (s *APIServer) runExportSchedule() {
+	schedules := s.config.ScheduledExports
+	lastSlot := make([]time.Time, len(schedules)) // slot each entry last ran (or gave up) for
+	waiting := make([]bool, len(schedules))
+
+	ticker := time.NewTicker(ScheduledExportCheckInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		for i, se := range schedules {
+			slot := se.slot(now)
+			if now.Before(slot) || slot.Equal(lastSlot[i]) {
+				continue
+			}
+			if now.Sub(slot) > ScheduledExportMaxDelay {
+				if waiting[i] {
+					s.logger.Warnf("Skipping scheduled export at %s: another export was still running", se.At)
+				}
+				lastSlot[i], waiting[i] = slot, false
+				continue
+			}
+
+			start, end, _ := exportRange(se.Range, slot)
+			if !s.beginExportJob(se.Format, start, end, "Scanning for video files...") {
+				if !waiting[i] {
+					s.logger.Printf("Scheduled export at %s is waiting for the running export to finish", se.At)
+					waiting[i] = true
+				}
+				continue
+			}
+			lastSlot[i], waiting[i] = slot, false
+			s.logger.Printf("Running scheduled export at %s (%s, %s)", se.At, se.Range, se.Format)
+			// Another entry due now finds this export running and waits for it
+			go s.generateExportAsync(start, end, se.Format, se.Camera, se.Upload)
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"dash-of-pi/camera"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeExportRunner stands in for the export's ffmpeg. Each run writes its
+// output (the last argument); the first remux then blocks until cancelled.
+type fakeExportRunner struct {
+	mu      sync.Mutex
+	outputs []string      // of every Run, in order
+	started chan struct{} // receives as each Run starts
+}
+
+func (r *fakeExportRunner) Run(ctx context.Context, name string, args []string, stdout, stderr io.Writer) error {
+	output := args[len(args)-1]
+	r.mu.Lock()
+	r.outputs = append(r.outputs, filepath.Base(output))
+	first := len(r.outputs) == 1
+	r.mu.Unlock()
+	if err := os.WriteFile(output, []byte("part"), 0644); err != nil {
+		return err
+	}
+	r.started <- struct{}{}
+	if first {
+		<-ctx.Done()
+		return errors.New("signal: killed")
+	}
+	return nil
+}
+
+func (r *fakeExportRunner) Start(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (camera.Process, error) {
+	if err := os.WriteFile(args[len(args)-1], []byte("export"), 0644); err != nil {
+		return nil, err
+	}
+	return exitedProcess{}, nil
+}
+
+func (r *fakeExportRunner) StartPiped(ctx context.Context, name string, args []string, stdout, stderr io.Writer) (camera.Process, io.WriteCloser, error) {
+	return nil, nil, errors.New("fakeExportRunner: StartPiped not supported")
+}
+
+func (r *fakeExportRunner) runs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.outputs...)
+}
+
+// exitedProcess has already exited successfully
+type exitedProcess struct{}
+
+func (exitedProcess) Wait() error      { return nil }
+func (exitedProcess) Kill() error      { return nil }
+func (exitedProcess) Interrupt() error { return nil }
+
+func TestExportStopsForMaintenance(t *testing.T) {
+	root := t.TempDir()
+	videoDir := filepath.Join(root, "videos")
+	now := time.Now()
+	for i := 0; i < ExportChunkSegments+5; i++ {
+		end := now.Add(time.Duration(i-60) * time.Minute)
+		writeSegment(t, filepath.Join(videoDir, "front"), "front", end.Add(-time.Minute), i, end)
+	}
+
+	runner := &fakeExportRunner{started: make(chan struct{}, 8)}
+	s := &APIServer{
+		config: &Config{VideoDir: videoDir, SegmentLengthS: 60},
+		logger: NewLogger(LevelError),
+		runner: runner,
+		done:   make(chan struct{}),
+	}
+
+	type result struct {
+		path string
+		err  error
+	}
+	finished := make(chan result, 1)
+	tempDir := filepath.Join(root, "temp")
+	go func() {
+		path, err := s.newExporter().GenerateExport(context.Background(), ExportOptions{
+			Start:   now.Add(-2 * time.Hour),
+			End:     now,
+			Format:  ExportFormatMP4,
+			TempDir: tempDir,
+		}, nil)
+		finished <- result{path, err}
+	}()
+
+	<-runner.started
+	s.beginMaintenance()
+
+	// The running remux is stopped and its partial part removed; nothing else
+	// runs until maintenance mode ends
+	waitUntil(t, func() bool {
+		_, err := os.Stat(filepath.Join(tempDir, "part_00000.mp4"))
+		return os.IsNotExist(err)
+	})
+	time.Sleep(100 * time.Millisecond)
+	if runs := runner.runs(); len(runs) != 1 {
+		t.Fatalf("ffmpeg ran %v during maintenance mode", runs[1:])
+	}
+
+	s.endMaintenance()
+	select {
+	case r := <-finished:
+		if r.err != nil {
+			t.Fatalf("GenerateExport: %v", r.err)
+		}
+		if filepath.Base(r.path) != ExportFilename {
+			t.Errorf("exported to %s", r.path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("export didn't finish after maintenance mode ended")
+	}
+
+	want := []string{"part_00000.mp4", "part_00000.mp4", "part_00001.mp4"}
+	if runs := runner.runs(); !reflect.DeepEqual(runs, want) {
+		t.Errorf("remuxed %v, want the stopped chunk redone and then the next: %v", runs, want)
+	}
+}
+
+// waitUntil polls cond for up to 5 seconds
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met within 5s")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
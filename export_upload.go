@@ -0,0 +1,311 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// UploadStatus reports the delivery of an export to s3_bucket and/or upload_url
+type UploadStatus struct {
+	InProgress  bool      `json:"in_progress"`
+	Filename    string    `json:"filename"`              // name the export was uploaded under
+	SHA256      string    `json:"sha256,omitempty"`      // of the export being uploaded
+	Destination string    `json:"destination,omitempty"` // "s3" or "url", the one currently uploading
+	BytesSent   int64     `json:"bytes_sent"`
+	TotalBytes  int64     `json:"total_bytes"`
+	Progress    string    `json:"progress"`
+	Error       string    `json:"error,omitempty"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// uploadConfigured reports whether any upload destination is set
+func (s *APIServer) uploadConfigured() bool {
+	return s.config.S3Bucket != "" || s.config.UploadURL != ""
+}
+
+// beginUpload starts tracking an upload of result, unless one is already running
+func (s *APIServer) beginUpload(result ExportResult) bool {
+	s.uploadMu.Lock()
+	defer s.uploadMu.Unlock()
+	if s.upload != nil && s.upload.InProgress {
+		return false
+	}
+	s.upload = &UploadStatus{
+		InProgress: true,
+		Filename:   uploadFilename(result),
+		SHA256:     result.SHA256,
+		TotalBytes: result.Size,
+		Progress:   "Starting upload...",
+	}
+	return true
+}
+
+func (s *APIServer) updateUpload(fn func(u *UploadStatus)) {
+	s.uploadMu.Lock()
+	defer s.uploadMu.Unlock()
+	if s.upload != nil {
+		fn(s.upload)
+	}
+}
+
+// uploadSnapshot returns a copy of the current or last upload, if any
+func (s *APIServer) uploadSnapshot() (UploadStatus, bool) {
+	s.uploadMu.Lock()
+	defer s.uploadMu.Unlock()
+	if s.upload == nil {
+		return UploadStatus{}, false
+	}
+	return *s.upload, true
+}
+
+// uploadFilename names an export by its range, so uploads from different days
+// don't overwrite each other at the destination
+func uploadFilename(result ExportResult) string {
+	format := result.Format
+	if format == "" {
+		format = ExportFormatMP4
+	}
+	return fmt.Sprintf("dashcam_export_%s_%s.%s",
+		result.StartTime.UTC().Format("2006-01-02T15-04-05Z"), result.EndTime.UTC().Format("2006-01-02T15-04-05Z"), format)
+}
+
+// runUpload sends the export described by result to every configured
+// destination in turn. The beginUpload caller owns the upload state.
+func (s *APIServer) runUpload(result ExportResult) {
+	exportPath := filepath.Join(s.config.VideoDir, ".export", result.Filename)
+	name := uploadFilename(result)
+
+	var failed []string
+	send := func(destination string, upload func(f *os.File, size int64, sent *atomic.Int64) error) {
+		// Each destination reads its own handle; the file may be replaced by a newer
+		// export meanwhile, and an open handle keeps reading the one being uploaded
+		f, err := os.Open(exportPath)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", destination, err))
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", destination, err))
+			return
+		}
+
+		var sent atomic.Int64
+		s.updateUpload(func(u *UploadStatus) {
+			u.Destination = destination
+			u.BytesSent = 0
+			u.TotalBytes = info.Size()
+			u.Progress = fmt.Sprintf("Uploading to %s...", destination)
+		})
+		stop := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					n := sent.Load()
+					s.updateUpload(func(u *UploadStatus) { u.BytesSent = n })
+				}
+			}
+		}()
+
+		started := time.Now()
+		err = upload(f, info.Size(), &sent)
+		close(stop)
+		s.updateUpload(func(u *UploadStatus) { u.BytesSent = sent.Load() })
+		if err != nil {
+			s.logger.Errorf("Export upload to %s failed: %v", destination, err)
+			failed = append(failed, fmt.Sprintf("%s: %v", destination, err))
+			return
+		}
+		s.logger.Printf("Uploaded export %s to %s: %.2f MB in %s", name, destination,
+			float64(info.Size())/BytesPerMB, time.Since(started).Round(time.Second))
+	}
+
+	if s.config.S3Bucket != "" {
+		send("s3", func(f *os.File, size int64, sent *atomic.Int64) error {
+			return s.uploadS3(f, size, sent, name, result)
+		})
+	}
+	if s.config.UploadURL != "" {
+		send("url", func(f *os.File, size int64, sent *atomic.Int64) error {
+			return s.uploadURL(f, size, sent, name, result)
+		})
+	}
+
+	s.updateUpload(func(u *UploadStatus) {
+		u.InProgress = false
+		u.Destination = ""
+		u.FinishedAt = time.Now()
+		if len(failed) > 0 {
+			u.Progress = "Failed"
+			u.Error = strings.Join(failed, "; ")
+		} else {
+			u.Progress = "Complete"
+		}
+	})
+}
+
+// countingReader adds every byte read to n
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// uploadURL POSTs the export as the raw request body
+func (s *APIServer) uploadURL(f *os.File, size int64, sent *atomic.Int64, name string, result ExportResult) error {
+	req, err := http.NewRequest(http.MethodPost, s.config.UploadURL, countingReader{f, sent})
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", exportContentType(result.Format))
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	if result.SHA256 != "" {
+		req.Header.Set("X-Content-SHA256", result.SHA256)
+		req.Header.Set("Digest", digestHeader(result.SHA256))
+	}
+	if s.config.UploadAuthHeader != "" {
+		req.Header.Set("Authorization", s.config.UploadAuthHeader)
+	}
+	return doUploadRequest(req)
+}
+
+// uploadS3 PUTs the export to s3_bucket (path-style, so any S3-compatible
+// service works), signed with AWS Signature Version 4. The export's SHA-256 is
+// already known, so the payload is signed without reading the file twice.
+func (s *APIServer) uploadS3(f *os.File, size int64, sent *atomic.Int64, name string, result ExportResult) error {
+	endpoint, err := url.Parse(strings.TrimRight(s.config.S3Endpoint, "/"))
+	if err != nil {
+		return err
+	}
+	key := s.config.S3Prefix + name
+	canonicalURI := endpoint.EscapedPath() + "/" + s3URIEncode(s.config.S3Bucket, true) + "/" + s3URIEncode(key, false)
+	target, err := url.Parse(endpoint.Scheme + "://" + endpoint.Host + canonicalURI)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, target.String(), countingReader{f, sent})
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", exportContentType(result.Format))
+
+	payloadHash := result.SHA256
+	if payloadHash == "" {
+		payloadHash = "UNSIGNED-PAYLOAD"
+	}
+	signS3Request(req, canonicalURI, payloadHash, s.config.S3Region, s.config.S3AccessKey, s.config.S3SecretKey, time.Now())
+	return doUploadRequest(req)
+}
+
+// signS3Request adds the x-amz-* and Authorization headers for a request with
+// no query string, signing host, x-amz-content-sha256 and x-amz-date
+func signS3Request(req *http.Request, canonicalURI, payloadHash, region, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		"", // query string
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3URIEncode percent-encodes everything but the unreserved characters, as
+// SigV4 requires; "/" is kept unless encodeSlash is set
+func s3URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// doUploadRequest sends req and turns a non-2xx response into an error quoting
+// the start of its body (S3 explains failures there)
+func doUploadRequest(req *http.Request) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+func exportContentType(format string) string {
+	if format == ExportFormatGIF {
+		return "image/gif"
+	}
+	return "video/mp4"
+}
+
+// validUploadEndpoint reports whether u is an absolute http(s) URL
+func validUploadEndpoint(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
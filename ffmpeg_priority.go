@@ -1,16 +1,18 @@
 package main
 
-import "os/exec"
+import (
+	"dash-of-pi/camera"
+	"os/exec"
+)
 
-func lowPriorityCommand(name string, args ...string) *exec.Cmd {
-	cmdArgs := append([]string{}, args...)
-	if _, err := exec.LookPath("nice"); err == nil {
-		cmdArgs = append([]string{"-n", "19", name}, cmdArgs...)
-		name = "nice"
-	}
+// lowPriorityArgs wraps a command in nice/taskset (export_nice, export_cpus) and
+// ionice (when installed) so heavy ffmpeg jobs don't starve recording, SSH and
+// the API
+func lowPriorityArgs(config *Config, name string, args ...string) (string, []string) {
+	name, cmdArgs := camera.PriorityArgs(config.ExportNice, config.ExportCPUs, name, args)
 	if _, err := exec.LookPath("ionice"); err == nil {
 		cmdArgs = append([]string{"-c", "3", name}, cmdArgs...)
 		name = "ionice"
 	}
-	return exec.Command(name, cmdArgs...)
+	return name, cmdArgs
 }
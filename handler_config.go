@@ -3,9 +3,16 @@ package main
 import (
 	"dash-of-pi/camera"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"path/filepath"
+	"strings"
 )
 
+// convertCameraConfigs maps the persisted camera settings onto the camera
+// package's runtime config. Every call site (startup and live reloads) goes
+// through here so new per-camera fields only need wiring up once.
 func convertCameraConfigs(configs []CameraConfig) []camera.CameraConfig {
 	result := make([]camera.CameraConfig, len(configs))
 	for i, c := range configs {
@@ -14,43 +21,141 @@ func convertCameraConfigs(configs []CameraConfig) []camera.CameraConfig {
 			Name:           c.Name,
 			Device:         c.Device,
 			Rotation:       c.Rotation,
+			FlipHorizontal: c.FlipHorizontal,
+			FlipVertical:   c.FlipVertical,
 			ResWidth:       c.ResWidth,
 			ResHeight:      c.ResHeight,
 			Bitrate:        c.Bitrate,
 			FPS:            c.FPS,
 			MJPEGQuality:   c.MJPEGQuality,
 			EmbedTimestamp: c.EmbedTimestamp,
+			LabelOverlay:   c.LabelOverlay,
 			Enabled:        c.Enabled,
+
+			SnapshotIntervalS: c.SnapshotIntervalS,
+			SnapshotRetain:    c.SnapshotRetain,
+
+			FrameWindowKB: c.FrameWindowKB,
+			PreviewScale:  c.PreviewScale,
+
+			PreviewNoOverlay: c.PreviewNoOverlay,
+
+			VideoDir: c.VideoDir,
+
+			WatermarkFile:     c.WatermarkFile,
+			WatermarkPosition: c.WatermarkPosition,
+
+			ContinuousRecording: c.ContinuousRecording,
+
+			PipeCommand: c.PipeCommand,
+		}
+	}
+	return result
+}
+
+// minRetainSegments collects each camera's MinRetainSegments for the storage manager
+func minRetainSegments(configs []CameraConfig) map[string]int {
+	result := make(map[string]int, len(configs))
+	for _, c := range configs {
+		if c.MinRetainSegments > 0 {
+			result[c.ID] = c.MinRetainSegments
+		}
+	}
+	return result
+}
+
+// cameraVideoDirs collects the video_dir of cameras that set one, for the
+// storage manager
+func cameraVideoDirs(configs []CameraConfig) map[string]string {
+	result := make(map[string]string)
+	for _, c := range configs {
+		if c.VideoDir != "" {
+			result[c.ID] = c.VideoDir
 		}
 	}
 	return result
 }
 
+// cameraDir returns the directory cameraID records to: its video_dir if it has
+// one, otherwise <video_dir>/<cameraID>
+func (s *APIServer) cameraDir(cameraID string) string {
+	for _, c := range s.config.Cameras {
+		if c.ID == cameraID && c.VideoDir != "" {
+			return c.VideoDir
+		}
+	}
+	return filepath.Join(s.config.VideoDir, cameraID)
+}
+
+// cameraDirs maps every camera ID with footage to its directory (see cameraDirs)
+func (s *APIServer) cameraDirs() (map[string]string, error) {
+	return cameraDirs(s.config.VideoDir, cameraVideoDirs(s.config.Cameras))
+}
+
 func (s *APIServer) handleGetConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"port":             s.config.Port,
-		"storage_cap_gb":   s.config.StorageCapGB,
-		"segment_length_s": s.config.SegmentLengthS,
-		"cameras":          s.config.Cameras,
+		"port":                     s.config.Port,
+		"storage_cap_gb":           s.config.StorageCapGB,
+		"storage_check_interval_s": s.config.StorageCheckIntervalS,
+		"segment_length_s":         s.config.SegmentLengthS,
+		"segment_mode":             s.config.SegmentMode,
+		"segment_max_bytes":        s.config.SegmentMaxBytes,
+		"cameras":                  s.config.Cameras,
 	})
 }
 
 func (s *APIServer) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" && r.Method != "PUT" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var newConfig struct {
-		Port           int            `json:"port"`
-		StorageCapGB   int            `json:"storage_cap_gb"`
-		SegmentLengthS int            `json:"segment_length_s"`
-		Cameras        []CameraConfig `json:"cameras"`
+		Port                  int            `json:"port"`
+		StorageCapGB          int            `json:"storage_cap_gb"`
+		StorageCheckIntervalS int            `json:"storage_check_interval_s"`
+		SegmentLengthS        int            `json:"segment_length_s"`
+		SegmentMode           string         `json:"segment_mode"`
+		SegmentMaxBytes       int64          `json:"segment_max_bytes"`
+		Cameras               []CameraConfig `json:"cameras"`
+	}
+
+	if !s.decodeJSONBody(w, r, &newConfig) {
+		return
+	}
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	// Everything is validated before anything is applied, so a rejected request
+	// changes nothing
+	if err := s.keepPipeCommands(newConfig.Cameras); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateCameraVideoDirs(newConfig.Cameras, s.config.VideoDir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if newConfig.StorageCheckIntervalS != 0 && newConfig.StorageCheckIntervalS < MinStorageCheckIntervalS {
+		http.Error(w, fmt.Sprintf("storage_check_interval_s must be at least %d", MinStorageCheckIntervalS), http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&newConfig); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	switch newConfig.SegmentMode {
+	case "", camera.SegmentModeTime:
+	case camera.SegmentModeSize, camera.SegmentModeBoth:
+		if newConfig.SegmentMaxBytes <= 0 && s.config.SegmentMaxBytes <= 0 {
+			http.Error(w, "segment_max_bytes is required for the size and both segment modes", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Invalid segment_mode (expected time, size or both)", http.StatusBadRequest)
+		return
+	}
+	if newConfig.SegmentMaxBytes < 0 {
+		http.Error(w, "segment_max_bytes can't be negative", http.StatusBadRequest)
 		return
 	}
 
@@ -64,48 +169,143 @@ func (s *APIServer) handleUpdateConfig(w http.ResponseWriter, r *http.Request) {
 	}
 	if newConfig.StorageCapGB > 0 {
 		s.config.StorageCapGB = newConfig.StorageCapGB
-		s.storage.SetCap(newConfig.StorageCapGB) // applied live
+		s.storage.SetCapGB(newConfig.StorageCapGB) // applied live
+	}
+	if newConfig.StorageCheckIntervalS > 0 {
+		s.config.StorageCheckIntervalS = newConfig.StorageCheckIntervalS
+		s.storage.SetCheckInterval(newConfig.StorageCheckIntervalS) // applied live
 	}
 	if newConfig.SegmentLengthS > 0 {
 		s.config.SegmentLengthS = newConfig.SegmentLengthS
 	}
+	segmentSizeChanged := newConfig.SegmentMode != "" || newConfig.SegmentMaxBytes > 0
+	if newConfig.SegmentMode != "" {
+		s.config.SegmentMode = newConfig.SegmentMode
+	}
+	if newConfig.SegmentMaxBytes > 0 {
+		s.config.SegmentMaxBytes = newConfig.SegmentMaxBytes
+	}
+	if segmentSizeChanged {
+		s.cameraManager.SetSegmentSize(s.config.SegmentMode, s.config.SegmentMaxBytes) // next segment
+	}
 	if len(newConfig.Cameras) > 0 {
 		s.config.Cameras = newConfig.Cameras
 	}
 
 	if err := SaveConfig(s.config, s.configPath); err != nil {
-		s.logger.Printf("Failed to save config: %v", err)
+		s.logger.Errorf("Failed to save config: %v", err)
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
 
-	// Apply camera/segment changes live by reloading cameras (unless caller only
-	// touched global fields with no cameras payload).
-	if len(newConfig.Cameras) > 0 || newConfig.SegmentLengthS > 0 {
+	// Camera changes need the cameras reloaded; a segment-length change alone is
+	// picked up by each camera's next segment without interrupting recording.
+	if len(newConfig.Cameras) > 0 {
+		s.storage.SetMinRetainSegments(minRetainSegments(s.config.Cameras))
+		s.storage.SetCameraDirs(cameraVideoDirs(s.config.Cameras))
 		if err := s.cameraManager.RestartWithConfigs(convertCameraConfigs(s.config.Cameras), s.config.SegmentLengthS, s.config.VideoDir); err != nil {
-			s.logger.Printf("Failed to restart cameras: %v", err)
+			s.logger.Errorf("Failed to restart cameras: %v", err)
 		}
+	} else if newConfig.SegmentLengthS > 0 {
+		s.cameraManager.SetSegmentLength(s.config.SegmentLengthS)
+	}
+
+	message := "Configuration updated."
+	if restartRequired {
+		message = "Configuration updated. Restart the service to apply the new port."
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":           "success",
-		"message":          "Configuration updated.",
+		"message":          message,
 		"restart_required": restartRequired,
 	})
 }
 
+// cameraStatus is a running camera's config plus the frame size it actually
+// records once rotation is applied.
+type cameraStatus struct {
+	camera.CameraConfig
+	OutputWidth  int    `json:"output_width"`
+	OutputHeight int    `json:"output_height"`
+	Orientation  string `json:"orientation"` // effective rotation/mirroring, e.g. "mirrored"
+
+	// Storage setting kept only in the persisted config (not needed by the camera package)
+	MinRetainSegments int `json:"min_retain_segments"`
+
+	// Not recording because its device was missing (auto_disable_missing)
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
 func (s *APIServer) handleListCameras(w http.ResponseWriter, r *http.Request) {
-	cameras := s.cameraManager.ListCameras()
+	configs := s.cameraManager.ListCameras()
+	minRetain := minRetainSegments(s.config.Cameras)
+	cameras := make([]cameraStatus, len(configs))
+	for i, c := range configs {
+		width, height := c.OutputSize()
+		cameras[i] = cameraStatus{
+			CameraConfig:      c,
+			OutputWidth:       width,
+			OutputHeight:      height,
+			Orientation:       c.Orientation(),
+			MinRetainSegments: minRetain[c.ID],
+			Unavailable:       s.cameraManager.IsUnavailable(c.ID),
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"cameras": cameras,
 	})
 }
 
+// handleCameraCommand shows the exact recorder command line last run for a
+// camera (?id=), for working out why it won't record
+func (s *APIServer) handleCameraCommand(w http.ResponseWriter, r *http.Request) {
+	cameraID := r.URL.Query().Get("id")
+	if cameraID == "" {
+		http.Error(w, "Missing camera ID", http.StatusBadRequest)
+		return
+	}
+	cam, ok := s.cameraManager.GetCamera(cameraID)
+	if !ok {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	args, startedAt := cam.LastCommand()
+	resp := map[string]interface{}{
+		"camera_id": cameraID,
+		"args":      args,
+		"command":   shellJoin(args),
+	}
+	if len(args) == 0 {
+		resp["args"] = []string{}
+		resp["started_at"] = nil // recording hasn't started (paused, unavailable or still booting)
+	} else {
+		resp["started_at"] = startedAt
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// shellJoin joins args into one line that can be pasted into a shell, quoting
+// any that need it
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`;&|<>()*?[]{}#~!") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
 func (s *APIServer) handleUpdateCamera(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" && r.Method != "PUT" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -115,32 +315,56 @@ func (s *APIServer) handleUpdateCamera(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var updatedCamera CameraConfig
-	if err := json.NewDecoder(r.Body).Decode(&updatedCamera); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
 
-	// Find and update camera in config
-	found := false
+	index := -1
 	for i := range s.config.Cameras {
 		if s.config.Cameras[i].ID == cameraID {
-			// Preserve ID
-			updatedCamera.ID = cameraID
-			s.config.Cameras[i] = updatedCamera
-			found = true
+			index = i
 			break
 		}
 	}
-
-	if !found {
+	if index < 0 {
 		http.Error(w, "Camera not found", http.StatusNotFound)
 		return
 	}
 
+	// The request is decoded over the camera's current settings, so fields it
+	// leaves out (the dashboard form only has some of them, e.g. not video_dir
+	// or watermark_file) keep their values instead of being reset
+	updatedCamera := s.config.Cameras[index]
+	if current := updatedCamera.ContinuousRecording; current != nil {
+		enabled := *current // decoded into, so it mustn't be shared with the current config
+		updatedCamera.ContinuousRecording = &enabled
+	}
+	if !s.decodeJSONBody(w, r, &updatedCamera) {
+		return
+	}
+
+	if !camera.ValidRotation(updatedCamera.Rotation) {
+		http.Error(w, "Invalid rotation (expected 0, 90, 180 or 270)", http.StatusBadRequest)
+		return
+	}
+
+	// Preserve ID
+	updatedCamera.ID = cameraID
+	if err := s.keepPipeCommands([]CameraConfig{updatedCamera}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cameras := append([]CameraConfig(nil), s.config.Cameras...)
+	cameras[index] = updatedCamera
+	if err := validateCameraVideoDirs(cameras, s.config.VideoDir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.config.Cameras = cameras
+
 	// Save config to disk
 	if err := SaveConfig(s.config, s.configPath); err != nil {
-		s.logger.Printf("Failed to save config: %v", err)
+		s.logger.Errorf("Failed to save config: %v", err)
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
@@ -148,15 +372,18 @@ func (s *APIServer) handleUpdateCamera(w http.ResponseWriter, r *http.Request) {
 	// Reload config from disk
 	cfg, err := LoadOrCreateConfig(s.configPath)
 	if err != nil {
-		s.logger.Printf("Failed to reload config: %v", err)
+		s.logger.Errorf("Failed to reload config: %v", err)
 		http.Error(w, "Failed to reload configuration", http.StatusInternalServerError)
 		return
 	}
 	s.config = cfg
 
+	s.storage.SetMinRetainSegments(minRetainSegments(s.config.Cameras))
+	s.storage.SetCameraDirs(cameraVideoDirs(s.config.Cameras))
+
 	// Restart cameras with new config
 	if err := s.cameraManager.RestartWithConfigs(convertCameraConfigs(s.config.Cameras), s.config.SegmentLengthS, s.config.VideoDir); err != nil {
-		s.logger.Printf("Failed to restart cameras: %v", err)
+		s.logger.Errorf("Failed to restart cameras: %v", err)
 		http.Error(w, "Failed to apply camera changes: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -170,22 +397,34 @@ func (s *APIServer) handleUpdateCamera(w http.ResponseWriter, r *http.Request) {
 
 func (s *APIServer) handleAddCamera(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var newCamera CameraConfig
-	if err := json.NewDecoder(r.Body).Decode(&newCamera); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !s.decodeJSONBody(w, r, &newCamera) {
 		return
 	}
 
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
 	// Validate required fields
 	if newCamera.ID == "" || newCamera.Name == "" || newCamera.Device == "" {
 		http.Error(w, "Missing required fields (id, name, device)", http.StatusBadRequest)
 		return
 	}
 
+	if !camera.ValidRotation(newCamera.Rotation) {
+		http.Error(w, "Invalid rotation (expected 0, 90, 180 or 270)", http.StatusBadRequest)
+		return
+	}
+
+	if newCamera.PipeCommand != "" {
+		http.Error(w, errPipeCommandConfigOnly.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Check if camera ID already exists
 	for _, cam := range s.config.Cameras {
 		if cam.ID == newCamera.ID {
@@ -194,12 +433,18 @@ func (s *APIServer) handleAddCamera(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	cameras := append(append([]CameraConfig(nil), s.config.Cameras...), newCamera)
+	if err := validateCameraVideoDirs(cameras, s.config.VideoDir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Add camera to config
-	s.config.Cameras = append(s.config.Cameras, newCamera)
+	s.config.Cameras = cameras
 
 	// Save config to disk
 	if err := SaveConfig(s.config, s.configPath); err != nil {
-		s.logger.Printf("Failed to save config: %v", err)
+		s.logger.Errorf("Failed to save config: %v", err)
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
@@ -207,15 +452,18 @@ func (s *APIServer) handleAddCamera(w http.ResponseWriter, r *http.Request) {
 	// Reload config from disk
 	cfg, err := LoadOrCreateConfig(s.configPath)
 	if err != nil {
-		s.logger.Printf("Failed to reload config: %v", err)
+		s.logger.Errorf("Failed to reload config: %v", err)
 		http.Error(w, "Failed to reload configuration", http.StatusInternalServerError)
 		return
 	}
 	s.config = cfg
 
+	s.storage.SetMinRetainSegments(minRetainSegments(s.config.Cameras))
+	s.storage.SetCameraDirs(cameraVideoDirs(s.config.Cameras))
+
 	// Restart cameras with new config
 	if err := s.cameraManager.RestartWithConfigs(convertCameraConfigs(s.config.Cameras), s.config.SegmentLengthS, s.config.VideoDir); err != nil {
-		s.logger.Printf("Failed to restart cameras: %v", err)
+		s.logger.Errorf("Failed to restart cameras: %v", err)
 		http.Error(w, "Failed to apply camera changes: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -229,7 +477,7 @@ func (s *APIServer) handleAddCamera(w http.ResponseWriter, r *http.Request) {
 
 func (s *APIServer) handleDeleteCamera(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "DELETE" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -239,6 +487,9 @@ func (s *APIServer) handleDeleteCamera(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
 	// Find and remove camera from config
 	found := false
 	for i, cam := range s.config.Cameras {
@@ -256,7 +507,7 @@ func (s *APIServer) handleDeleteCamera(w http.ResponseWriter, r *http.Request) {
 
 	// Save config to disk
 	if err := SaveConfig(s.config, s.configPath); err != nil {
-		s.logger.Printf("Failed to save config: %v", err)
+		s.logger.Errorf("Failed to save config: %v", err)
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
@@ -264,15 +515,18 @@ func (s *APIServer) handleDeleteCamera(w http.ResponseWriter, r *http.Request) {
 	// Reload config from disk
 	cfg, err := LoadOrCreateConfig(s.configPath)
 	if err != nil {
-		s.logger.Printf("Failed to reload config: %v", err)
+		s.logger.Errorf("Failed to reload config: %v", err)
 		http.Error(w, "Failed to reload configuration", http.StatusInternalServerError)
 		return
 	}
 	s.config = cfg
 
+	s.storage.SetMinRetainSegments(minRetainSegments(s.config.Cameras))
+	s.storage.SetCameraDirs(cameraVideoDirs(s.config.Cameras))
+
 	// Restart cameras with new config
 	if err := s.cameraManager.RestartWithConfigs(convertCameraConfigs(s.config.Cameras), s.config.SegmentLengthS, s.config.VideoDir); err != nil {
-		s.logger.Printf("Failed to restart cameras: %v", err)
+		s.logger.Errorf("Failed to restart cameras: %v", err)
 		http.Error(w, "Failed to apply camera changes: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -286,24 +540,53 @@ func (s *APIServer) handleDeleteCamera(w http.ResponseWriter, r *http.Request) {
 
 // handleRegenerateToken mints a new auth token, persists it, and swaps it into
 // the live auth middleware so the caller (and any other clients with the new
-// token) keep working without a service restart.
+// token) keep working without a service restart. The old token stops working at
+// once, including for MJPEG streams already open with it. Also served as
+// /api/auth/rotate.
 func (s *APIServer) handleRegenerateToken(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	oldToken := s.config.AuthToken
 	newToken := generateToken()
 	s.config.AuthToken = newToken
 	if err := SaveConfig(s.config, s.configPath); err != nil {
-		s.logger.Printf("Failed to save config after token regen: %v", err)
+		// Keep the token on disk and in memory in agreement
+		s.config.AuthToken = oldToken
+		s.logger.Errorf("Failed to save config after token regen: %v", err)
 		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
 	s.auth.UpdateToken(newToken)
-	s.logger.Printf("Auth token regenerated")
+	s.logger.Printf("Auth token regenerated by %s; the old token no longer works", r.RemoteAddr)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status": "success",
 		"token":  newToken,
 	})
 }
+
+// errPipeCommandConfigOnly rejects API requests that set a pipe_command: it runs
+// a shell command, so it can only be set in the config file
+var errPipeCommandConfigOnly = errors.New("pipe_command can only be set in the config file")
+
+// keepPipeCommands gives each of cameras the pipe_command its camera already
+// has, as the dashboard doesn't send it, and returns errPipeCommandConfigOnly
+// if one asks for a different command
+func (s *APIServer) keepPipeCommands(cameras []CameraConfig) error {
+	current := make(map[string]string, len(s.config.Cameras))
+	for _, cam := range s.config.Cameras {
+		current[cam.ID] = cam.PipeCommand
+	}
+	for i := range cameras {
+		if cameras[i].PipeCommand != "" && cameras[i].PipeCommand != current[cameras[i].ID] {
+			return errPipeCommandConfigOnly
+		}
+		cameras[i].PipeCommand = current[cameras[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newConfigServer returns an event server for cameras "a" and "b" whose config
+// and storage are set up for the config handlers
+func newConfigServer(t *testing.T) *APIServer {
+	t.Helper()
+	root := t.TempDir()
+	videoDir := filepath.Join(root, "videos")
+	s := newEventServer(t, videoDir)
+	storage, err := NewStorageManager(videoDir, 10, FullDiskPolicyOverwrite, 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(storage.Stop)
+	s.storage = storage
+	s.configPath = filepath.Join(root, "config.json")
+	s.config = &Config{
+		Port:                  8080,
+		VideoDir:              videoDir,
+		StorageCapGB:          10,
+		StorageCheckIntervalS: 3600,
+		SegmentLengthS:        60,
+		MaxRequestBodyBytes:   DefaultMaxRequestBodyBytes,
+		Cameras: []CameraConfig{
+			{ID: "a", Name: "a", Device: "/dev/video0", PipeCommand: "cat > /dev/null"},
+			{ID: "b", Name: "b", Device: "/dev/video1"},
+		},
+	}
+	return s
+}
+
+func TestUpdateConfigRejectedChangesNothing(t *testing.T) {
+	s := newConfigServer(t)
+
+	body := `{"port": 9090, "storage_cap_gb": 50, "cameras": [{"id": "a", "name": "a", "device": "/dev/video0", "pipe_command": "rm -rf /"}]}`
+	rec := httptest.NewRecorder()
+	s.handleUpdateConfig(rec, httptest.NewRequest(http.MethodPost, "/api/config/update", strings.NewReader(body)))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", rec.Code)
+	}
+	if s.config.Port != 8080 || s.config.StorageCapGB != 10 || s.storage.CapGB() != 10 {
+		t.Errorf("port %d, cap %d GB (storage %d GB); want the rejected request to leave 8080 and 10 GB",
+			s.config.Port, s.config.StorageCapGB, s.storage.CapGB())
+	}
+	if s.config.Cameras[0].PipeCommand != "cat > /dev/null" {
+		t.Errorf("pipe_command changed to %q", s.config.Cameras[0].PipeCommand)
+	}
+	if _, err := os.Stat(s.configPath); !os.IsNotExist(err) {
+		t.Error("the rejected config was saved")
+	}
+}
+
+func TestCameraVideoDirRejected(t *testing.T) {
+	shared := filepath.Join(t.TempDir(), "shared")
+
+	tests := []struct {
+		name    string
+		handler func(s *APIServer) http.HandlerFunc
+		target  string
+		body    func(videoDir string) string
+	}{
+		{
+			name:    "update config, relative",
+			handler: func(s *APIServer) http.HandlerFunc { return s.handleUpdateConfig },
+			target:  "/api/config/update",
+			body: func(string) string {
+				return `{"cameras": [{"id": "a", "name": "a", "device": "/dev/video0", "video_dir": "videos/a"}]}`
+			},
+		},
+		{
+			name:    "update config, the main video_dir",
+			handler: func(s *APIServer) http.HandlerFunc { return s.handleUpdateConfig },
+			target:  "/api/config/update",
+			body: func(videoDir string) string {
+				return `{"cameras": [{"id": "a", "name": "a", "device": "/dev/video0", "video_dir": "` + videoDir + `/"}]}`
+			},
+		},
+		{
+			name:    "update config, shared",
+			handler: func(s *APIServer) http.HandlerFunc { return s.handleUpdateConfig },
+			target:  "/api/config/update",
+			body: func(string) string {
+				return `{"cameras": [{"id": "a", "name": "a", "device": "/dev/video0", "video_dir": "` + shared + `"},
+					{"id": "b", "name": "b", "device": "/dev/video1", "video_dir": "` + shared + `"}]}`
+			},
+		},
+		{
+			name:    "update camera, shared",
+			handler: func(s *APIServer) http.HandlerFunc { return s.handleUpdateCamera },
+			target:  "/api/cameras/update?id=b",
+			body:    func(string) string { return `{"video_dir": "` + shared + `"}` },
+		},
+		{
+			name:    "add camera, shared",
+			handler: func(s *APIServer) http.HandlerFunc { return s.handleAddCamera },
+			target:  "/api/cameras/add",
+			body: func(string) string {
+				return `{"id": "c", "name": "c", "device": "/dev/video2", "video_dir": "` + shared + `"}`
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newConfigServer(t)
+			s.config.Cameras[0].VideoDir = shared
+			before := append([]CameraConfig(nil), s.config.Cameras...)
+
+			rec := httptest.NewRecorder()
+			tt.handler(s)(rec, httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body(s.config.VideoDir))))
+
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "video_dir") {
+				t.Fatalf("status %d (%s), want 400 for the video_dir", rec.Code, strings.TrimSpace(rec.Body.String()))
+			}
+			if len(s.config.Cameras) != len(before) || s.config.Cameras[1].VideoDir != "" {
+				t.Errorf("cameras changed to %+v", s.config.Cameras)
+			}
+			if _, err := os.Stat(s.configPath); !os.IsNotExist(err) {
+				t.Error("the rejected config was saved")
+			}
+		})
+	}
+}
+
+func TestValidateCameraVideoDirs(t *testing.T) {
+	cameras := []CameraConfig{
+		{ID: "a", VideoDir: "/mnt/usb/front/"},
+		{ID: "b"},
+		{ID: "c", VideoDir: "/mnt/usb/rear"},
+	}
+	if err := validateCameraVideoDirs(cameras, "/var/lib/dash-of-pi/videos"); err != nil {
+		t.Fatalf("validateCameraVideoDirs: %v", err)
+	}
+	if cameras[0].VideoDir != "/mnt/usb/front" || cameras[1].VideoDir != "" || cameras[2].VideoDir != "/mnt/usb/rear" {
+		t.Errorf("cleaned to %+v", cameras)
+	}
+}
@@ -57,6 +57,23 @@ func (s *APIServer) handleDiscoverCameras(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handleRefreshCapabilities re-runs the host encoder probe that is otherwise done
+// once at startup, e.g. after a driver update. Cameras pick up the result the
+// next time they are reloaded (any camera or config change).
+func (s *APIServer) handleRefreshCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	encoder := s.cameraManager.RefreshCapabilities()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"video_encoder": encoder,
+	})
+}
+
 func v4l2ctlAvailable() bool {
 	_, err := exec.LookPath("v4l2-ctl")
 	return err == nil
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"dash-of-pi/camera"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// EventClip is a protected clip written by /api/events/mark. Clips live under
+// VideoDir/.events/<camera>/, which storage cleanup never touches.
+type EventClip struct {
+	Name     string    `json:"name"`
+	CameraID string    `json:"camera_id"`
+	MarkedAt time.Time `json:"marked_at"`
+	Size     int64     `json:"size"`
+	Path     string    `json:"path"`
+}
+
+// handleMarkEvent saves the pre-record buffer plus the next PostEventSeconds of
+// frames into an event clip for one camera (?camera=) or, by default, all of them.
+// The clips are written in the background; the response lists their names.
+func (s *APIServer) handleMarkEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var cameraIDs []string
+	if cameraID := r.URL.Query().Get("camera"); cameraID != "" {
+		cameraIDs = []string{cameraID}
+	} else {
+		for _, cam := range s.cameraManager.ListCameras() {
+			cameraIDs = append(cameraIDs, cam.ID)
+		}
+	}
+
+	// Every clip file is created before any writer starts, so a request that
+	// fails part way leaves nothing behind and no camera marked
+	markedAt := time.Now()
+	post := time.Duration(s.config.PostEventSeconds) * time.Second
+	type pendingClip struct {
+		clip      EventClip
+		streamMgr *camera.StreamManager
+		file      *os.File
+	}
+	var pending []pendingClip
+	abort := func() {
+		for _, p := range pending {
+			p.file.Close()
+			os.Remove(p.file.Name())
+		}
+	}
+	for _, cameraID := range cameraIDs {
+		streamMgr, ok := s.cameraManager.GetStreamManager(cameraID)
+		if !ok {
+			if len(cameraIDs) == 1 {
+				http.Error(w, "Camera not found", http.StatusNotFound)
+				return
+			}
+			continue
+		}
+
+		eventDir := filepath.Join(s.config.VideoDir, ".events", cameraID)
+		if err := os.MkdirAll(eventDir, 0755); err != nil {
+			abort()
+			s.logger.Errorf("Failed to create event directory: %v", err)
+			http.Error(w, "Failed to create event directory", http.StatusInternalServerError)
+			return
+		}
+
+		name := fmt.Sprintf("event_%s_%s%s", cameraID, markedAt.UTC().Format(camera.SegmentTimeLayout), ExtensionMJPEG)
+		file, err := os.OpenFile(filepath.Join(eventDir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			abort()
+			if os.IsExist(err) {
+				http.Error(w, "An event was already marked this second", http.StatusConflict)
+				return
+			}
+			s.logger.Errorf("Failed to create event clip: %v", err)
+			http.Error(w, "Failed to create event clip", http.StatusInternalServerError)
+			return
+		}
+
+		pending = append(pending, pendingClip{
+			clip: EventClip{
+				Name:     name,
+				CameraID: cameraID,
+				MarkedAt: markedAt,
+				Path:     fmt.Sprintf("/api/events/download?camera=%s&file=%s", cameraID, name),
+			},
+			streamMgr: streamMgr,
+			file:      file,
+		})
+	}
+
+	var clips []EventClip
+	for _, p := range pending {
+		go s.writeEventClip(p.streamMgr, p.file, post)
+		s.cameraManager.MarkEvent(p.clip.CameraID, markedAt)
+		clips = append(clips, p.clip)
+	}
+
+	s.logger.Printf("Event marked; writing %d clip(s)", len(clips))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "recording",
+		"ready_at": markedAt.Add(post),
+		"clips":    clips,
+	})
+}
+
+func (s *APIServer) writeEventClip(streamMgr *camera.StreamManager, file *os.File, post time.Duration) {
+	defer file.Close()
+	clipPath := file.Name()
+
+	bw := bufio.NewWriter(file)
+	frames, err := streamMgr.WriteEventClip(bw, post)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		s.logger.Printf("Event clip %s incomplete: %v", filepath.Base(clipPath), err)
+		return
+	}
+	s.logger.Printf("Saved event clip %s (%d frames)", filepath.Base(clipPath), frames)
+}
+
+// handleListEvents lists saved event clips, newest first
+func (s *APIServer) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	eventsDir := filepath.Join(s.config.VideoDir, ".events")
+	clips := []EventClip{}
+
+	cameraDirs, _ := os.ReadDir(eventsDir)
+	for _, cameraDir := range cameraDirs {
+		if !cameraDir.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(eventsDir, cameraDir.Name()))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isVideoFile(entry.Name()) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			clips = append(clips, EventClip{
+				Name:     entry.Name(),
+				CameraID: cameraDir.Name(),
+				MarkedAt: info.ModTime(),
+				Size:     info.Size(),
+				Path:     fmt.Sprintf("/api/events/download?camera=%s&file=%s", cameraDir.Name(), entry.Name()),
+			})
+		}
+	}
+
+	sort.Slice(clips, func(i, j int) bool {
+		return clips[i].Name > clips[j].Name
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"events": clips,
+	})
+}
+
+// handleDownloadEvent serves one event clip (?camera=&file=)
+func (s *APIServer) handleDownloadEvent(w http.ResponseWriter, r *http.Request) {
+	cameraID := r.URL.Query().Get("camera")
+	filename := r.URL.Query().Get("file")
+	if cameraID == "" || filename == "" {
+		http.Error(w, "Missing camera or file parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Prevent directory traversal
+	if filepath.Dir(filename) != "." || filepath.Dir(cameraID) != "." || cameraID == ".." || filename == ".." {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	clipPath := filepath.Join(s.config.VideoDir, ".events", cameraID, filename)
+	if _, err := os.Stat(clipPath); err != nil {
+		http.Error(w, "Event clip not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "video/x-motion-jpeg")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	http.ServeFile(w, r, clipPath)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"dash-of-pi/camera"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newEventServer returns a server for cameras "a" and "b", not recording, that
+// keeps its event clips under videoDir
+func newEventServer(t *testing.T, videoDir string) *APIServer {
+	t.Helper()
+	var configs []camera.CameraConfig
+	for _, id := range []string{"a", "b"} {
+		configs = append(configs, camera.CameraConfig{
+			ID:           id,
+			Name:         id,
+			Device:       camera.TestDevicePrefix + "color",
+			ResWidth:     64,
+			ResHeight:    48,
+			FPS:          10,
+			MJPEGQuality: 5,
+			Enabled:      true,
+		})
+	}
+	logger := NewLogger(LevelError)
+	cm, err := camera.NewCameraManager(configs, 60, videoDir, "libx264", logger)
+	if err != nil {
+		t.Fatalf("NewCameraManager: %v", err)
+	}
+	return &APIServer{
+		config:        &Config{VideoDir: videoDir},
+		cameraManager: cm,
+		logger:        logger,
+	}
+}
+
+// eventClips returns the names of the clips saved for cameraID
+func eventClips(t *testing.T, videoDir, cameraID string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(filepath.Join(videoDir, ".events", cameraID))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestMarkEventAllCameras(t *testing.T) {
+	videoDir := t.TempDir()
+	s := newEventServer(t, videoDir)
+
+	rec := httptest.NewRecorder()
+	s.handleMarkEvent(rec, httptest.NewRequest(http.MethodPost, "/api/events/mark", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Clips []EventClip `json:"clips"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Clips) != 2 {
+		t.Fatalf("got %d clips, want one per camera", len(resp.Clips))
+	}
+	for _, clip := range resp.Clips {
+		if names := eventClips(t, videoDir, clip.CameraID); len(names) != 1 || names[0] != clip.Name {
+			t.Errorf("camera %s has clips %v, want %s", clip.CameraID, names, clip.Name)
+		}
+	}
+}
+
+func TestMarkEventConflictStartsNothing(t *testing.T) {
+	videoDir := t.TempDir()
+	s := newEventServer(t, videoDir)
+
+	// Camera b already has a clip for whichever second the request lands in
+	dir := filepath.Join(videoDir, ".events", "b")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := -1; i <= 2; i++ {
+		name := "event_b_" + now.Add(time.Duration(i)*time.Second).UTC().Format(camera.SegmentTimeLayout) + ExtensionMJPEG
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleMarkEvent(rec, httptest.NewRequest(http.MethodPost, "/api/events/mark", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status %d, want 409", rec.Code)
+	}
+	if names := eventClips(t, videoDir, "a"); len(names) != 0 {
+		t.Errorf("camera a got clips %v from a request that failed", names)
+	}
+	if names := eventClips(t, videoDir, "b"); len(names) != 4 {
+		t.Errorf("camera b has %d clips, want only the 4 already there", len(names))
+	}
+}
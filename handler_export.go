@@ -1,63 +1,99 @@
 package main
 
 import (
+	"context"
+	"dash-of-pi/camera"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
 	"time"
 )
 
 func (s *APIServer) checkExistingExport() {
+	// Loaded first: a resumed export keeps the previous one downloadable until it
+	// replaces it
+	s.loadExportResult()
+
+	// An export cut short by a restart picks up from its last checkpoint
+	resumeDir, cp := findResumableExport(s.storage.ExportTempDir())
+
 	// Clean up stale temp dirs from any previously crashed export
-	if cleaned := s.storage.CleanupTempExportDirs(); cleaned > 0 {
+	if cleaned := s.storage.CleanupTempExportDirs(resumeDir); cleaned > 0 {
 		s.logger.Printf("Cleaned up %d stale temp export director%s", cleaned, map[bool]string{true: "y", false: "ies"}[cleaned == 1])
 	}
 
-	exportPath := filepath.Join(s.config.VideoDir, ".export", ExportFilename)
-	infoPath := filepath.Join(s.config.VideoDir, ".export", "export_info.json")
+	if cp != nil {
+		s.logger.Printf("Resuming interrupted %s export from %s to %s (%d of %d segments done)",
+			cp.Format, cp.StartTime.Format(time.RFC3339), cp.EndTime.Format(time.RFC3339), cp.Completed, len(cp.Segments))
+		s.beginExportJob(cp.Format, cp.StartTime, cp.EndTime, "Resuming export...")
+		go s.runExport(ExportOptions{
+			Start:    cp.StartTime,
+			End:      cp.EndTime,
+			Format:   cp.Format,
+			CameraID: cp.CameraID,
+			TempDir:  resumeDir,
+			Upload:   cp.Upload,
+		}, cp)
+	}
+}
 
-	info, err := os.Stat(exportPath)
+// saveExportResult writes export_info.json via a temp file, so a crash mid-write
+// keeps the previous one
+func saveExportResult(exportDir string, result ExportResult) error {
+	data, err := json.Marshal(result)
 	if err != nil {
-		return
+		return err
+	}
+	path := filepath.Join(exportDir, "export_info.json")
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
 	}
+	return os.Rename(path+".tmp", path)
+}
+
+// loadExportResult picks up the finished export left in .export/ by a previous run
+func (s *APIServer) loadExportResult() {
+	infoPath := filepath.Join(s.config.VideoDir, ".export", "export_info.json")
 
 	infoData, err := os.ReadFile(infoPath)
 	if err != nil {
 		return
 	}
 
-	var exportInfo ExportInfo
-	if err := json.Unmarshal(infoData, &exportInfo); err != nil {
+	// Files from older versions are a whole ExportInfo, whose fields are a
+	// superset of ExportResult's
+	var result ExportResult
+	if err := json.Unmarshal(infoData, &result); err != nil {
 		return
 	}
 
-	if exportInfo.InProgress {
-		// Crashed mid-export -  clean up
-		s.logger.Printf("Found interrupted export, removing...")
-		os.Remove(exportPath)
-		os.Remove(infoPath)
+	// Exports written before GIF support carry no filename/format
+	if result.Filename == "" {
+		result.Filename = ExportFilename
+		result.Format = ExportFormatMP4
+	}
+	exportPath := filepath.Join(s.config.VideoDir, ".export", result.Filename)
+
+	info, err := os.Stat(exportPath)
+	if err != nil {
 		return
 	}
 
-	exportInfo.Size = info.Size()
-	exportInfo.Available = true
-	s.exportMutex.Lock()
-	s.exportInfo = &exportInfo
-	s.exportMutex.Unlock()
+	result.Size = info.Size()
+	s.setExportResult(&result)
 	s.logger.Printf("Found existing export: %.2f MB (%s to %s)",
 		float64(info.Size())/BytesPerMB,
-		exportInfo.StartTime.Format(time.RFC3339),
-		exportInfo.EndTime.Format(time.RFC3339))
+		result.StartTime.Format(time.RFC3339),
+		result.EndTime.Format(time.RFC3339))
 }
 
 func (s *APIServer) handleGenerateExport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -81,231 +117,397 @@ func (s *APIServer) handleGenerateExport(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	go s.generateExportAsync(startTime, endTime)
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = ExportFormatMP4
+	}
+	if format != ExportFormatMP4 && format != ExportFormatGIF {
+		http.Error(w, "Invalid format (expected mp4 or gif)", http.StatusBadRequest)
+		return
+	}
+
+	// GIFs are re-encoded frame by frame and grow quickly, so only short clips are allowed
+	if format == ExportFormatGIF && endTime.Sub(startTime) > time.Duration(s.config.GIFMaxSeconds)*time.Second {
+		http.Error(w, fmt.Sprintf("GIF exports are limited to %d seconds", s.config.GIFMaxSeconds), http.StatusBadRequest)
+		return
+	}
+
+	if s.inMaintenance() {
+		http.Error(w, "Maintenance mode is on", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.beginExportJob(format, startTime, endTime, "Scanning for video files...") {
+		http.Error(w, "An export is already in progress", http.StatusConflict)
+		return
+	}
+
+	go s.generateExportAsync(startTime, endTime, format, r.URL.Query().Get("camera"), false)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "started",
+		"message": "Export generation started",
+	})
+}
+
+// handleDownloadDay starts an MP4 export of one calendar day (?date=YYYY-MM-DD,
+// in the device's local timezone), optionally for a single camera (?camera=).
+// Progress and the download then go through the usual export endpoints.
+func (s *APIServer) handleDownloadDay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", r.URL.Query().Get("date"), time.Local)
+	if err != nil {
+		http.Error(w, "Invalid or missing date (expected YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	startTime := day
+	endTime := day.AddDate(0, 0, 1)
+
+	cameraID := r.URL.Query().Get("camera")
+	if cameraID != "" {
+		if _, ok := s.cameraManager.GetCamera(cameraID); !ok {
+			http.Error(w, "Camera not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	if s.inMaintenance() {
+		http.Error(w, "Maintenance mode is on", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.beginExportJob(ExportFormatMP4, startTime, endTime, "Scanning for video files...") {
+		http.Error(w, "An export is already in progress", http.StatusConflict)
+		return
+	}
+
+	go s.generateExportAsync(startTime, endTime, ExportFormatMP4, cameraID, false)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":  "started",
 		"message": "Export generation started",
+		"start":   startTime.Format(time.RFC3339),
+		"end":     endTime.Format(time.RFC3339),
 	})
 }
 
-func (s *APIServer) generateExportAsync(startTime, endTime time.Time) {
-	s.logger.Printf("Starting export from %s to %s", startTime.Format(time.RFC3339), endTime.Format(time.RFC3339))
+// generateExportAsync exports the segments that ended in [startTime, endTime],
+// from every camera or only cameraID if it's set. The caller has already
+// claimed the job with beginExportJob. upload uploads the result even when
+// auto_upload is off.
+func (s *APIServer) generateExportAsync(startTime, endTime time.Time, format, cameraID string, upload bool) {
+	// A scheduled export that comes due during maintenance starts once it ends
+	if !s.waitOutMaintenance() {
+		s.endExportJob("Error: server stopped")
+		return
+	}
+	s.logger.Printf("Starting %s export from %s to %s", format, startTime.Format(time.RFC3339), endTime.Format(time.RFC3339))
 
-	if cleaned := s.storage.CleanupTempExportDirs(); cleaned > 0 {
+	if cleaned := s.storage.CleanupTempExportDirs(""); cleaned > 0 {
 		s.logger.Printf("Cleaned up %d stale temp export director%s before starting", cleaned, map[bool]string{true: "y", false: "ies"}[cleaned == 1])
 	}
 
-	setProgress := func(msg string) {
-		s.exportMutex.Lock()
-		s.exportInfo.Progress = msg
-		s.exportMutex.Unlock()
+	s.runExport(ExportOptions{
+		Start:    startTime,
+		End:      endTime,
+		Format:   format,
+		CameraID: cameraID,
+		TempDir:  filepath.Join(s.storage.ExportTempDir(), fmt.Sprintf(".temp_export_%d", time.Now().Unix())),
+		Upload:   upload,
+	}, nil)
+}
+
+// newExporter returns an exporter that stops when maintenance mode begins and
+// carries on once it ends
+func (s *APIServer) newExporter() *exporter {
+	return &exporter{
+		config:    s.config,
+		logger:    s.logger,
+		runner:    s.runner,
+		hold:      s.waitOutMaintenance,
+		interrupt: s.maintenanceBegins,
 	}
+}
 
-	s.exportMutex.Lock()
-	s.exportInfo = &ExportInfo{
-		InProgress: true,
-		Progress:   "Scanning for video files...",
-		StartTime:  startTime,
-		EndTime:    endTime,
+// reportExportProgress copies an export's progress into the tracked job
+func (s *APIServer) reportExportProgress(p ExportProgress) {
+	s.updateExportJob(func(job *ExportJob) {
+		job.Progress = p.Message
+		job.TotalSegments = p.TotalSegments
+		job.ProcessedFiles = p.ProcessedFiles
+		job.Percent = p.Percent
+		job.CurrentSizeMB = p.CurrentSizeMB
+		job.ETASeconds = p.ETASeconds
+	})
+}
+
+// runExport generates the export opts describes, or carries on with the one
+// checkpointed in opts.TempDir when resume is set, and puts it in place of the
+// current one. TempDir is only removed once the export succeeds or fails, so a
+// process that dies mid-export leaves it behind for checkExistingExport to resume.
+func (s *APIServer) runExport(opts ExportOptions, resume *exportCheckpoint) {
+	defer os.RemoveAll(opts.TempDir)
+
+	setProgress := func(msg string) {
+		s.updateExportJob(func(job *ExportJob) { job.Progress = msg })
 	}
-	s.exportMutex.Unlock()
+	// A failed export leaves the previous result in place
+	fail := s.endExportJob
 
 	defer func() {
 		if r := recover(); r != nil {
-			s.logger.Printf("Export panicked: %v", r)
-			s.exportMutex.Lock()
-			s.exportInfo = &ExportInfo{Progress: "Error: export failed unexpectedly"}
-			s.exportMutex.Unlock()
+			s.logger.Errorf("Export panicked: %v", r)
+			fail("Error: export failed unexpectedly")
 		}
 	}()
 
-	// Collect MJPEG files in the date range
-	mjpegFiles, err := walkCameraVideos(s.config.VideoDir, func(_, _ string, info os.FileInfo) bool {
-		t := info.ModTime()
-		return (t.After(startTime) || t.Equal(startTime)) && !t.After(endTime)
-	})
-	if err != nil {
-		s.logger.Printf("Failed to scan video directory: %v", err)
-		s.exportMutex.Lock()
-		s.exportInfo = &ExportInfo{Progress: "Error: failed to scan video directory"}
-		s.exportMutex.Unlock()
+	exportDir := filepath.Join(s.config.VideoDir, ".export")
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		s.logger.Errorf("Failed to create export directory: %v", err)
+		fail("Error: failed to create export directory")
 		return
 	}
-
-	if len(mjpegFiles) == 0 {
+	exportFilename := ExportFilename
+	if opts.Format == ExportFormatGIF {
+		exportFilename = ExportGIFFilename
+	}
+	exportPath := filepath.Join(exportDir, exportFilename)
+
+	// ffmpeg writes into the temp dir and the result is moved into place when
+	// complete, so a crash never leaves a partial export behind. The process
+	// exiting ends ffmpeg, leaving the temp dir to resume from.
+	var outputFile string
+	var err error
+	if resume != nil {
+		outputFile, err = s.newExporter().resume(context.Background(), resume, opts.TempDir, s.reportExportProgress)
+	} else {
+		outputFile, err = s.newExporter().GenerateExport(context.Background(), opts, s.reportExportProgress)
+	}
+	if errors.Is(err, errNoExportSegments) {
 		s.logger.Printf("No videos found in date range")
-		s.exportMutex.Lock()
-		s.exportInfo = &ExportInfo{Progress: "No videos found in the specified date range"}
-		s.exportMutex.Unlock()
+		fail("No videos found in the specified date range")
 		return
 	}
-
-	// Sort by modification time; precompute to avoid repeated os.Stat calls
-	type fileEntry struct {
-		path    string
-		modTime time.Time
+	if err != nil {
+		fail("Error: " + err.Error())
+		return
 	}
-	entries := make([]fileEntry, 0, len(mjpegFiles))
-	for _, p := range mjpegFiles {
-		if info, err := os.Stat(p); err == nil {
-			entries = append(entries, fileEntry{p, info.ModTime()})
-		}
+	info, err := os.Stat(outputFile)
+	if err != nil {
+		fail("Error: output file missing or empty")
+		return
 	}
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].modTime.Before(entries[j].modTime)
-	})
-
-	s.exportMutex.Lock()
-	s.exportInfo.TotalSegments = len(entries)
-	s.exportMutex.Unlock()
+	job, _ := s.exportJobSnapshot()
 
-	// Temp dir holds only the concat list (a tiny text file).
-	// No file copying -  ffmpeg reads the original paths directly.
-	tempDir := filepath.Join(s.config.VideoDir, fmt.Sprintf(".temp_export_%d", time.Now().Unix()))
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		s.logger.Printf("Failed to create temp directory: %v", err)
-		return
+	setProgress("Computing checksum...")
+	sum, err := fileSHA256(outputFile)
+	if err != nil {
+		s.logger.Warnf("Failed to checksum export: %v", err)
 	}
-	defer os.RemoveAll(tempDir)
 
-	var concatContent strings.Builder
-	for _, e := range entries {
-		fmt.Fprintf(&concatContent, "file '%s'\n", e.path)
+	result := ExportResult{
+		Filename:      exportFilename,
+		Format:        opts.Format,
+		StartTime:     opts.Start,
+		EndTime:       opts.End,
+		Size:          info.Size(),
+		TotalSegments: job.TotalSegments,
+		SHA256:        sum,
 	}
-	concatFile := filepath.Join(tempDir, "concat_list.txt")
-	if err := os.WriteFile(concatFile, []byte(concatContent.String()), 0644); err != nil {
-		s.logger.Printf("Failed to write concat file: %v", err)
+
+	// The new export replaces the previous one in a single rename, so the previous
+	// one stays downloadable until this point and is left intact if it fails
+	if err := moveFile(outputFile, exportPath); err != nil {
+		s.logger.Errorf("Failed to move export into place: %v", err)
+		fail("Error: failed to save export")
 		return
 	}
+	s.setExportResult(&result)
 
-	exportDir := filepath.Join(s.config.VideoDir, ".export")
-	if err := os.MkdirAll(exportDir, 0755); err != nil {
-		s.logger.Printf("Failed to create export directory: %v", err)
-		return
+	// Only one export is kept, whatever its format
+	otherFilename := ExportGIFFilename
+	if exportFilename == ExportGIFFilename {
+		otherFilename = ExportFilename
+	}
+	os.Remove(filepath.Join(exportDir, otherFilename))
+	if err := saveExportResult(exportDir, result); err != nil {
+		s.logger.Warnf("Failed to save export info, the export won't be listed after a restart: %v", err)
 	}
-	outputFile := filepath.Join(exportDir, ExportFilename)
-	os.Remove(outputFile)
-	os.Remove(filepath.Join(exportDir, "export_info.json"))
 
-	setProgress(fmt.Sprintf("Remuxing %d segments...", len(entries)))
-	s.logger.Printf("Remuxing %d MJPEG segments to MP4 (copy codec)...", len(entries))
+	s.logger.Printf("Export complete: %.2f MB from %d segments (sha256 %s)", float64(info.Size())/BytesPerMB, job.TotalSegments, sum)
 
-	// Run ffmpeg at low CPU priority so SSH and other services remain responsive.
-	// -c:v copy remuxes MJPEG frames directly into the MP4 container -  no decoding or
-	// re-encoding, so the Pi's single core isn't saturated.
-	cmd := lowPriorityCommand(
-		"ffmpeg",
-		"-y",
-		"-threads", "1",
-		"-loglevel", "error",
-		"-fflags", "+discardcorrupt",
-		"-err_detect", "ignore_err",
-		"-f", "concat",
-		"-safe", "0",
-		"-i", concatFile,
-		"-c:v", "copy",
-		"-movflags", "+faststart",
-		"-f", "mp4",
-		outputFile,
-	)
+	s.updateExportJob(func(job *ExportJob) {
+		job.InProgress = false
+		job.Progress = "Complete"
+		job.CurrentSizeMB = float64(info.Size()) / BytesPerMB
+		job.ProcessedFiles = job.TotalSegments
+		job.Percent = 100
+		job.ETASeconds = 0
+	})
 
-	var stderrBuf strings.Builder
-	cmd.Stderr = &stderrBuf
+	if (s.config.AutoUpload || opts.Upload) && s.uploadConfigured() {
+		if s.beginUpload(result) {
+			go s.runUpload(result)
+		} else {
+			s.logger.Warnf("Not uploading export %s: an upload is already running", exportFilename)
+		}
+	}
+}
 
-	if err := cmd.Start(); err != nil {
-		s.logger.Printf("Failed to start ffmpeg: %v", err)
-		s.exportMutex.Lock()
-		s.exportInfo = &ExportInfo{Progress: "Error: failed to start FFmpeg"}
-		s.exportMutex.Unlock()
-		return
+// beginExportJob starts tracking a new export, unless one is already running
+// (then it returns false). Checking and claiming under one lock means two
+// requests racing can't both start an export.
+func (s *APIServer) beginExportJob(format string, startTime, endTime time.Time, progress string) bool {
+	s.exportJobMu.Lock()
+	defer s.exportJobMu.Unlock()
+	if s.exportJob != nil && s.exportJob.InProgress {
+		return false
 	}
+	s.exportJob = &ExportJob{
+		InProgress: true,
+		Format:     format,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		Progress:   progress,
+	}
+	return true
+}
 
-	done := make(chan error, 1)
-	go func() { done <- cmd.Wait() }()
-
-	ticker := time.NewTicker(3 * time.Second)
-	defer ticker.Stop()
-	lastSize := int64(0)
-
-	for {
-		select {
-		case err := <-done:
-			if err != nil {
-				s.logger.Printf("FFmpeg error: %s", stderrBuf.String())
-				s.exportMutex.Lock()
-				s.exportInfo = &ExportInfo{Progress: "Error: FFmpeg failed -  " + stderrBuf.String()}
-				s.exportMutex.Unlock()
-				return
-			}
-			goto encodingDone
-		case <-ticker.C:
-			if info, err := os.Stat(outputFile); err == nil {
-				sizeMB := float64(info.Size()) / BytesPerMB
-				speedMBps := float64(info.Size()-lastSize) / BytesPerMB / 3.0
-				lastSize = info.Size()
-				setProgress(fmt.Sprintf("Writing... %.1f MB (%.1f MB/s)", sizeMB, speedMBps))
-				s.exportMutex.Lock()
-				s.exportInfo.CurrentSizeMB = sizeMB
-				s.exportMutex.Unlock()
-			}
-		}
+// updateExportJob applies fn to the current job, if there is one
+func (s *APIServer) updateExportJob(fn func(job *ExportJob)) {
+	s.exportJobMu.Lock()
+	defer s.exportJobMu.Unlock()
+	if s.exportJob != nil {
+		fn(s.exportJob)
 	}
-encodingDone:
+}
 
-	info, err := os.Stat(outputFile)
-	if err != nil || info.Size() == 0 {
-		s.logger.Printf("Export output file missing or empty")
-		s.exportMutex.Lock()
-		s.exportInfo = &ExportInfo{Progress: "Error: output file missing or empty"}
-		s.exportMutex.Unlock()
-		return
+// endExportJob marks the running job as finished without a new result; progress
+// says why. The previously available export, if any, is untouched.
+func (s *APIServer) endExportJob(progress string) {
+	s.updateExportJob(func(job *ExportJob) {
+		job.InProgress = false
+		job.Progress = progress
+		job.ETASeconds = 0
+	})
+}
+
+// setExportResult replaces the available export; nil means there is none
+func (s *APIServer) setExportResult(result *ExportResult) {
+	s.exportResMu.Lock()
+	s.exportResult = result
+	s.exportResMu.Unlock()
+}
+
+// exportResultSnapshot returns a copy of the available export, if any
+func (s *APIServer) exportResultSnapshot() (ExportResult, bool) {
+	s.exportResMu.RLock()
+	defer s.exportResMu.RUnlock()
+	if s.exportResult == nil {
+		return ExportResult{}, false
 	}
+	return *s.exportResult, true
+}
 
-	s.logger.Printf("Export complete: %.2f MB from %d segments", float64(info.Size())/BytesPerMB, len(entries))
+// exportJobSnapshot returns a copy of the current or last job, if any
+func (s *APIServer) exportJobSnapshot() (ExportJob, bool) {
+	s.exportJobMu.RLock()
+	defer s.exportJobMu.RUnlock()
+	if s.exportJob == nil {
+		return ExportJob{}, false
+	}
+	return *s.exportJob, true
+}
 
-	exportInfo := ExportInfo{
-		Filename:      ExportFilename,
-		StartTime:     startTime,
-		EndTime:       endTime,
-		Size:          info.Size(),
-		Available:     true,
-		Progress:      "Complete",
-		CurrentSizeMB: float64(info.Size()) / BytesPerMB,
-		TotalSegments: len(entries),
+// exportSnapshot combines the job and the available export into the
+// export-status response
+func (s *APIServer) exportSnapshot() ExportInfo {
+	var info ExportInfo
+	if result, ok := s.exportResultSnapshot(); ok {
+		info.Result = &result
+		info.Available = true
+		info.Filename = result.Filename
+		info.Format = result.Format
+		info.StartTime = result.StartTime
+		info.EndTime = result.EndTime
+		info.Size = result.Size
+		info.TotalSegments = result.TotalSegments
+		info.SHA256 = result.SHA256
+	}
+	if upload, ok := s.uploadSnapshot(); ok {
+		info.Upload = &upload
 	}
+	if job, ok := s.exportJobSnapshot(); ok {
+		info.Job = &job
+		info.InProgress = job.InProgress
+		info.Progress = job.Progress
+		info.CurrentSizeMB = job.CurrentSizeMB
+		info.ProcessedFiles = job.ProcessedFiles
+		info.Percent = job.Percent
+		info.ETASeconds = job.ETASeconds
+		if job.InProgress || info.Result == nil {
+			info.Format = job.Format
+			info.StartTime = job.StartTime
+			info.EndTime = job.EndTime
+			info.TotalSegments = job.TotalSegments
+		}
+	}
+	return info
+}
 
-	if data, err := json.Marshal(exportInfo); err == nil {
-		os.WriteFile(filepath.Join(exportDir, "export_info.json"), data, 0644)
+// clearExportResult forgets the available export after it was deleted, along
+// with the finished job that produced it. A new export already running is left alone.
+func (s *APIServer) clearExportResult() {
+	s.setExportResult(nil)
+	s.exportJobMu.Lock()
+	if s.exportJob != nil && !s.exportJob.InProgress {
+		s.exportJob = nil
 	}
+	s.exportJobMu.Unlock()
+}
 
-	s.exportMutex.Lock()
-	s.exportInfo = &exportInfo
-	s.exportMutex.Unlock()
+// exportExpired marks the export unavailable after the storage manager deleted it
+// for exceeding export_ttl_hours
+func (s *APIServer) exportExpired() {
+	s.clearExportResult()
 }
 
 func (s *APIServer) handleExportStatus(w http.ResponseWriter, r *http.Request) {
-	s.exportMutex.RLock()
-	defer s.exportMutex.RUnlock()
+	info := s.exportSnapshot()
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.exportInfo)
+	json.NewEncoder(w).Encode(info)
 }
 
+// handleDownloadExport serves the last finished export, including while a new
+// one is being generated
 func (s *APIServer) handleDownloadExport(w http.ResponseWriter, r *http.Request) {
-	s.exportMutex.RLock()
-	available := s.exportInfo.Available
-	s.exportMutex.RUnlock()
-
-	if !available {
+	snapshot, ok := s.exportResultSnapshot()
+	if !ok {
 		http.Error(w, "No export available", http.StatusNotFound)
 		return
 	}
+	exportFilename := snapshot.Filename
+	format := snapshot.Format
+
+	if exportFilename == "" {
+		exportFilename = ExportFilename
+	}
 
-	exportPath := filepath.Join(s.config.VideoDir, ".export", ExportFilename)
+	contentType := "video/mp4"
+	if format == ExportFormatGIF {
+		contentType = "image/gif"
+	} else {
+		format = ExportFormatMP4
+	}
+
+	exportPath := filepath.Join(s.config.VideoDir, ".export", exportFilename)
 	info, err := os.Stat(exportPath)
-	if err != nil {
+	if err != nil || info.IsDir() {
 		http.Error(w, "Export file not found", http.StatusNotFound)
 		return
 	}
@@ -317,10 +519,14 @@ func (s *APIServer) handleDownloadExport(w http.ResponseWriter, r *http.Request)
 	}
 	defer file.Close()
 
-	w.Header().Set("Content-Type", "video/mp4")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=dashcam_export_%s.mp4", time.Now().Format("2006-01-02")))
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=dashcam_export_%s.%s", time.Now().Format("2006-01-02"), format))
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", info.Size()))
 	w.Header().Set("Cache-Control", "no-cache")
+	if snapshot.SHA256 != "" {
+		w.Header().Set("X-Content-SHA256", snapshot.SHA256)
+		w.Header().Set("Digest", digestHeader(snapshot.SHA256))
+	}
 
 	io.Copy(w, file)
 	s.logger.Printf("Export downloaded by client")
@@ -328,19 +534,146 @@ func (s *APIServer) handleDownloadExport(w http.ResponseWriter, r *http.Request)
 
 func (s *APIServer) handleDeleteExport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	os.Remove(filepath.Join(s.config.VideoDir, ".export", ExportFilename))
+	os.Remove(filepath.Join(s.config.VideoDir, ".export", ExportGIFFilename))
 	os.Remove(filepath.Join(s.config.VideoDir, ".export", "export_info.json"))
 
-	s.exportMutex.Lock()
-	s.exportInfo = &ExportInfo{Available: false}
-	s.exportMutex.Unlock()
+	s.clearExportResult()
 
 	s.logger.Printf("Export deleted")
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
 }
+
+// handleUploadExport sends the available export to s3_bucket and/or upload_url
+// in the background; progress is reported under "upload" in export-status
+func (s *APIServer) handleUploadExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !s.uploadConfigured() {
+		http.Error(w, "No upload destination configured (s3_bucket or upload_url)", http.StatusBadRequest)
+		return
+	}
+	result, ok := s.exportResultSnapshot()
+	if !ok {
+		http.Error(w, "No export available", http.StatusNotFound)
+		return
+	}
+	if !s.beginUpload(result) {
+		http.Error(w, "An upload is already in progress", http.StatusConflict)
+		return
+	}
+
+	go s.runUpload(result)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":   "started",
+		"filename": uploadFilename(result),
+	})
+}
+
+// buildExportArgs returns the ffmpeg arguments that turn the segments listed in
+// concatFile into one export. For GIFs, offset and length trim the output to the
+// requested range; MP4 exports keep whole segments. A pixFmt (e.g. "yuv420p")
+// re-encodes an MP4 export into that pixel format instead of copying the frames,
+// and silentAudio adds a silent AAC track for editors that reject video-only MP4s.
+// A watermark image is overlaid in the watermarkPos corner, which means an MP4
+// is re-encoded too. threads caps ffmpeg's decode and encode threads so
+// recording keeps some cores.
+func buildExportArgs(concatFile, outputFile, format, pixFmt, watermark, watermarkPos string, silentAudio bool, threads int, offset, length time.Duration) []string {
+	args := []string{
+		"-y",
+		"-threads", fmt.Sprintf("%d", threads),
+		"-loglevel", "error",
+		"-fflags", "+discardcorrupt",
+		"-err_detect", "ignore_err",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", concatFile,
+	}
+	if watermark != "" {
+		args = append(args, "-i", watermark)
+	}
+
+	if format == ExportFormatGIF {
+		// A two-pass palette (palettegen/paletteuse) keeps GIF colors close to the source.
+		// The watermark goes on before scaling, so it shrinks with the frame.
+		gifFilter := fmt.Sprintf("fps=%d,scale=%d:-1:flags=lanczos,split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse",
+			GIFExportFPS, GIFExportWidth)
+		filterFlag := "-vf"
+		if watermark != "" {
+			gifFilter = "[0:v][1:v]" + camera.WatermarkOverlay(watermarkPos) + "," + gifFilter
+			filterFlag = "-filter_complex"
+		}
+		return append(args,
+			"-ss", fmt.Sprintf("%.3f", offset.Seconds()),
+			"-t", fmt.Sprintf("%.3f", length.Seconds()),
+			filterFlag, gifFilter,
+			"-threads", fmt.Sprintf("%d", threads),
+			"-loop", "0",
+			"-f", "gif",
+			outputFile,
+		)
+	}
+
+	videoMap := "0:v"
+	if watermark != "" {
+		args = append(args, "-filter_complex", "[0:v][1:v]"+camera.WatermarkOverlay(watermarkPos)+"[v]")
+		videoMap = "[v]"
+	}
+
+	// anullsrc never ends, so -shortest stops the output with the video
+	if silentAudio {
+		audioInput := 1
+		if watermark != "" {
+			audioInput = 2
+		}
+		args = append(args,
+			"-f", "lavfi",
+			"-i", fmt.Sprintf("anullsrc=channel_layout=stereo:sample_rate=%d", ExportSilentAudioRate),
+			"-map", videoMap,
+			"-map", fmt.Sprintf("%d:a", audioInput),
+			"-c:a", "aac",
+			"-shortest",
+		)
+	} else if watermark != "" {
+		args = append(args, "-map", videoMap)
+	}
+
+	// MJPEG frames are full-range (yuvj422p/yuvj420p), which some players (notably
+	// QuickTime) show washed out. Re-encoding to an explicit limited-range format
+	// fixes that at the cost of a full decode/encode on the Pi. A watermark can't
+	// be copied through either, so it takes the same path.
+	if pixFmt != "" || watermark != "" {
+		args = append(args,
+			"-c:v", "mpeg4",
+			"-q:v", fmt.Sprintf("%d", ExportVideoQuality),
+		)
+		if pixFmt != "" {
+			args = append(args, "-pix_fmt", pixFmt)
+		}
+		return append(args,
+			"-threads", fmt.Sprintf("%d", threads),
+			"-movflags", "+faststart",
+			"-f", "mp4",
+			outputFile,
+		)
+	}
+
+	// -c:v copy remuxes MJPEG frames directly into the MP4 container -  no decoding or
+	// re-encoding, so the Pi's single core isn't saturated.
+	return append(args,
+		"-c:v", "copy",
+		"-movflags", "+faststart",
+		"-f", "mp4",
+		outputFile,
+	)
+}
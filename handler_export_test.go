@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flagValues returns the value after every occurrence of flag in args
+func flagValues(args []string, flag string) []string {
+	var values []string
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			values = append(values, args[i+1])
+		}
+	}
+	return values
+}
+
+func TestBuildExportArgs(t *testing.T) {
+	gifFilter := "fps=10,scale=480:-1:flags=lanczos,split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse"
+
+	tests := []struct {
+		name         string
+		format       string
+		pixFmt       string
+		watermark    string
+		watermarkPos string
+		silentAudio  bool
+		want         map[string][]string // flag -> every value it's given
+		absent       []string            // flags that mustn't appear
+	}{
+		{
+			name:   "mp4 by default re-encodes to yuv420p",
+			format: ExportFormatMP4,
+			pixFmt: DefaultConfig().exportPixFmt(),
+			want: map[string][]string{
+				"-c:v":     {"mpeg4"},
+				"-pix_fmt": {"yuv420p"},
+			},
+		},
+		{
+			name:   "mp4 with export_pix_fmt copy copies the frames",
+			format: ExportFormatMP4,
+			pixFmt: (&Config{ExportPixFmt: ExportPixFmtCopy}).exportPixFmt(),
+			want: map[string][]string{
+				"-i":   {"list.txt"},
+				"-c:v": {"copy"},
+				"-f":   {"concat", "mp4"},
+			},
+			absent: []string{"-pix_fmt", "-map", "-filter_complex", "-ss", "-t"},
+		},
+		{
+			name:   "mp4 in a pixel format re-encodes",
+			format: ExportFormatMP4,
+			pixFmt: "yuv420p",
+			want: map[string][]string{
+				"-c:v":     {"mpeg4"},
+				"-q:v":     {"2"},
+				"-pix_fmt": {"yuv420p"},
+			},
+		},
+		{
+			name:        "mp4 with silent audio",
+			format:      ExportFormatMP4,
+			silentAudio: true,
+			want: map[string][]string{
+				"-i":   {"list.txt", "anullsrc=channel_layout=stereo:sample_rate=48000"},
+				"-map": {"0:v", "1:a"},
+				"-c:a": {"aac"},
+				"-c:v": {"copy"},
+			},
+		},
+		{
+			name:      "mp4 watermark re-encodes",
+			format:    ExportFormatMP4,
+			watermark: "/logo.png",
+			want: map[string][]string{
+				"-i":              {"list.txt", "/logo.png"},
+				"-filter_complex": {"[0:v][1:v]overlay=x=W-w-10:y=H-h-10[v]"},
+				"-map":            {"[v]"},
+				"-c:v":            {"mpeg4"},
+			},
+			absent: []string{"-pix_fmt"},
+		},
+		{
+			name:         "mp4 watermark with silent audio",
+			format:       ExportFormatMP4,
+			watermark:    "/logo.png",
+			watermarkPos: "top-right",
+			silentAudio:  true,
+			want: map[string][]string{
+				"-i":              {"list.txt", "/logo.png", "anullsrc=channel_layout=stereo:sample_rate=48000"},
+				"-filter_complex": {"[0:v][1:v]overlay=x=W-w-10:y=10[v]"},
+				"-map":            {"[v]", "2:a"},
+			},
+		},
+		{
+			name:   "gif is trimmed and palettized",
+			format: ExportFormatGIF,
+			want: map[string][]string{
+				"-ss":   {"12.500"},
+				"-t":    {"30.000"},
+				"-vf":   {gifFilter},
+				"-loop": {"0"},
+				"-f":    {"concat", "gif"},
+			},
+			absent: []string{"-c:v", "-filter_complex"},
+		},
+		{
+			name:         "gif watermark goes on before scaling",
+			format:       ExportFormatGIF,
+			watermark:    "/logo.png",
+			watermarkPos: "bottom-left",
+			want: map[string][]string{
+				"-filter_complex": {"[0:v][1:v]overlay=x=10:y=H-h-10," + gifFilter},
+			},
+			absent: []string{"-vf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := buildExportArgs("list.txt", "out."+tt.format, tt.format, tt.pixFmt, tt.watermark, tt.watermarkPos, tt.silentAudio, 2, 12500*time.Millisecond, 30*time.Second)
+
+			for flag, want := range tt.want {
+				if got := flagValues(args, flag); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %q, want %q\nargs: %s", flag, got, want, strings.Join(args, " "))
+				}
+			}
+			for _, flag := range tt.absent {
+				if got := flagValues(args, flag); len(got) > 0 {
+					t.Errorf("unexpected %s %q", flag, got)
+				}
+			}
+			for _, threads := range flagValues(args, "-threads") {
+				if threads != "2" {
+					t.Errorf("-threads %s, want 2", threads)
+				}
+			}
+			if last := args[len(args)-1]; last != "out."+tt.format {
+				t.Errorf("last argument %q, want the output file", last)
+			}
+		})
+	}
+}
+
+// exportStatus calls handleExportStatus and decodes its response
+func exportStatus(t *testing.T, s *APIServer) ExportInfo {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleExportStatus(rec, httptest.NewRequest(http.MethodGet, "/api/export/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	var info ExportInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("decoding export status: %v", err)
+	}
+	return info
+}
+
+func TestHandleExportStatusPartialState(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := &ExportResult{Filename: "export.mp4", Format: ExportFormatMP4, StartTime: start, Size: 42, TotalSegments: 3}
+	running := &ExportJob{InProgress: true, Format: ExportFormatGIF, StartTime: start.Add(time.Hour), Progress: "Encoding"}
+	finished := &ExportJob{Format: ExportFormatMP4, StartTime: start, Progress: "Complete"}
+
+	tests := []struct {
+		name   string
+		result *ExportResult
+		job    *ExportJob
+		upload *UploadStatus
+		check  func(t *testing.T, info ExportInfo)
+	}{
+		{
+			name: "nothing yet",
+			check: func(t *testing.T, info ExportInfo) {
+				if info.Available || info.InProgress || info.Result != nil || info.Job != nil || info.Upload != nil {
+					t.Errorf("got %+v, want an empty status", info)
+				}
+			},
+		},
+		{
+			name: "job running, no export yet",
+			job:  running,
+			check: func(t *testing.T, info ExportInfo) {
+				if info.Available || !info.InProgress || info.Format != ExportFormatGIF || info.Progress != "Encoding" {
+					t.Errorf("got %+v, want the running job and nothing available", info)
+				}
+			},
+		},
+		{
+			name:   "export available, no job",
+			result: result,
+			check: func(t *testing.T, info ExportInfo) {
+				if !info.Available || info.Filename != "export.mp4" || info.Size != 42 || info.Job != nil {
+					t.Errorf("got %+v, want the available export", info)
+				}
+			},
+		},
+		{
+			name:   "new job over an available export",
+			result: result,
+			job:    running,
+			check: func(t *testing.T, info ExportInfo) {
+				if !info.Available || info.Filename != "export.mp4" || info.Format != ExportFormatGIF || !info.StartTime.Equal(running.StartTime) {
+					t.Errorf("got %+v, want the old file with the running job's format and times", info)
+				}
+			},
+		},
+		{
+			name:   "finished job",
+			result: result,
+			job:    finished,
+			check: func(t *testing.T, info ExportInfo) {
+				if !info.Available || info.InProgress || info.Progress != "Complete" || info.TotalSegments != 3 {
+					t.Errorf("got %+v, want the finished export", info)
+				}
+			},
+		},
+		{
+			name:   "upload only",
+			upload: &UploadStatus{InProgress: true, Filename: "export.mp4"},
+			check: func(t *testing.T, info ExportInfo) {
+				if info.Available || info.Upload == nil || !info.Upload.InProgress {
+					t.Errorf("got %+v, want just the upload", info)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &APIServer{exportResult: tt.result, exportJob: tt.job, upload: tt.upload}
+			tt.check(t, exportStatus(t, s))
+		})
+	}
+}
+
+func TestHandleDownloadExportNone(t *testing.T) {
+	rec := httptest.NewRecorder()
+	(&APIServer{}).handleDownloadExport(rec, httptest.NewRequest(http.MethodGet, "/api/export/download", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404 before any export", rec.Code)
+	}
+}
+
+func TestHandleExportStatusConcurrent(t *testing.T) {
+	// Run with -race: the status is read while an export starts and finishes
+	s := &APIServer{}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			s.exportJobMu.Lock()
+			s.exportJob = &ExportJob{InProgress: i%2 == 0, ProcessedFiles: i}
+			s.exportJobMu.Unlock()
+			if i%2 == 1 {
+				s.setExportResult(&ExportResult{Filename: "export.mp4", TotalSegments: i})
+			} else {
+				s.clearExportResult()
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		exportStatus(t, s)
+	}
+	wg.Wait()
+}
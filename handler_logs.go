@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleLogLevel reports the log level (GET) or changes it live (POST/PUT with
+// {"level":"debug"} or ?level=debug). The change isn't saved; a restart goes
+// back to log_level from the config.
+func (s *APIServer) handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		name := r.URL.Query().Get("level")
+		if name == "" {
+			var body struct {
+				Level string `json:"level"`
+			}
+			if !s.decodeJSONBody(w, r, &body) {
+				return
+			}
+			name = body.Level
+		}
+		level, err := ParseLogLevel(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.SetLevel(level)
+		s.logger.Printf("Log level set to %s", level)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"level": s.logger.Level().String(),
+	})
+}
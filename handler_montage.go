@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// montageLayout is the grid a montage is drawn on
+type montageLayout struct {
+	cols, rows   int
+	cellW, cellH int
+}
+
+// handleStreamMontage tiles the latest cached frame of every camera into one
+// JPEG grid, for a wall display. Each frame is scaled to fit a common cell
+// (?cell=WxH, default montage_cell_width wide at 16:9) keeping its aspect ratio;
+// cameras without a frame yet stay black. ?cols= fixes the number of columns
+// (default: as square as possible), leaving any spare cells blank. ?stream=1
+// serves a multipart MJPEG stream of the montage instead of a single frame.
+func (s *APIServer) handleStreamMontage(w http.ResponseWriter, r *http.Request) {
+	cameraIDs := s.montageCameraIDs()
+	if len(cameraIDs) == 0 {
+		http.Error(w, "No cameras", http.StatusNotFound)
+		return
+	}
+
+	layout := montageLayout{
+		cols:  int(math.Ceil(math.Sqrt(float64(len(cameraIDs))))),
+		cellW: s.config.MontageCellWidth,
+		cellH: s.config.MontageCellWidth * 9 / 16 &^ 1,
+	}
+	if cell := r.URL.Query().Get("cell"); cell != "" {
+		var ok bool
+		if layout.cellW, layout.cellH, ok = parseCellSize(cell); !ok {
+			http.Error(w, fmt.Sprintf("Invalid cell (expected WxH, each 16-%d)", MontageMaxCellSize), http.StatusBadRequest)
+			return
+		}
+	}
+	if colsStr := r.URL.Query().Get("cols"); colsStr != "" {
+		cols, err := strconv.Atoi(colsStr)
+		if err != nil || cols < 1 || cols > len(cameraIDs) {
+			http.Error(w, fmt.Sprintf("Invalid cols (expected 1-%d)", len(cameraIDs)), http.StatusBadRequest)
+			return
+		}
+		layout.cols = cols
+	}
+	layout.rows = (len(cameraIDs) + layout.cols - 1) / layout.cols
+
+	if r.URL.Query().Get("stream") == "1" {
+		s.streamMontage(w, r, cameraIDs, layout)
+		return
+	}
+
+	montage, err := s.buildMontage(cameraIDs, layout)
+	if err != nil {
+		s.logger.Errorf("Failed to build montage: %v", err)
+		http.Error(w, "Failed to build montage", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(montage)))
+	w.Write(montage)
+}
+
+// streamMontage sends a freshly built montage every MontageStreamIntervalMS
+// until the client leaves or the auth token changes
+func (s *APIServer) streamMontage(w http.ResponseWriter, r *http.Request, cameraIDs []string, layout montageLayout) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	delimiter := "--" + s.config.MJPEGBoundary
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+s.config.MJPEGBoundary)
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Connection", "close")
+
+	s.logger.Printf("Montage stream client connected (%d cameras)", len(cameraIDs))
+	defer s.logger.Printf("Montage stream client disconnected")
+
+	revoked := s.auth.Revoked()
+	ticker := time.NewTicker(MontageStreamIntervalMS * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		montage, err := s.buildMontage(cameraIDs, layout)
+		if err != nil {
+			s.logger.Errorf("Failed to build montage: %v", err)
+			return
+		}
+		if _, err := fmt.Fprintf(w, "%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", delimiter, len(montage)); err != nil {
+			return
+		}
+		if _, err := w.Write(montage); err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "\r\n"); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-revoked:
+			fmt.Fprintf(w, "%s--\r\n", delimiter)
+			flusher.Flush()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// montageCameraIDs returns the running cameras in a stable (ID) order, so tiles
+// don't move between frames
+func (s *APIServer) montageCameraIDs() []string {
+	var ids []string
+	for _, cam := range s.cameraManager.ListCameras() {
+		ids = append(ids, cam.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// buildMontage draws each camera's latest frame into the layout's grid, row by
+// row, and encodes the result as a JPEG at montage_quality
+func (s *APIServer) buildMontage(cameraIDs []string, layout montageLayout) ([]byte, error) {
+	cellW, cellH, cols := layout.cellW, layout.cellH, layout.cols
+	canvas := image.NewRGBA(image.Rect(0, 0, cols*cellW, layout.rows*cellH))
+	for i := 3; i < len(canvas.Pix); i += 4 {
+		canvas.Pix[i] = 0xff // opaque black background
+	}
+
+	for i, id := range cameraIDs {
+		streamMgr, ok := s.cameraManager.GetStreamManager(id)
+		if !ok {
+			continue
+		}
+		frame := streamMgr.GetLatestFrame()
+		if len(frame) == 0 {
+			continue
+		}
+		img, err := jpeg.Decode(bytes.NewReader(frame))
+		if err != nil {
+			s.logger.Debugf("Montage: skipping undecodable frame from camera %s: %v", id, err)
+			continue
+		}
+		cell := image.Rect(0, 0, cellW, cellH).Add(image.Pt((i%cols)*cellW, (i/cols)*cellH))
+		drawScaled(canvas, fitRect(img.Bounds(), cell), img)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, canvas, &jpeg.Options{Quality: s.config.MontageQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fitRect returns the largest rectangle with src's aspect ratio centered in cell
+func fitRect(src, cell image.Rectangle) image.Rectangle {
+	sw, sh := src.Dx(), src.Dy()
+	cw, ch := cell.Dx(), cell.Dy()
+	if sw == 0 || sh == 0 {
+		return image.Rectangle{}
+	}
+	w, h := cw, sh*cw/sw
+	if h > ch {
+		w, h = sw*ch/sh, ch
+	}
+	x0 := cell.Min.X + (cw-w)/2
+	y0 := cell.Min.Y + (ch-h)/2
+	return image.Rect(x0, y0, x0+w, y0+h)
+}
+
+// drawScaled draws src scaled into dst (nearest neighbour). image/draw can't
+// scale, and camera frames are YCbCr, which is read directly rather than through
+// At to keep this cheap enough for a Pi.
+func drawScaled(canvas *image.RGBA, dst image.Rectangle, src image.Image) {
+	sb := src.Bounds()
+	if dst.Empty() {
+		return
+	}
+	ycc, isYCbCr := src.(*image.YCbCr)
+	for y := dst.Min.Y; y < dst.Max.Y; y++ {
+		sy := sb.Min.Y + (y-dst.Min.Y)*sb.Dy()/dst.Dy()
+		row := canvas.Pix[canvas.PixOffset(dst.Min.X, y):]
+		for x := dst.Min.X; x < dst.Max.X; x++ {
+			sx := sb.Min.X + (x-dst.Min.X)*sb.Dx()/dst.Dx()
+			var r, g, b uint8
+			if isYCbCr {
+				yi, ci := ycc.YOffset(sx, sy), ycc.COffset(sx, sy)
+				r, g, b = color.YCbCrToRGB(ycc.Y[yi], ycc.Cb[ci], ycc.Cr[ci])
+			} else {
+				c := color.RGBAModel.Convert(src.At(sx, sy)).(color.RGBA)
+				r, g, b = c.R, c.G, c.B
+			}
+			i := (x - dst.Min.X) * 4
+			row[i], row[i+1], row[i+2], row[i+3] = r, g, b, 0xff
+		}
+	}
+}
+
+// parseCellSize parses "WxH" for the montage cell size
+func parseCellSize(s string) (int, int, bool) {
+	ws, hs, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return 0, 0, false
+	}
+	w, err1 := strconv.Atoi(ws)
+	h, err2 := strconv.Atoi(hs)
+	if err1 != nil || err2 != nil || w < 16 || h < 16 || w > MontageMaxCellSize || h > MontageMaxCellSize {
+		return 0, 0, false
+	}
+	return w, h, true
+}
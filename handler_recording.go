@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleRecordingStart turns the master recording switch back on
+func (s *APIServer) handleRecordingStart(w http.ResponseWriter, r *http.Request) {
+	s.setRecordingEnabled(w, r, true)
+}
+
+// handleRecordingStop stops all cameras from writing new segments (e.g. for
+// privacy). Existing footage stays available and the state survives restarts.
+func (s *APIServer) handleRecordingStop(w http.ResponseWriter, r *http.Request) {
+	s.setRecordingEnabled(w, r, false)
+}
+
+func (s *APIServer) setRecordingEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if err := s.runtimeState.SetRecordingEnabled(enabled); err != nil {
+		s.logger.Errorf("Failed to save recording state: %v", err)
+		http.Error(w, "Failed to save recording state", http.StatusInternalServerError)
+		return
+	}
+
+	if enabled {
+		s.cameraManager.ResumeRecording(PauseReasonStopped)
+	} else {
+		s.cameraManager.PauseRecording(PauseReasonStopped)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":            "success",
+		"recording_enabled": enabled,
+	})
+}
+
+// handleMaintenance turns maintenance mode on or off ({"enabled": bool}), for
+// working on the SD card (backups, fsck, swapping it) with nothing writing to it.
+// On, it closes every camera's segment and stops recording, stops storage cleanup
+// deleting anything and stops the ffmpeg a running export is in, then flushes
+// the disk. Off, everything carries on; the export redoes the step it was
+// stopped in. The mode isn't kept across restarts.
+func (s *APIServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		Enabled bool `json:"enabled"`
+	}
+	if !s.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	if req.Enabled {
+		s.beginMaintenance()
+
+		// Returns once every recorder has exited and its segment is complete
+		s.cameraManager.PauseRecording(PauseReasonMaintenance)
+		s.storage.SetPaused(true)
+		syncDisks()
+		s.logger.Printf("Maintenance mode on: recording, storage cleanup and exports paused")
+	} else {
+		s.storage.SetPaused(false)
+		s.cameraManager.ResumeRecording(PauseReasonMaintenance)
+		s.endMaintenance()
+		s.logger.Printf("Maintenance mode off")
+	}
+
+	job, _ := s.exportJobSnapshot()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"maintenance": req.Enabled,
+		// An export waits out maintenance mode, its running ffmpeg stopped
+		"export_in_progress": job.InProgress,
+	})
+}
+
+// beginMaintenance turns maintenance mode on for exports: the running ffmpeg
+// is stopped and the next waits for endMaintenance
+func (s *APIServer) beginMaintenance() {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	if s.maintenanceEnd == nil {
+		s.maintenanceEnd = make(chan struct{})
+	}
+	if s.maintenanceBegin != nil {
+		close(s.maintenanceBegin)
+		s.maintenanceBegin = nil
+	}
+}
+
+// endMaintenance turns maintenance mode off, letting held exports carry on
+func (s *APIServer) endMaintenance() {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	if s.maintenanceEnd != nil {
+		close(s.maintenanceEnd)
+		s.maintenanceEnd = nil
+	}
+}
+
+func (s *APIServer) inMaintenance() bool {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	return s.maintenanceEnd != nil
+}
+
+// maintenanceBegins returns a channel closed when maintenance mode begins, for
+// stopping an export's ffmpeg; already closed if it's on
+func (s *APIServer) maintenanceBegins() <-chan struct{} {
+	s.maintenanceMu.Lock()
+	defer s.maintenanceMu.Unlock()
+	if s.maintenanceEnd != nil {
+		on := make(chan struct{})
+		close(on)
+		return on
+	}
+	if s.maintenanceBegin == nil {
+		s.maintenanceBegin = make(chan struct{})
+	}
+	return s.maintenanceBegin
+}
+
+// waitOutMaintenance holds an export while maintenance mode is on. It returns
+// false if the server stopped meanwhile.
+func (s *APIServer) waitOutMaintenance() bool {
+	s.maintenanceMu.Lock()
+	end := s.maintenanceEnd
+	s.maintenanceMu.Unlock()
+	if end == nil {
+		return true
+	}
+
+	s.updateExportJob(func(job *ExportJob) { job.Progress = "Paused for maintenance..." })
+	select {
+	case <-end:
+		return true
+	case <-s.done:
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"dash-of-pi/camera"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is one interval still saved under VideoDir/<camera>/snapshots/.
+// Snapshots don't count toward the storage cap; each camera prunes its own.
+type Snapshot struct {
+	Name     string    `json:"name"`
+	CameraID string    `json:"camera_id"`
+	TakenAt  time.Time `json:"taken_at"`
+	Size     int64     `json:"size"`
+	Path     string    `json:"path"`
+}
+
+// handleListSnapshots lists interval snapshots, newest first, for every camera or
+// only ?camera=
+func (s *APIServer) handleListSnapshots(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("camera")
+	snapshots := []Snapshot{}
+
+	for _, cam := range s.cameraManager.ListCameras() {
+		if filter != "" && cam.ID != filter {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.cameraDir(cam.ID), camera.SnapshotDirName))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jpg") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			snapshots = append(snapshots, Snapshot{
+				Name:     entry.Name(),
+				CameraID: cam.ID,
+				TakenAt:  info.ModTime(),
+				Size:     info.Size(),
+				Path:     fmt.Sprintf("/api/snapshots/download?camera=%s&file=%s", cam.ID, entry.Name()),
+			})
+		}
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].TakenAt.After(snapshots[j].TakenAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"snapshots": snapshots,
+	})
+}
+
+// handleDownloadSnapshot serves one snapshot JPEG (?camera=&file=)
+func (s *APIServer) handleDownloadSnapshot(w http.ResponseWriter, r *http.Request) {
+	cameraID := r.URL.Query().Get("camera")
+	filename := r.URL.Query().Get("file")
+	if cameraID == "" || filename == "" {
+		http.Error(w, "Missing camera or file parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Prevent directory traversal
+	if filepath.Dir(filename) != "." || filepath.Dir(cameraID) != "." || cameraID == ".." || filename == ".." {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	snapPath := filepath.Join(s.cameraDir(cameraID), camera.SnapshotDirName, filename)
+	if _, err := os.Stat(snapPath); err != nil {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeFile(w, r, snapPath)
+}
@@ -16,6 +16,21 @@ func (s *APIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleTime reports the server's clock so the dashboard can warn when it
+// disagrees with the browser's (a Pi without an RTC before NTP has synced)
+func (s *APIServer) handleTime(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	zone, offset := now.Zone()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"time":         now.UTC().Format(time.RFC3339Nano),
+		"unix_ms":      now.UnixMilli(),
+		"timezone":     now.Location().String(),
+		"zone":         zone,
+		"utc_offset_s": offset,
+	})
+}
+
 func (s *APIServer) handleUI(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
@@ -39,8 +54,10 @@ func (s *APIServer) handleUI(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Fallback to a simple error if web directory doesn't exist
-	http.Error(w, "UI not found. Please ensure the 'web' directory is present and contains index.html.", http.StatusNotFound)
+	// Fall back to the dashboard built into the binary
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(getEmbeddedHTML())
 }
 
 func (s *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -61,17 +78,56 @@ func (s *APIServer) handleStatus(w http.ResponseWriter, r *http.Request) {
 		percent = int((used * 100) / cap)
 	}
 
+	health := "ok"
+	selfTest := s.cameraManager.SelfTestResults()
+	for _, result := range selfTest {
+		if !result.Passed {
+			health = "degraded"
+		}
+	}
+
+	recordingStatus := "recording"
+	if s.inMaintenance() {
+		recordingStatus = "maintenance"
+	} else if !s.runtimeState.IsRecordingEnabled() {
+		recordingStatus = "stopped"
+	} else if s.storage.IsFull() {
+		recordingStatus = "storage_full"
+	}
+
+	frameStats := s.cameraManager.FrameStats()
+	var droppedFrames int64
+	for _, fs := range frameStats {
+		droppedFrames += fs.DroppedFrames
+	}
+
 	status := StatusResponse{
-		Status: "recording",
+		Status: recordingStatus,
+		Health: health,
 		Storage: StorageStats{
 			UsedBytes: used,
 			CapBytes:  cap,
 			UsedGB:    float64(used) / BytesPerGB,
 			CapGB:     s.config.StorageCapGB,
 			Percent:   percent,
+			Full:      s.storage.IsFull(),
 		},
-		Videos: videos,
-		Uptime: fmt.Sprintf("%d seconds", int(time.Since(startTime).Seconds())),
+		Videos:   videos,
+		Uptime:   fmt.Sprintf("%d seconds", int(time.Since(startTime).Seconds())),
+		SelfTest: selfTest,
+
+		UnavailableCameras: s.cameraManager.UnavailableCameras(),
+
+		DroppedFrames: droppedFrames,
+		FrameStats:    frameStats,
+		FrameUpdater:  s.cameraManager.FrameUpdaterHealth(),
+
+		RestartCount:        s.runtimeState.RestartCount,
+		LastUncleanShutdown: s.runtimeState.LastUncleanShutdown,
+		LastStart:           s.runtimeState.LastStart,
+		RecordingEnabled:    s.runtimeState.IsRecordingEnabled(),
+
+		Maintenance: s.inMaintenance(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandleUIEmbedded(t *testing.T) {
+	// None of the places handleUI looks for a web directory may exist
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{"/var/lib/dash-of-pi/web", filepath.Join(filepath.Dir(os.Args[0]), "../web")} {
+		if _, err := os.Stat(dir); err == nil {
+			t.Skipf("%s exists and would be served instead", dir)
+		}
+	}
+
+	embedded := getEmbeddedHTML()
+	if len(embedded) == 0 {
+		t.Fatal("no dashboard page embedded in the binary")
+	}
+
+	s := &APIServer{}
+	rec := httptest.NewRecorder()
+	s.handleUI(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("Content-Type %q, want text/html", ct)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), embedded) {
+		t.Error("body isn't the embedded web/index.html")
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleUI(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /nope: status %d, want 404", rec.Code)
+	}
+}
+
+func TestEmbeddedWebFSAssets(t *testing.T) {
+	// The page's scripts and styles come from the embedded copy too
+	server := httptest.NewServer(http.StripPrefix("/web/", http.FileServer(embeddedWebFS())))
+	defer server.Close()
+
+	for _, name := range []string{"app.js", "style.css"} {
+		want, err := webAssets.ReadFile("web/" + name)
+		if err != nil {
+			t.Fatalf("%s not embedded: %v", name, err)
+		}
+		resp, err := http.Get(server.URL + "/web/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(body.Bytes(), want) {
+			t.Errorf("GET /web/%s: status %d, %d bytes; want the embedded %d", name, resp.StatusCode, body.Len(), len(want))
+		}
+	}
+}
@@ -1,12 +1,70 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
-// handleStreamFrame serves the latest JPEG frame from the live stream
+// frameRateLimiter enforces a minimum interval between /api/stream/frame requests
+// per client and camera, so a runaway poller can't keep a Pi Zero busy serving JPEGs.
+type frameRateLimiter struct {
+	mu       sync.Mutex
+	lastSeen map[string]time.Time // "host|camera" -> last served request
+}
+
+func newFrameRateLimiter() *frameRateLimiter {
+	return &frameRateLimiter{lastSeen: make(map[string]time.Time)}
+}
+
+// allow records a request and reports whether it came at least minInterval after
+// the previous one from the same key. On rejection it returns how long to wait.
+func (fl *frameRateLimiter) allow(key string, minInterval time.Duration) (bool, time.Duration) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := fl.lastSeen[key]; ok {
+		if wait := minInterval - now.Sub(last); wait > 0 {
+			return false, wait
+		}
+	}
+	fl.lastSeen[key] = now
+
+	// Forget clients that went away so the map can't grow without bound
+	if len(fl.lastSeen) > 256 {
+		for k, t := range fl.lastSeen {
+			if now.Sub(t) > time.Minute {
+				delete(fl.lastSeen, k)
+			}
+		}
+	}
+	return true, 0
+}
+
+// StreamStats tracks what one MJPEG client has actually been sent, so a laggy
+// preview can be pinned on the camera, the server, or the network.
+type StreamStats struct {
+	CameraID    string    `json:"camera_id"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+	FramesSent  int       `json:"frames_sent"`
+	BytesSent   int64     `json:"bytes_sent"`
+	FPS         float64   `json:"fps"`     // wall-clock FPS over the last StreamLogInterval frames
+	AvgFPS      float64   `json:"avg_fps"` // wall-clock FPS since connect
+	Kbps        float64   `json:"kbps"`    // average throughput since connect
+}
+
+// handleStreamFrame serves the latest JPEG frame from the live stream. Until a
+// camera has a frame it answers 503, or with ?placeholder=1 a 200 "camera
+// starting" image, for an <img> that would otherwise show as broken.
 func (s *APIServer) handleStreamFrame(w http.ResponseWriter, r *http.Request) {
 	// Get camera ID from query parameter (defaults to first camera)
 	cameraID := r.URL.Query().Get("camera")
@@ -21,10 +79,34 @@ func (s *APIServer) handleStreamFrame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.config.StreamFrameMinIntervalMS > 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		minInterval := time.Duration(s.config.StreamFrameMinIntervalMS) * time.Millisecond
+		if ok, wait := s.frameLimiter.allow(host+"|"+cameraID, minInterval); !ok {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+			http.Error(w, "Polling too fast", http.StatusTooManyRequests)
+			return
+		}
+	}
+
 	// Get latest frame from stream manager
-	frameData := streamMgr.GetLatestFrame()
+	frameData, capturedAt := streamMgr.GetLatestFrameWithTime()
+	if len(frameData) == 0 && r.URL.Query().Get("placeholder") == "1" {
+		if placeholder := placeholderFrame(); len(placeholder) > 0 {
+			s.logger.Debugf("/api/stream/frame: No frames available for camera %s - returning the placeholder", cameraID)
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+			w.Header().Set("X-Frame-Placeholder", "1")
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(placeholder)))
+			w.Write(placeholder)
+			return
+		}
+	}
 	if len(frameData) == 0 {
-		s.logger.Printf("[WARN] /api/stream/frame: No frames available for camera %s - returning 503", cameraID)
+		s.logger.Warnf("/api/stream/frame: No frames available for camera %s - returning 503", cameraID)
 		http.Error(w, "Recording is initializing - no frames available yet. Please try again in a few seconds.", http.StatusServiceUnavailable)
 		return
 	}
@@ -34,18 +116,93 @@ func (s *APIServer) handleStreamFrame(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(frameData)))
+	setFrameTimestampHeaders(w.Header(), capturedAt)
 	w.Write(frameData)
 }
 
+// cameraSnapshot is one camera's latest frame in /api/cameras/snapshot-all
+type cameraSnapshot struct {
+	CapturedAt time.Time `json:"captured_at"`
+	JPEG       []byte    `json:"jpeg"` // base64 in JSON
+}
+
+// handleSnapshotAll returns every camera's latest frame in one response, keyed
+// by camera ID; cameras without a frame yet are left out
+func (s *APIServer) handleSnapshotAll(w http.ResponseWriter, r *http.Request) {
+	snapshots := make(map[string]cameraSnapshot)
+	for _, cam := range s.cameraManager.ListCameras() {
+		streamMgr, ok := s.cameraManager.GetStreamManager(cam.ID)
+		if !ok {
+			continue
+		}
+		frameData, capturedAt := streamMgr.GetLatestFrameWithTime()
+		if len(frameData) == 0 {
+			continue
+		}
+		snapshots[cam.ID] = cameraSnapshot{CapturedAt: capturedAt, JPEG: frameData}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// setFrameTimestampHeaders tells the client when the frame was captured, so it can
+// line up several cameras or notice a frozen feed itself
+func setFrameTimestampHeaders(h http.Header, capturedAt time.Time) {
+	h.Set("X-Frame-Timestamp", capturedAt.UTC().Format(time.RFC3339Nano))
+	h.Set("X-Frame-Timestamp-Ms", strconv.FormatInt(capturedAt.UnixMilli(), 10))
+}
+
+// handleSignFrameURL mints a signed, expiring URL for the latest frame of a
+// camera (?camera=&ttl= seconds), for embedding as a plain <img> in dashboards
+func (s *APIServer) handleSignFrameURL(w http.ResponseWriter, r *http.Request) {
+	cameraID := r.URL.Query().Get("camera")
+	if cameraID == "" {
+		cameraID = s.cameraManager.GetDefaultCameraID()
+	}
+	if _, ok := s.cameraManager.GetStreamManager(cameraID); !ok {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	ttl := DefaultSignedFrameTTLS
+	if ttlStr := r.URL.Query().Get("ttl"); ttlStr != "" {
+		v, err := strconv.Atoi(ttlStr)
+		if err != nil || v <= 0 || v > MaxSignedFrameTTLS {
+			http.Error(w, fmt.Sprintf("Invalid ttl (expected 1-%d seconds)", MaxSignedFrameTTLS), http.StatusBadRequest)
+			return
+		}
+		ttl = v
+	}
+
+	exp := time.Now().Add(time.Duration(ttl) * time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"url":        SignedFramePath + "?" + s.auth.SignFrameURL(cameraID, exp),
+		"expires_at": exp.UTC().Format(time.RFC3339),
+	})
+}
+
 // handleStreamMJPEG serves continuous MJPEG stream (multipart)
 func (s *APIServer) handleStreamMJPEG(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+	// RFC 2046: the Content-Type advertises the bare boundary and each part is
+	// delimited by "--" + boundary. Some old NVRs instead expect the dashes inside
+	// the advertised boundary (boundary=--frame) and the delimiter used verbatim;
+	// ?compat=1 switches to that framing.
+	boundary := s.config.MJPEGBoundary
+	delimiter := "--" + boundary
+	if r.URL.Query().Get("compat") == "1" {
+		boundary = "--" + boundary
+		delimiter = boundary
+	}
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
 	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
 	w.Header().Set("Connection", "close")
 
-	boundary := "frame"
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
@@ -66,7 +223,27 @@ func (s *APIServer) handleStreamMJPEG(w http.ResponseWriter, r *http.Request) {
 	}
 
 	s.logger.Printf("MJPEG stream client connected for camera %s", cameraID)
-	defer s.logger.Printf("MJPEG stream client disconnected")
+
+	stats := &StreamStats{
+		CameraID:    cameraID,
+		RemoteAddr:  r.RemoteAddr,
+		ConnectedAt: time.Now(),
+	}
+	s.streamStatsMu.Lock()
+	s.nextStreamID++
+	streamID := s.nextStreamID
+	s.streamStats[streamID] = stats
+	s.streamStatsMu.Unlock()
+
+	defer func() {
+		s.streamStatsMu.Lock()
+		delete(s.streamStats, streamID)
+		s.logger.Printf("MJPEG stream client disconnected (%d frames, %.1f avg fps, %.0f kbps)",
+			stats.FramesSent, stats.AvgFPS, stats.Kbps)
+		s.streamStatsMu.Unlock()
+	}()
+
+	revoked := s.auth.Revoked()
 
 	// Stream frames continuously at target FPS
 	ticker := time.NewTicker(time.Duration(MJPEGStreamIntervalMS) * time.Millisecond)
@@ -74,16 +251,25 @@ func (s *APIServer) handleStreamMJPEG(w http.ResponseWriter, r *http.Request) {
 
 	frameCount := 0
 	noFrameCount := 0
+	windowStart := time.Now()
 	for {
 		select {
 		case <-r.Context().Done():
 			return
+		case <-revoked:
+			s.logger.Printf("MJPEG stream: Auth token changed, closing connection")
+			fmt.Fprintf(w, "%s--\r\n", delimiter)
+			flusher.Flush()
+			return
 		case <-ticker.C:
-			frameData := streamMgr.GetLatestFrame()
+			frameData, capturedAt := streamMgr.GetLatestFrameWithTime()
 			if len(frameData) == 0 {
 				noFrameCount++
 				if noFrameCount > MJPEGNoFrameTimeout {
 					s.logger.Printf("MJPEG stream: No frames timeout, closing connection")
+					// Close the multipart body properly so strict clients see a clean end
+					fmt.Fprintf(w, "%s--\r\n", delimiter)
+					flusher.Flush()
 					return
 				}
 				continue
@@ -91,7 +277,7 @@ func (s *APIServer) handleStreamMJPEG(w http.ResponseWriter, r *http.Request) {
 			noFrameCount = 0
 
 			// Write frame to stream
-			_, err := fmt.Fprintf(w, "--%s\r\n", boundary)
+			_, err := fmt.Fprintf(w, "%s\r\n", delimiter)
 			if err != nil {
 				return
 			}
@@ -99,6 +285,10 @@ func (s *APIServer) handleStreamMJPEG(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				return
 			}
+			_, err = fmt.Fprintf(w, "X-Frame-Timestamp: %s\r\n", capturedAt.UTC().Format(time.RFC3339Nano))
+			if err != nil {
+				return
+			}
 			_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(frameData))
 			if err != nil {
 				return
@@ -115,9 +305,92 @@ func (s *APIServer) handleStreamMJPEG(w http.ResponseWriter, r *http.Request) {
 			flusher.Flush()
 			frameCount++
 
+			now := time.Now()
+			s.streamStatsMu.Lock()
+			stats.FramesSent = frameCount
+			stats.BytesSent += int64(len(frameData))
+			if elapsed := now.Sub(stats.ConnectedAt).Seconds(); elapsed > 0 {
+				stats.AvgFPS = float64(frameCount) / elapsed
+				stats.Kbps = float64(stats.BytesSent) * 8 / BytesPerKB / elapsed
+			}
 			if frameCount%StreamLogInterval == 0 {
-				s.logger.Debugf("MJPEG stream: sent %d frames", frameCount)
+				stats.FPS = float64(StreamLogInterval) / now.Sub(windowStart).Seconds()
+				windowStart = now
+				s.logger.Debugf("MJPEG stream: sent %d frames (%.1f fps, %.0f kbps)", frameCount, stats.FPS, stats.Kbps)
 			}
+			s.streamStatsMu.Unlock()
 		}
 	}
 }
+
+// handleLatestSegment picks the completed segment a DVR-style player should play
+// next (?camera=, default first camera). Without ?after= it is the newest complete
+// segment; with ?after=<file> it is the oldest one recorded after that file, so a
+// player rolls through segments in order. 204 means nothing newer has finished.
+// The player downloads the segment itself and draws its frames at the camera's FPS.
+func (s *APIServer) handleLatestSegment(w http.ResponseWriter, r *http.Request) {
+	cameraID := r.URL.Query().Get("camera")
+	if cameraID == "" {
+		cameraID = s.cameraManager.GetDefaultCameraID()
+	}
+	cam, ok := s.cameraManager.GetCamera(cameraID)
+	if !ok {
+		http.Error(w, "Camera not found", http.StatusNotFound)
+		return
+	}
+
+	segments, err := completedSegments(s.cameraDir(cameraID), cameraID)
+	if err != nil {
+		http.Error(w, "Failed to list videos", http.StatusInternalServerError)
+		return
+	}
+
+	// segments is newest first; next indexes the one to play
+	next := -1
+	if after := r.URL.Query().Get("after"); after == "" {
+		if len(segments) > 0 {
+			next = 0
+		}
+	} else {
+		afterOrder := newSegmentOrder(cameraID, filepath.Base(after), time.Time{})
+		for i := len(segments) - 1; i >= 0; i-- {
+			if afterOrder.before(segments[i].order) {
+				next = i
+				break
+			}
+		}
+	}
+	if next == -1 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	segment := segments[next]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"camera":    cameraID,
+		"file":      segment.name,
+		"fps":       cam.GetConfig().FPS,
+		"url":       fmt.Sprintf("/api/video/download?camera=%s&file=%s", url.QueryEscape(cameraID), url.QueryEscape(segment.name)),
+		"remaining": next, // completed segments newer than this one
+	})
+}
+
+// handleStreamStats lists delivery stats for every connected MJPEG client
+func (s *APIServer) handleStreamStats(w http.ResponseWriter, r *http.Request) {
+	s.streamStatsMu.Lock()
+	clients := make([]StreamStats, 0, len(s.streamStats))
+	for _, st := range s.streamStats {
+		clients = append(clients, *st)
+	}
+	s.streamStatsMu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"clients": clients,
+	})
+}
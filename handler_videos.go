@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
+	"dash-of-pi/camera"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -45,7 +49,7 @@ func (s *APIServer) handleDownloadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	videoPath := filepath.Join(s.config.VideoDir, cameraID, filename)
+	videoPath := camera.ResolveSegmentPath(s.cameraDir(cameraID), filename)
 
 	// Verify file exists and is in video directory
 	if _, err := os.Stat(videoPath); err != nil {
@@ -66,9 +70,73 @@ func (s *APIServer) handleDownloadVideo(w http.ResponseWriter, r *http.Request)
 	io.Copy(w, file)
 }
 
+// handleFrameAt serves a single JPEG from a recorded MJPEG segment at the given
+// offset (?camera=&file=&offset_ms=), so an incident can be reviewed frame-by-frame
+// without transcoding. The offset is mapped to a frame index using the camera's FPS.
+func (s *APIServer) handleFrameAt(w http.ResponseWriter, r *http.Request) {
+	cameraID := r.URL.Query().Get("camera")
+	filename := r.URL.Query().Get("file")
+	offsetStr := r.URL.Query().Get("offset_ms")
+
+	if filename == "" {
+		http.Error(w, "Missing file parameter", http.StatusBadRequest)
+		return
+	}
+
+	if cameraID == "" {
+		http.Error(w, "Missing camera parameter", http.StatusBadRequest)
+		return
+	}
+
+	if filepath.Dir(filename) != "." {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	if !strings.HasSuffix(strings.ToLower(filename), ".mjpeg") {
+		http.Error(w, "Frame lookup only supported for MJPEG segments", http.StatusBadRequest)
+		return
+	}
+
+	offsetMs, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil || offsetMs < 0 {
+		http.Error(w, "Invalid offset_ms parameter", http.StatusBadRequest)
+		return
+	}
+
+	videoPath := camera.ResolveSegmentPath(s.cameraDir(cameraID), filename)
+	if _, err := os.Stat(videoPath); err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	fps := DefaultVideoFPS
+	for _, cam := range s.config.Cameras {
+		if cam.ID == cameraID && cam.FPS > 0 {
+			fps = cam.FPS
+			break
+		}
+	}
+
+	// Round to the closest frame rather than truncating
+	frameIndex := int((offsetMs*int64(fps) + 500) / 1000)
+
+	frameData := camera.ExtractFrameAtIndex(videoPath, frameIndex)
+	if len(frameData) == 0 {
+		http.Error(w, "Offset is beyond the end of the segment", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(frameData)))
+	w.Header().Set("X-Frame-Index", strconv.Itoa(frameIndex))
+	w.Header().Set("X-Frame-Offset-Ms", strconv.FormatInt(int64(frameIndex)*1000/int64(fps), 10))
+	w.Write(frameData)
+}
+
 func (s *APIServer) handleRemuxSegment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
@@ -95,7 +163,7 @@ func (s *APIServer) handleRemuxSegment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	videoPath := filepath.Join(s.config.VideoDir, cameraID, filename)
+	videoPath := camera.ResolveSegmentPath(s.cameraDir(cameraID), filename)
 
 	if _, err := os.Stat(videoPath); err != nil {
 		http.Error(w, "File not found", http.StatusNotFound)
@@ -132,7 +200,7 @@ func (s *APIServer) handleRemuxSegment(w http.ResponseWriter, r *http.Request) {
 func (s *APIServer) remuxSegmentAsync(inputPath, outputPath string) {
 	defer func() {
 		if r := recover(); r != nil {
-			s.logger.Printf("Remux panicked: %v", r)
+			s.logger.Errorf("Remux panicked: %v", r)
 			s.remuxMutex.Lock()
 			s.remuxInfo = &RemuxInfo{Progress: "Error: remux failed unexpectedly"}
 			s.remuxMutex.Unlock()
@@ -147,7 +215,7 @@ func (s *APIServer) remuxSegmentAsync(inputPath, outputPath string) {
 
 	outputDir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		s.logger.Printf("Failed to create remux output dir: %v", err)
+		s.logger.Errorf("Failed to create remux output dir: %v", err)
 		s.remuxMutex.Lock()
 		s.remuxInfo = &RemuxInfo{Progress: "Error: failed to create output dir"}
 		s.remuxMutex.Unlock()
@@ -157,7 +225,7 @@ func (s *APIServer) remuxSegmentAsync(inputPath, outputPath string) {
 	os.Remove(outputPath)
 
 	setRemuxProgress("Remuxing segment")
-	cmd := lowPriorityCommand(
+	name, args := lowPriorityArgs(s.config,
 		"ffmpeg",
 		"-y",
 		"-threads", "1",
@@ -172,18 +240,17 @@ func (s *APIServer) remuxSegmentAsync(inputPath, outputPath string) {
 	)
 
 	var stderrBuf strings.Builder
-	cmd.Stderr = &stderrBuf
-
-	if err := cmd.Start(); err != nil {
-		s.logger.Printf("Failed to start remux ffmpeg: %v", err)
+	proc, err := s.runner.Start(context.Background(), name, args, nil, &stderrBuf)
+	if err != nil {
+		s.logger.Errorf("Failed to start remux ffmpeg: %v", err)
 		s.remuxMutex.Lock()
 		s.remuxInfo = &RemuxInfo{Progress: "Error: failed to start FFmpeg"}
 		s.remuxMutex.Unlock()
 		return
 	}
 
-	if err := cmd.Wait(); err != nil {
-		s.logger.Printf("Remux FFmpeg error: %s", stderrBuf.String())
+	if err := proc.Wait(); err != nil {
+		s.logger.Errorf("Remux FFmpeg error: %s", stderrBuf.String())
 		s.remuxMutex.Lock()
 		s.remuxInfo = &RemuxInfo{Progress: "Error: FFmpeg failed - " + stderrBuf.String()}
 		s.remuxMutex.Unlock()
@@ -259,56 +326,33 @@ func (s *APIServer) handleRemuxStatus(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(info)
 }
 
+// handleLatestVideo serves the newest complete segment, skipping any still being
+// recorded, across every camera or only the one given by ?camera=
 func (s *APIServer) handleLatestVideo(w http.ResponseWriter, r *http.Request) {
-	// List all video files in directory
-	entries, err := os.ReadDir(s.config.VideoDir)
+	cameraID := r.URL.Query().Get("camera")
+	if cameraID != "" && (filepath.Dir(cameraID) != "." || strings.HasPrefix(cameraID, ".")) {
+		http.Error(w, "Invalid camera", http.StatusBadRequest)
+		return
+	}
+
+	dirs, err := s.cameraDirs()
 	if err != nil {
 		http.Error(w, "Failed to list videos", http.StatusInternalServerError)
 		return
 	}
-
-	// Collect all video files sorted by modification time
-	type fileInfo struct {
-		name    string
-		modTime time.Time
+	if cameraID != "" {
+		dirs = map[string]string{cameraID: s.cameraDir(cameraID)}
 	}
-	var files []fileInfo
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-		name := entry.Name()
-		if !IsPlayableVideo(name) {
-			continue
-		}
-
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
-		files = append(files, fileInfo{name: name, modTime: info.ModTime()})
+	videoPath, err := latestCompleteSegment(dirs)
+	if err != nil {
+		http.Error(w, "Failed to list videos", http.StatusInternalServerError)
+		return
 	}
-
-	if len(files) == 0 {
+	if videoPath == "" {
 		http.Error(w, "No videos available", http.StatusNotFound)
 		return
 	}
 
-	// Sort by modification time (newest first)
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].modTime.After(files[j].modTime)
-	})
-
-	// Serve the second-newest file (previous segment) to avoid serving incomplete current recording
-	fileToServe := files[0].name
-	if len(files) > 1 {
-		fileToServe = files[1].name
-	}
-
-	videoPath := filepath.Join(s.config.VideoDir, fileToServe)
-
 	// Set content type based on file extension
 	contentType := "video/mp4"
 	if HasExtension(videoPath, ExtensionWebM) {
@@ -324,6 +368,75 @@ func (s *APIServer) handleLatestVideo(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, videoPath)
 }
 
+// completedSegment is a recorded segment that is no longer being written
+type completedSegment struct {
+	name    string
+	path    string
+	modTime time.Time
+	order   segmentOrder
+}
+
+// latestCompleteSegment returns the path of the newest segment across dirs
+// (camera ID -> directory) that is no longer being written. "" means there is
+// none.
+func latestCompleteSegment(dirs map[string]string) (string, error) {
+	var latest *completedSegment
+	for id, dir := range dirs {
+		segments, err := completedSegments(dir, id)
+		if err != nil {
+			return "", err
+		}
+		// Sequence numbers only order one camera's segments; across cameras the
+		// start time decides
+		if len(segments) > 0 && (latest == nil || latest.order.start.Before(segments[0].order.start)) {
+			latest = &segments[0]
+		}
+	}
+
+	if latest == nil {
+		return "", nil
+	}
+	return latest.path, nil
+}
+
+// completedSegments lists a camera's segments newest first, leaving out the one
+// still being recorded. The newest segment counts as in progress while it was
+// modified within ActiveSegmentWindow; a stopped or paused camera leaves it
+// untouched, so it's included once that passes. A missing directory is empty.
+func completedSegments(cameraDir, cameraID string) ([]completedSegment, error) {
+	files, err := camera.ListSegmentFiles(cameraDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var segments []completedSegment
+	for _, file := range files {
+		name := file.Info.Name()
+		if !isVideoFile(name) {
+			continue
+		}
+		segments = append(segments, completedSegment{
+			name:    name,
+			path:    file.Path,
+			modTime: file.Info.ModTime(),
+			order:   newSegmentOrder(cameraID, name, file.Info.ModTime()),
+		})
+	}
+
+	// Newest first, in recording order rather than by (possibly jumped) mod time
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[j].order.before(segments[i].order)
+	})
+
+	if len(segments) > 0 && time.Since(segments[0].modTime) < ActiveSegmentWindow {
+		segments = segments[1:]
+	}
+	return segments, nil
+}
+
 func (s *APIServer) handleServeSegment(w http.ResponseWriter, r *http.Request) {
 	// Extract filename from path /api/videos/filename
 	filename := filepath.Base(r.URL.Path)
@@ -359,60 +472,256 @@ func (s *APIServer) handleServeSegment(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, videoPath)
 }
 
+// batchDeleteItem names one segment for /api/videos/delete-batch
+type batchDeleteItem struct {
+	Camera string `json:"camera"`
+	File   string `json:"file"`
+}
+
+// batchDeleteResult reports the outcome for one requested segment
+type batchDeleteResult struct {
+	Camera  string `json:"camera"`
+	File    string `json:"file"`
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleDeleteVideosBatch deletes many segments in one call. The body is either a
+// JSON array of {camera, file} or an object {"camera", "start", "end"} selecting
+// every segment that started in [start, end) (RFC3339; camera optional = all).
+func (s *APIServer) handleDeleteVideosBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.config.MaxRequestBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var items []batchDeleteItem
+	if trimmed := strings.TrimSpace(string(body)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(body, &items); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	} else {
+		var rangeReq struct {
+			Camera string `json:"camera"`
+			Start  string `json:"start"`
+			End    string `json:"end"`
+		}
+		if err := json.Unmarshal(body, &rangeReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if rangeReq.Start == "" || rangeReq.End == "" {
+			http.Error(w, "Expected an array of {camera, file} or start and end times", http.StatusBadRequest)
+			return
+		}
+		startTime, err := time.Parse(time.RFC3339, rangeReq.Start)
+		if err != nil {
+			http.Error(w, "Invalid start time format", http.StatusBadRequest)
+			return
+		}
+		endTime, err := time.Parse(time.RFC3339, rangeReq.End)
+		if err != nil {
+			http.Error(w, "Invalid end time format", http.StatusBadRequest)
+			return
+		}
+		if !endTime.After(startTime) {
+			http.Error(w, "End time must be after start time", http.StatusBadRequest)
+			return
+		}
+
+		videos, err := s.listVideoFiles()
+		if err != nil {
+			http.Error(w, "Failed to list videos", http.StatusInternalServerError)
+			return
+		}
+		for _, v := range videos {
+			if rangeReq.Camera != "" && v.CameraID != rangeReq.Camera {
+				continue
+			}
+			if v.StartTime.Before(startTime) || !v.StartTime.Before(endTime) {
+				continue
+			}
+			items = append(items, batchDeleteItem{Camera: v.CameraID, File: v.Name})
+		}
+	}
+
+	results := make([]batchDeleteResult, 0, len(items))
+	deleted := 0
+	for _, item := range items {
+		result := batchDeleteResult{Camera: item.Camera, File: item.File}
+		if err := s.deleteSegment(item.Camera, item.File); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Deleted = true
+			deleted++
+		}
+		results = append(results, result)
+	}
+
+	if deleted > 0 {
+		s.logger.Printf("Batch delete removed %d of %d segment(s)", deleted, len(items))
+		s.storage.RecalculateUsage()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": deleted,
+		"failed":  len(items) - deleted,
+		"results": results,
+	})
+}
+
+// deleteSegment removes one recorded segment, with the same traversal guards as
+// the download handler
+func (s *APIServer) deleteSegment(cameraID, filename string) error {
+	videoPath, err := s.segmentPath(cameraID, filename)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(videoPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file not found")
+		}
+		return fmt.Errorf("failed to delete file")
+	}
+	os.Remove(camera.SidecarPath(videoPath))
+	removeEmptyDayDir(filepath.Dir(videoPath))
+	return nil
+}
+
+// segmentPath validates a camera/file pair from a request and returns the
+// segment's path, refusing anything outside the camera directories
+func (s *APIServer) segmentPath(cameraID, filename string) (string, error) {
+	if cameraID == "" || filename == "" {
+		return "", fmt.Errorf("missing camera or file")
+	}
+	if filepath.Dir(filename) != "." || filepath.Dir(cameraID) != "." ||
+		cameraID == ".." || filename == ".." || strings.HasPrefix(cameraID, ".") {
+		return "", fmt.Errorf("invalid camera or file")
+	}
+	if !isVideoFile(filename) {
+		return "", fmt.Errorf("not a video file")
+	}
+	return camera.ResolveSegmentPath(s.cameraDir(cameraID), filename), nil
+}
+
+// handleVideoChecksum returns the SHA-256 of one segment (?camera=&file=), so a
+// downloaded copy can be checked against the original on the device
+func (s *APIServer) handleVideoChecksum(w http.ResponseWriter, r *http.Request) {
+	cameraID := r.URL.Query().Get("camera")
+	filename := r.URL.Query().Get("file")
+
+	videoPath, err := s.segmentPath(cameraID, filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sum, info, err := s.checksums.sum(videoPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"camera":   cameraID,
+		"file":     filename,
+		"size":     info.Size(),
+		"mod_time": info.ModTime(),
+		"sha256":   sum,
+	})
+}
+
 func (s *APIServer) listVideoFiles() ([]VideoInfo, error) {
 	var videos []VideoInfo
 
 	// List camera directories
 	cameras := s.cameraManager.ListCameras()
 	for _, cam := range cameras {
-		cameraDir := filepath.Join(s.config.VideoDir, cam.ID)
+		cameraDir := s.cameraDir(cam.ID)
 
 		// Skip if camera directory doesn't exist
 		if _, err := os.Stat(cameraDir); os.IsNotExist(err) {
 			continue
 		}
 
-		entries, err := os.ReadDir(cameraDir)
+		files, err := camera.ListSegmentFiles(cameraDir)
 		if err != nil {
 			s.logger.Debugf("Failed to read camera directory %s: %v", cameraDir, err)
 			continue
 		}
 
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-
-			if !isVideoFile(entry.Name()) {
+		for _, file := range files {
+			info := file.Info
+			if !isVideoFile(info.Name()) {
 				continue
 			}
 
-			info, err := entry.Info()
-			if err != nil {
-				continue
+			// Prefer the sidecar written when the segment finished, then the start time
+			// embedded in the filename; otherwise estimate the duration from the frame
+			// count (MJPEG has no bitrate to go by). A clock jump mid-segment can put
+			// the mod time before the start; estimate then too.
+			var startTime time.Time
+			endTime := info.ModTime()
+			var duration, frames int
+			var events []time.Time
+			if meta, ok := camera.ReadSegmentMeta(file.Path); ok && !meta.EndTime.Before(meta.StartTime) {
+				startTime, endTime = meta.StartTime, meta.EndTime
+				duration = int(meta.EndTime.Sub(meta.StartTime).Seconds())
+				frames, events = meta.Frames, meta.Events
+			} else if start, _, ok := camera.ParseSegmentName(info.Name()); ok && !info.ModTime().Before(start) {
+				startTime = start
+				duration = int(info.ModTime().Sub(start).Seconds())
+			} else {
+				if cam.FPS > 0 {
+					duration = camera.EstimateFrameCount(file.Path, info.Size()) / cam.FPS
+				}
+				startTime = info.ModTime().Add(-time.Duration(duration) * time.Second)
 			}
 
-			// Rough estimate: bytes / (bitrate * multiplier) = seconds
-			duration := int(info.Size() / int64(cam.Bitrate*BitrateToStorageMultiplier))
-			startTime := info.ModTime().Add(-time.Duration(duration) * time.Second)
-
 			videos = append(videos, VideoInfo{
-				Name:     entry.Name(),
-				Path:     fmt.Sprintf("/api/video/download?camera=%s&file=%s&token=%s", cam.ID, entry.Name(), s.config.AuthToken),
+				Name:     info.Name(),
+				Path:     fmt.Sprintf("/api/video/download?camera=%s&file=%s&token=%s", cam.ID, info.Name(), s.config.AuthToken),
 				Size:     info.Size(),
 				ModTime:  info.ModTime(),
 				StartTime: startTime,
-				EndTime:   info.ModTime(),
+				EndTime:   endTime,
 				Duration: duration,
 				CameraID: cam.ID,
+				Frames:   frames,
+				Events:   events,
 			})
 		}
 	}
 
-	// Sort by modification time (newest first)
-	sort.Slice(videos, func(i, j int) bool {
-		return videos[i].ModTime.After(videos[j].ModTime)
-	})
+	// Newest first, in recording order rather than by (possibly jumped) mod time
+	orders := make([]segmentOrder, len(videos))
+	for i, video := range videos {
+		orders[i] = newSegmentOrder(video.CameraID, video.Name, video.ModTime)
+	}
+	indexes := recordingOrder(orders)
+	sorted := make([]VideoInfo, len(videos))
+	for n, i := range indexes {
+		sorted[len(indexes)-1-n] = videos[i]
+	}
+	videos = sorted
 
 	return videos, nil
 }
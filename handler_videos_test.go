@@ -0,0 +1,110 @@
+package main
+
+import (
+	"dash-of-pi/camera"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSegment creates a segment named for start and seq in dir, last modified
+// at modTime, and returns its path
+func writeSegment(t *testing.T, dir, cameraID string, start time.Time, seq int, modTime time.Time) string {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, camera.SegmentFilename(cameraID, start, seq))
+	if err := os.WriteFile(path, []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLatestCompleteSegmentNone(t *testing.T) {
+	root := t.TempDir()
+	empty := filepath.Join(root, "empty")
+	if err := os.MkdirAll(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Not a segment
+	if err := os.WriteFile(filepath.Join(empty, "notes.txt"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]map[string]string{
+		"no cameras":        {},
+		"empty directory":   {"front": empty},
+		"missing directory": {"front": filepath.Join(root, "missing")},
+	}
+	for name, dirs := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := latestCompleteSegment(dirs)
+			if err != nil {
+				t.Fatalf("latestCompleteSegment: %v", err)
+			}
+			if got != "" {
+				t.Errorf("got %q, want no segment", got)
+			}
+		})
+	}
+}
+
+func TestLatestCompleteSegmentSingle(t *testing.T) {
+	now := time.Now()
+
+	t.Run("still being written", func(t *testing.T) {
+		dir := t.TempDir()
+		writeSegment(t, dir, "front", now, 0, now)
+		got, err := latestCompleteSegment(map[string]string{"front": dir})
+		if err != nil {
+			t.Fatalf("latestCompleteSegment: %v", err)
+		}
+		if got != "" {
+			t.Errorf("got %q, want none while the only segment is being recorded", got)
+		}
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		dir := t.TempDir()
+		old := now.Add(-2 * ActiveSegmentWindow)
+		path := writeSegment(t, dir, "front", old, 0, old)
+		got, err := latestCompleteSegment(map[string]string{"front": dir})
+		if err != nil {
+			t.Fatalf("latestCompleteSegment: %v", err)
+		}
+		if got != path {
+			t.Errorf("got %q, want %q once the camera stopped writing it", got, path)
+		}
+	})
+}
+
+func TestLatestCompleteSegmentSkipsActive(t *testing.T) {
+	now := time.Now()
+	front, rear := t.TempDir(), t.TempDir()
+	writeSegment(t, front, "front", now.Add(-3*time.Minute), 0, now.Add(-2*time.Minute))
+	want := writeSegment(t, front, "front", now.Add(-2*time.Minute), 1, now.Add(-time.Minute))
+	writeSegment(t, front, "front", now.Add(-time.Minute), 2, now) // in progress
+	writeSegment(t, rear, "rear", now.Add(-5*time.Minute), 0, now.Add(-4*time.Minute))
+	writeSegment(t, rear, "rear", now.Add(-time.Minute), 1, now) // in progress
+
+	got, err := latestCompleteSegment(map[string]string{"front": front, "rear": rear})
+	if err != nil {
+		t.Fatalf("latestCompleteSegment: %v", err)
+	}
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	segments, err := completedSegments(front, "front")
+	if err != nil {
+		t.Fatalf("completedSegments: %v", err)
+	}
+	if len(segments) != 2 || segments[0].path != want {
+		t.Errorf("completedSegments returned %d segments, newest %v; want 2 starting with %s", len(segments), segments, filepath.Base(want))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rotatingFile is an io.Writer that appends to a log file and rotates it once it
+// reaches maxBytes, keeping maxBackups old copies (path.1 newest) no older than
+// maxAge. Writes are queued and done by a background goroutine so a slow SD
+// card never holds up the code that logs; if the queue fills, lines are dropped
+// and the count is noted in the file once it catches up.
+type rotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	maxAge     time.Duration // 0 = backups never expire
+
+	queue   chan []byte
+	done    chan struct{}
+	closeMu sync.Mutex
+	closed  bool
+	dropped atomic.Int64 // lines Write couldn't queue, not yet noted in the file
+
+	// Owned by the writer goroutine
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens (creating it and its directory if needed) the log file
+// at path and starts the goroutine that writes to it
+func openRotatingFile(path string, maxSizeMB, maxBackups, maxAgeDays int) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxBytes:   int64(maxSizeMB) * BytesPerMB,
+		maxBackups: maxBackups,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+		queue:      make(chan []byte, LogFileQueueLines),
+		done:       make(chan struct{}),
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	go rf.run()
+	return rf, nil
+}
+
+// Write queues p for the file and never blocks
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	rf.closeMu.Lock()
+	defer rf.closeMu.Unlock()
+	if rf.closed {
+		return len(p), nil
+	}
+	line := append([]byte(nil), p...)
+	select {
+	case rf.queue <- line:
+	default:
+		rf.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Close writes out everything queued and closes the file
+func (rf *rotatingFile) Close() error {
+	rf.closeMu.Lock()
+	if rf.closed {
+		rf.closeMu.Unlock()
+		return nil
+	}
+	rf.closed = true
+	close(rf.queue)
+	rf.closeMu.Unlock()
+
+	<-rf.done
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Close()
+}
+
+func (rf *rotatingFile) run() {
+	defer close(rf.done)
+	for line := range rf.queue {
+		rf.noteDropped()
+		rf.write(line)
+	}
+	rf.noteDropped()
+}
+
+// noteDropped writes how many lines were dropped since the last note, if any
+func (rf *rotatingFile) noteDropped() {
+	if n := rf.dropped.Swap(0); n > 0 {
+		rf.write([]byte(fmt.Sprintf("[%s] [WARN] Log file fell behind; dropped %d line(s)\n",
+			time.Now().Format("2006-01-02 15:04:05"), n)))
+	}
+}
+
+func (rf *rotatingFile) write(line []byte) {
+	if rf.maxBytes > 0 && rf.size+int64(len(line)) > rf.maxBytes && rf.size > 0 {
+		if err := rf.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Log rotation failed: %v\n", err)
+		}
+	}
+	// A failed rotation leaves no file open; keep trying on later lines
+	if rf.file == nil && rf.open() != nil {
+		return
+	}
+	n, _ := rf.file.Write(line)
+	rf.size += int64(n)
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	rf.file, rf.size = f, info.Size()
+	return nil
+}
+
+// rotate shifts path.N-1 to path.N (dropping the oldest), moves the current file
+// to path.1, prunes expired backups and starts a fresh file
+func (rf *rotatingFile) rotate() error {
+	rf.file.Close()
+	rf.file = nil
+
+	if rf.maxBackups > 0 {
+		os.Remove(rf.backupPath(rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(rf.backupPath(i), rf.backupPath(i+1))
+		}
+		os.Rename(rf.path, rf.backupPath(1))
+	} else {
+		os.Remove(rf.path)
+	}
+
+	if rf.maxAge > 0 {
+		for i := 1; i <= rf.maxBackups; i++ {
+			if info, err := os.Stat(rf.backupPath(i)); err == nil && time.Since(info.ModTime()) > rf.maxAge {
+				os.Remove(rf.backupPath(i))
+			}
+		}
+	}
+
+	// Recreate the directory in case it was removed while running
+	if err := os.MkdirAll(filepath.Dir(rf.path), 0755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return rf.open()
+}
+
+func (rf *rotatingFile) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", rf.path, n)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileNotesDroppedLines(t *testing.T) {
+	// The writer goroutine isn't started until the queue has overflowed
+	rf := &rotatingFile{
+		path:  filepath.Join(t.TempDir(), "dash-of-pi.log"),
+		queue: make(chan []byte, 2),
+		done:  make(chan struct{}),
+	}
+	if err := rf.open(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if n, err := fmt.Fprintf(rf, "line %d\n", i); err != nil || n != len("line 1\n") {
+			t.Fatalf("Write = %d, %v", n, err)
+		}
+	}
+	go rf.run()
+	if err := rf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(rf.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("log has %d lines, want the note and the 2 queued:\n%s", len(lines), data)
+	}
+	if !strings.Contains(lines[0], "[WARN]") || !strings.Contains(lines[0], "dropped 3 line(s)") {
+		t.Errorf("first line %q, want a note that 3 lines were dropped", lines[0])
+	}
+	if lines[1] != "line 1" || lines[2] != "line 2" {
+		t.Errorf("queued lines %q, want line 1 and line 2", lines[1:])
+	}
+}
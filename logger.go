@@ -2,37 +2,137 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
+// LogLevel orders log messages by severity; a logger prints messages at or
+// above its level (LevelError is the quietest, LevelDebug the noisiest)
+type LogLevel int
+
+const (
+	LevelError LogLevel = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+)
+
+var logLevelNames = []string{"error", "warn", "info", "debug"}
+
+func (lv LogLevel) String() string {
+	if lv < LevelError || lv > LevelDebug {
+		return fmt.Sprintf("level(%d)", int(lv))
+	}
+	return logLevelNames[lv]
+}
+
+// ParseLogLevel accepts error, warn (or warning), info and debug, in any case
+func ParseLogLevel(s string) (LogLevel, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		return LevelWarn, nil
+	}
+	for i, name := range logLevelNames {
+		if s == name {
+			return LogLevel(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (expected error, warn, info or debug)", s)
+}
+
 type Logger struct {
-	verbose bool
-	mu      sync.Mutex
-	logger  *log.Logger
+	level  LogLevel // guarded by mu; changed live through /api/logs/level
+	mu     sync.Mutex
+	logger *log.Logger
+	file   *rotatingFile // optional copy of the output; nil when log_file is unset
 }
 
-func NewLogger(verbose bool) *Logger {
+func NewLogger(level LogLevel) *Logger {
 	return &Logger{
-		verbose: verbose,
-		logger:  log.New(os.Stdout, "", 0),
+		level:  level,
+		logger: log.New(os.Stdout, "", 0),
 	}
 }
 
-func (l *Logger) Printf(format string, v ...interface{}) {
+// SetLevel changes which messages are printed from now on
+func (l *Logger) SetLevel(level LogLevel) {
+	l.mu.Lock()
+	l.level = level
+	l.mu.Unlock()
+}
+
+// SetLogFile copies all output to a size-rotated file at path, in addition to
+// stdout (see rotatingFile)
+func (l *Logger) SetLogFile(path string, maxSizeMB, maxBackups, maxAgeDays int) error {
+	rf, err := openRotatingFile(path, maxSizeMB, maxBackups, maxAgeDays)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	old := l.file
+	l.file = rf
+	l.logger = log.New(io.MultiWriter(os.Stdout, rf), "", 0)
+	l.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Close flushes and closes the log file, if any; later output goes to stdout only
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	rf := l.file
+	l.file = nil
+	l.logger = log.New(os.Stdout, "", 0)
+	l.mu.Unlock()
+	if rf == nil {
+		return nil
+	}
+	return rf.Close()
+}
+
+// Level returns the current log level
+func (l *Logger) Level() LogLevel {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.level
+}
+
+func (l *Logger) logf(level LogLevel, tag, format string, v ...interface{}) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	msg := fmt.Sprintf("[%s] %s", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, v...))
+	if level > l.level {
+		return
+	}
+	msg := fmt.Sprintf("[%s] [%s] %s", time.Now().Format("2006-01-02 15:04:05"), tag, fmt.Sprintf(format, v...))
 	l.logger.Println(msg)
 }
 
+// Printf logs at INFO
+func (l *Logger) Printf(format string, v ...interface{}) {
+	l.logf(LevelInfo, "INFO", format, v...)
+}
+
 func (l *Logger) Debugf(format string, v ...interface{}) {
-	// Debug logging disabled in production
+	l.logf(LevelDebug, "DEBUG", format, v...)
+}
+
+func (l *Logger) Warnf(format string, v ...interface{}) {
+	l.logf(LevelWarn, "WARN", format, v...)
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.logf(LevelError, "ERROR", format, v...)
 }
 
+// Fatalf logs regardless of level and exits
 func (l *Logger) Fatalf(format string, v ...interface{}) {
-	l.Printf("[FATAL] "+format, v...)
+	l.logf(LevelError, "FATAL", format, v...)
+	l.Close()
 	os.Exit(1)
 }
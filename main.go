@@ -18,6 +18,11 @@ func main() {
 	// Load .env file if it exists
 	godotenv.Load()
 
+	// `dash-of-pi export ...` exports footage and exits without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExportCommand(os.Args[2:]))
+	}
+
 	// Parse command-line flags
 	var (
 		configPath = flag.String("config", "", "Path to config file (default: XDG config directory)")
@@ -25,16 +30,10 @@ func main() {
 	flag.Parse()
 
 	// Initialize logger
-	logger := NewLogger(false)
+	logger := NewLogger(LevelInfo)
 
-	// Use XDG config directory if not specified
 	if *configPath == "" {
-		var err error
-		*configPath, err = xdg.ConfigFile("dash-of-pi/config.json")
-		if err != nil {
-			// Fallback to legacy location
-			*configPath = filepath.Join(os.ExpandEnv("$HOME"), ".config/dash-of-pi/config.json")
-		}
+		*configPath = defaultConfigPath()
 	}
 
 	// Create directories if they don't exist
@@ -47,49 +46,84 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Failed to load config: %v", err)
 	}
+	if level, err := ParseLogLevel(config.LogLevel); err == nil {
+		logger.SetLevel(level)
+	}
+	if config.LogFile != "" {
+		if err := logger.SetLogFile(config.LogFile, config.LogMaxSizeMB, config.LogMaxBackups, config.LogMaxAgeDays); err != nil {
+			logger.Errorf("Logging to stdout only, can't use log file %s: %v", config.LogFile, err)
+		}
+	}
+
+	// Track restarts across runs so crash loops show up in /api/status
+	runtimeState, err := LoadRuntimeState(filepath.Dir(*configPath))
+	if err != nil {
+		logger.Fatalf("Failed to load runtime state: %v", err)
+	}
 
 	logger.Printf("Starting Pi Dashboard Cam...")
+	if runtimeState.LastUncleanShutdown {
+		logger.Warnf("Previous run did not shut down cleanly (restart #%d)", runtimeState.RestartCount)
+	}
 	logger.Printf("Listening on port %d", config.Port)
 	logger.Printf("Auth token: %s", config.AuthToken)
 	logger.Printf("Video directory: %s", config.VideoDir)
-	logger.Printf("Storage cap: %dGB", config.StorageCapGB)
+	logger.Printf("Storage cap: %dGB (full disk policy: %s)", config.StorageCapGB, config.FullDiskPolicy)
 
 	// Create storage manager
-	sm, err := NewStorageManager(config.VideoDir, config.StorageCapGB)
+	sm, err := NewStorageManager(config.VideoDir, config.StorageCapGB, config.FullDiskPolicy, config.StorageCheckIntervalS)
 	if err != nil {
 		logger.Fatalf("Failed to initialize storage manager: %v", err)
 	}
-
-	// Convert config cameras to camera.CameraConfig
-	cameraConfigs := make([]camera.CameraConfig, len(config.Cameras))
-	for i, cam := range config.Cameras {
-		cameraConfigs[i] = camera.CameraConfig{
-			ID:             cam.ID,
-			Name:           cam.Name,
-			Device:         cam.Device,
-			Rotation:       cam.Rotation,
-			ResWidth:       cam.ResWidth,
-			ResHeight:      cam.ResHeight,
-			Bitrate:        cam.Bitrate,
-			FPS:            cam.FPS,
-			MJPEGQuality:   cam.MJPEGQuality,
-			EmbedTimestamp: cam.EmbedTimestamp,
-			Enabled:        cam.Enabled,
-		}
-	}
+	sm.SetMinRetainSegments(minRetainSegments(config.Cameras))
+	sm.SetCameraDirs(cameraVideoDirs(config.Cameras))
+	sm.SetExportTempDir(config.ExportTempDir)
 
 	// Create camera manager
-	cameraManager, err := camera.NewCameraManager(cameraConfigs, config.SegmentLengthS, config.VideoDir, logger)
+	cameraManager, err := camera.NewCameraManager(convertCameraConfigs(config.Cameras), config.SegmentLengthS, config.VideoDir, config.Encoder, logger)
 	if err != nil {
 		logger.Fatalf("Failed to initialize camera manager: %v", err)
 	}
 
+	cameraManager.SetPreBufferSeconds(config.PreBufferSeconds)
+	cameraManager.SetSegmentSize(config.SegmentMode, config.SegmentMaxBytes)
+	cameraManager.SetAutoDisableMissing(config.AutoDisableMissing)
+	cameraManager.SetHotplugPollSeconds(config.HotplugPollS)
+	cameraManager.SetShutdownGraceSeconds(config.ShutdownGraceS)
+	cameraManager.SetOpenAttempts(config.CameraOpenAttempts)
+	cameraManager.SetProcessPriority(config.RecordNice, config.RecordCPUs)
+	cameraManager.SetStorageLayout(config.StorageLayout)
+	cameraManager.SetContinuousRecording(config.ContinuousRecording)
+	if config.ContinuousRecording && config.SegmentMode != camera.SegmentModeTime {
+		logger.Warnf("continuous_recording only applies to segment_mode time; recording one segment at a time")
+	}
+
+	// Under the "stop" full-disk policy the storage manager halts recording at the cap
+	sm.OnFullChange(func(full bool) {
+		if full {
+			cameraManager.PauseRecording(PauseReasonStorageFull)
+		} else {
+			cameraManager.ResumeRecording(PauseReasonStorageFull)
+		}
+	})
+
+	// Recording stopped through the API stays stopped across restarts
+	if !runtimeState.IsRecordingEnabled() {
+		logger.Printf("Recording is stopped (use /api/recording/start to resume)")
+		cameraManager.PauseRecording(PauseReasonStopped)
+	}
+
 	// Create API server
-	server := NewAPIServer(config, cameraManager, sm, logger, *configPath)
+	server := NewAPIServer(config, cameraManager, sm, logger, *configPath, runtimeState)
+	sm.SetExportTTLHours(config.ExportTTLHours, server.exportExpired)
 
 	// Start recording in background
 	recordingDone := make(chan error, 1)
 	go func() {
+		// Self-test runs before recording since each device can only be opened once
+		if config.SelfTestOnBoot {
+			cameraManager.RunSelfTest()
+		}
 		recordingDone <- cameraManager.Start()
 	}()
 
@@ -116,4 +150,19 @@ func main() {
 	logger.Printf("Shutting down...")
 	cameraManager.Stop()
 	server.Stop()
+	if err := runtimeState.MarkCleanShutdown(); err != nil {
+		logger.Errorf("Failed to record clean shutdown: %v", err)
+	}
+	logger.Close()
+}
+
+// defaultConfigPath is the config file used when -config isn't given: the XDG
+// config directory, or ~/.config if that can't be resolved
+func defaultConfigPath() string {
+	path, err := xdg.ConfigFile("dash-of-pi/config.json")
+	if err != nil {
+		// Fallback to legacy location
+		path = filepath.Join(os.ExpandEnv("$HOME"), ".config/dash-of-pi/config.json")
+	}
+	return path
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"sync"
+)
+
+const (
+	placeholderWidth  = 640
+	placeholderHeight = 360
+	placeholderText   = "CAMERA STARTING"
+	placeholderScale  = 5 // pixels per glyph dot
+)
+
+// placeholderGlyphs is a 5x7 bitmap font covering the letters of placeholderText
+var placeholderGlyphs = map[rune][7]string{
+	' ': {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".###."},
+	'I': {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "##..#", "#.#.#", "#.#.#", "#..##", "#...#", "#...#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+}
+
+var (
+	placeholderOnce sync.Once
+	placeholderJPEG []byte
+)
+
+// placeholderFrame returns the JPEG /api/stream/frame?placeholder=1 serves while
+// a camera has no frame yet: placeholderText on a dark background. It's drawn
+// once and reused.
+func placeholderFrame() []byte {
+	placeholderOnce.Do(func() {
+		img := image.NewRGBA(image.Rect(0, 0, placeholderWidth, placeholderHeight))
+		background := color.RGBA{0x20, 0x20, 0x20, 0xff}
+		for y := 0; y < placeholderHeight; y++ {
+			for x := 0; x < placeholderWidth; x++ {
+				img.SetRGBA(x, y, background)
+			}
+		}
+
+		// Each glyph is 5 dots wide plus 1 of spacing, centered as a single line
+		advance := 6 * placeholderScale
+		x0 := (placeholderWidth - len(placeholderText)*advance + placeholderScale) / 2
+		y0 := (placeholderHeight - 7*placeholderScale) / 2
+		foreground := color.RGBA{0xc0, 0xc0, 0xc0, 0xff}
+		for i, r := range placeholderText {
+			for row, dots := range placeholderGlyphs[r] {
+				for col, dot := range dots {
+					if dot != '#' {
+						continue
+					}
+					px, py := x0+i*advance+col*placeholderScale, y0+row*placeholderScale
+					for dy := 0; dy < placeholderScale; dy++ {
+						for dx := 0; dx < placeholderScale; dx++ {
+							img.SetRGBA(px+dx, py+dy, foreground)
+						}
+					}
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: DefaultMontageQuality}); err == nil {
+			placeholderJPEG = buf.Bytes()
+		}
+	})
+	return placeholderJPEG
+}
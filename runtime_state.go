@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RuntimeState is persisted next to the config file so restarts (and crash
+// loops) stay visible on a headless device after the process is gone.
+type RuntimeState struct {
+	FirstStart    time.Time `json:"first_start"`
+	LastStart     time.Time `json:"last_start"`
+	RestartCount  int       `json:"restart_count"`
+	CleanShutdown bool      `json:"clean_shutdown"`
+
+	// Master recording switch (/api/recording/start|stop); survives restarts
+	RecordingEnabled bool `json:"recording_enabled"`
+
+	// Not persisted: whether the run before this one ended without Shutdown
+	LastUncleanShutdown bool `json:"-"`
+
+	mu   sync.Mutex
+	path string
+}
+
+// LoadRuntimeState reads the previous run's state from dir, records this start,
+// and writes it back with CleanShutdown cleared until MarkCleanShutdown is called.
+func LoadRuntimeState(dir string) (*RuntimeState, error) {
+	// Fields missing from an older file keep these defaults
+	state := &RuntimeState{
+		RecordingEnabled: true,
+		path:             filepath.Join(dir, "runtime_state.json"),
+	}
+
+	if data, err := os.ReadFile(state.path); err == nil {
+		if err := json.Unmarshal(data, state); err != nil {
+			return nil, fmt.Errorf("failed to parse runtime state: %w", err)
+		}
+		state.RestartCount++
+		state.LastUncleanShutdown = !state.CleanShutdown
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read runtime state: %w", err)
+	}
+
+	now := time.Now()
+	if state.FirstStart.IsZero() {
+		state.FirstStart = now
+	}
+	state.LastStart = now
+	state.CleanShutdown = false
+
+	if err := state.save(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// MarkCleanShutdown records that this run is exiting normally
+func (rs *RuntimeState) MarkCleanShutdown() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.CleanShutdown = true
+	return rs.save()
+}
+
+// SetRecordingEnabled persists the master recording switch
+func (rs *RuntimeState) SetRecordingEnabled(enabled bool) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.RecordingEnabled = enabled
+	return rs.save()
+}
+
+// IsRecordingEnabled reports the master recording switch
+func (rs *RuntimeState) IsRecordingEnabled() bool {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.RecordingEnabled
+}
+
+func (rs *RuntimeState) save() error {
+	data, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal runtime state: %w", err)
+	}
+	if err := os.WriteFile(rs.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write runtime state: %w", err)
+	}
+	return nil
+}
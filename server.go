@@ -2,10 +2,13 @@ package main
 
 import (
 	"dash-of-pi/camera"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,16 +20,69 @@ type APIServer struct {
 	logger        *Logger
 	auth          *AuthMiddleware
 	server        *http.Server
-	indexHTML     string
-	exportInfo    *ExportInfo
-	exportMutex   sync.RWMutex
+	exportResult  *ExportResult // the finished export download-export serves; nil if none
+	exportResMu   sync.RWMutex
+	exportJob     *ExportJob // the export being generated, or how the last one ended
+	exportJobMu   sync.RWMutex
+	upload        *UploadStatus // delivery of the export to s3_bucket/upload_url; nil before any
+	uploadMu      sync.Mutex
 	remuxInfo     *RemuxInfo
 	remuxMutex    sync.RWMutex
 	configPath    string
+	configMu      sync.Mutex // held by the handlers that change, save and apply the config
+	runtimeState  *RuntimeState
+	streamStats   map[uint64]*StreamStats // connected MJPEG clients, keyed by connection ID
+	streamStatsMu sync.Mutex
+	nextStreamID  uint64
+	frameLimiter  *frameRateLimiter
+	runner        camera.Runner // launches export/remux ffmpeg; swappable for a fake
+	checksums     *checksumCache
+	done          chan struct{} // closed by Stop; ends background loops such as the export schedule
+	stopOnce      sync.Once
+
+	// Closed when maintenance mode ends; nil while it's off
+	maintenanceEnd chan struct{}
+	// Closed when maintenance mode next begins, stopping the running export
+	// ffmpeg; made on demand, nil while it's on
+	maintenanceBegin chan struct{}
+	maintenanceMu    sync.Mutex
+}
+
+// ExportResult describes the finished export in .export/ (and export_info.json).
+// It's only replaced once a new export succeeds, so the previous one stays
+// downloadable while the next is generated.
+type ExportResult struct {
+	Filename      string    `json:"filename"`
+	Format        string    `json:"format"` // "mp4" or "gif"
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	Size          int64     `json:"size"`
+	TotalSegments int       `json:"total_segments"`
+	SHA256        string    `json:"sha256,omitempty"` // hex digest of the finished export
 }
 
+// ExportJob is the export being generated. Once it ends, InProgress is false and
+// Progress says how ("Complete" or the error) until the next one starts.
+type ExportJob struct {
+	InProgress     bool      `json:"in_progress"`
+	Format         string    `json:"format"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	Progress       string    `json:"progress"`
+	CurrentSizeMB  float64   `json:"current_size_mb"`
+	TotalSegments  int       `json:"total_segments"`
+	ProcessedFiles int       `json:"processed_files"`
+	Percent        float64   `json:"percent,omitempty"`     // through the final encode, from ffmpeg -progress
+	ETASeconds     int       `json:"eta_seconds,omitempty"` // smoothed estimate; omitted when unknown
+}
+
+// ExportInfo is the export-status response. The flat fields are the job's
+// progress and the available export's file, as the dashboard reads them; format
+// and times are the running job's while there is one. Result and Job carry each
+// on its own.
 type ExportInfo struct {
 	Filename       string    `json:"filename"`
+	Format         string    `json:"format"` // "mp4" or "gif"
 	StartTime      time.Time `json:"start_time"`
 	EndTime        time.Time `json:"end_time"`
 	Size           int64     `json:"size"`
@@ -36,6 +92,13 @@ type ExportInfo struct {
 	CurrentSizeMB  float64   `json:"current_size_mb"`
 	TotalSegments  int       `json:"total_segments"`
 	ProcessedFiles int       `json:"processed_files"`
+	Percent        float64   `json:"percent,omitempty"`     // through the final encode, from ffmpeg -progress
+	ETASeconds     int       `json:"eta_seconds,omitempty"` // smoothed estimate; omitted when unknown
+	SHA256         string    `json:"sha256,omitempty"`      // hex digest of the finished export
+
+	Result *ExportResult `json:"result"`           // null when no export is available
+	Job    *ExportJob    `json:"job"`              // null until an export has been started
+	Upload *UploadStatus `json:"upload,omitempty"` // the current or last upload, if any
 }
 
 type RemuxInfo struct {
@@ -57,6 +120,10 @@ type VideoInfo struct {
 	EndTime   time.Time `json:"end_time"`
 	Duration  int       `json:"duration"`
 	CameraID  string    `json:"camera_id"`
+
+	// From the segment's metadata sidecar, when it has one
+	Frames int         `json:"frames,omitempty"`
+	Events []time.Time `json:"events,omitempty"`
 }
 
 type StorageStats struct {
@@ -65,19 +132,41 @@ type StorageStats struct {
 	UsedGB    float64 `json:"used_gb"`
 	CapGB     int     `json:"cap_gb"`
 	Percent   int     `json:"percent"`
+	Full      bool    `json:"storage_full"` // cap reached under full_disk_policy=stop; recording halted
 }
 
 type StatusResponse struct {
-	Status  string       `json:"status"`
-	Storage StorageStats `json:"storage"`
-	Videos  []VideoInfo  `json:"videos"`
-	Uptime  string       `json:"uptime"`
+	Status   string                  `json:"status"` // "recording", "stopped", "storage_full" or "maintenance"
+	Health   string                  `json:"health"` // "ok", or "degraded" if a camera failed its self-test
+	Storage  StorageStats            `json:"storage"`
+	Videos   []VideoInfo             `json:"videos"`
+	Uptime   string                  `json:"uptime"`
+	SelfTest []camera.SelfTestResult `json:"self_test,omitempty"`
+
+	// Cameras not recording because their device was missing (auto_disable_missing)
+	UnavailableCameras []string `json:"unavailable_cameras,omitempty"`
+
+	// Frames ffmpeg dropped across all cameras, with the per-camera breakdown
+	DroppedFrames int64               `json:"dropped_frames"`
+	FrameStats    []camera.FrameStats `json:"frame_stats"`
+
+	// When each camera's live frame was last refreshed; a stale time means a frozen preview
+	FrameUpdater []camera.FrameUpdaterHealth `json:"frame_updater"`
+
+	// Restart history persisted across process restarts (see RuntimeState)
+	RestartCount        int       `json:"restart_count"`
+	LastUncleanShutdown bool      `json:"last_unclean_shutdown"`
+	LastStart           time.Time `json:"last_start"`
+	RecordingEnabled    bool      `json:"recording_enabled"`
+
+	// Recording, cleanup and exports are paused (see /api/system/maintenance)
+	Maintenance bool `json:"maintenance"`
 }
 
 var startTime = time.Now()
 
-func NewAPIServer(config *Config, cameraManager *camera.CameraManager, storage *StorageManager, logger *Logger, configPath string) *APIServer {
-	auth := NewAuthMiddleware(config.AuthToken)
+func NewAPIServer(config *Config, cameraManager *camera.CameraManager, storage *StorageManager, logger *Logger, configPath string, runtimeState *RuntimeState) *APIServer {
+	auth := NewAuthMiddleware(config.AuthToken, config.BasicAuthUser)
 
 	server := &APIServer{
 		config:        config,
@@ -85,9 +174,14 @@ func NewAPIServer(config *Config, cameraManager *camera.CameraManager, storage *
 		storage:       storage,
 		logger:        logger,
 		auth:          auth,
-		exportInfo:    &ExportInfo{Available: false},
 		remuxInfo:     &RemuxInfo{Available: false},
 		configPath:    configPath,
+		runtimeState:  runtimeState,
+		streamStats:   make(map[uint64]*StreamStats),
+		frameLimiter:  newFrameRateLimiter(),
+		runner:        camera.ExecRunner{},
+		checksums:     newChecksumCache(),
+		done:          make(chan struct{}),
 	}
 
 	// Check for existing export on startup
@@ -105,65 +199,146 @@ func (s *APIServer) Start() error {
 	// UI endpoints (no auth for now)
 	mux.HandleFunc("/", s.handleUI)
 
-	// Serve static files from web directory
+	// Serve static files from web directory, filling in anything it lacks from
+	// the copy embedded in the binary
 	possibleWebDirs := []string{
 		"./web",
 		"/var/lib/dash-of-pi/web",
 		filepath.Join(filepath.Dir(os.Args[0]), "../web"),
 	}
 
+	webFS := embeddedWebFS()
 	for _, webDir := range possibleWebDirs {
 		if _, err := os.Stat(webDir); err == nil {
-			fs := http.FileServer(http.Dir(webDir))
-			mux.Handle("/web/", http.StripPrefix("/web/", fs))
+			webFS = fallbackFS{primary: http.Dir(webDir), secondary: webFS}
 			s.logger.Printf("Serving static files from: %s", webDir)
 			break
 		}
 	}
+	mux.Handle("/web/", http.StripPrefix("/web/", http.FileServer(webFS)))
 
 	// API endpoints (with auth)
 	apiMux := http.NewServeMux()
 	apiMux.HandleFunc("/api/status", s.handleStatus)
+	apiMux.HandleFunc("/api/time", s.handleTime)
+	apiMux.HandleFunc("/api/logs/level", s.handleLogLevel)
 	apiMux.HandleFunc("/api/videos", s.handleListVideos)
 	apiMux.HandleFunc("/api/video/download", s.handleDownloadVideo)
 	apiMux.HandleFunc("/api/video/remux", s.handleRemuxSegment)
 	apiMux.HandleFunc("/api/video/remux/status", s.handleRemuxStatus)
 	apiMux.HandleFunc("/api/video/remux/download", s.handleDownloadRemux)
 	apiMux.HandleFunc("/api/video/latest", s.handleLatestVideo)
+	apiMux.HandleFunc("/api/video/frame-at", s.handleFrameAt)
+	apiMux.HandleFunc("/api/video/checksum", s.handleVideoChecksum)
 	apiMux.HandleFunc("/api/videos/generate-export", s.handleGenerateExport)
 	apiMux.HandleFunc("/api/videos/export-status", s.handleExportStatus)
 	apiMux.HandleFunc("/api/videos/download-export", s.handleDownloadExport)
 	apiMux.HandleFunc("/api/videos/delete-export", s.handleDeleteExport)
+	apiMux.HandleFunc("/api/videos/upload-export", s.handleUploadExport)
+	apiMux.HandleFunc("/api/videos/download-day", s.handleDownloadDay)
+	apiMux.HandleFunc("/api/videos/delete-batch", s.handleDeleteVideosBatch)
 	apiMux.HandleFunc("/api/videos/", s.handleServeSegment)
 	apiMux.HandleFunc("/api/auth/token", s.handleGetAuthToken)
 	apiMux.HandleFunc("/api/auth/regenerate-token", s.handleRegenerateToken)
+	apiMux.HandleFunc("/api/auth/rotate", s.handleRegenerateToken)
 	apiMux.HandleFunc("/api/config", s.handleGetConfig)
 	apiMux.HandleFunc("/api/config/update", s.handleUpdateConfig)
 	apiMux.HandleFunc("/api/cameras", s.handleListCameras)
 	apiMux.HandleFunc("/api/cameras/discover", s.handleDiscoverCameras)
+	apiMux.HandleFunc("/api/cameras/command", s.handleCameraCommand)
+	apiMux.HandleFunc("/api/cameras/refresh-capabilities", s.handleRefreshCapabilities)
 	apiMux.HandleFunc("/api/cameras/add", s.handleAddCamera)
 	apiMux.HandleFunc("/api/cameras/update", s.handleUpdateCamera)
 	apiMux.HandleFunc("/api/cameras/delete", s.handleDeleteCamera)
+	apiMux.HandleFunc("/api/cameras/snapshot-all", s.handleSnapshotAll)
 	apiMux.HandleFunc("/api/stream/frame", s.handleStreamFrame)
+	apiMux.HandleFunc("/api/stream/frame/sign", s.handleSignFrameURL)
+	apiMux.HandleFunc(SignedFramePath, s.handleStreamFrame)
 	apiMux.HandleFunc("/api/stream/mjpeg", s.handleStreamMJPEG)
+	apiMux.HandleFunc("/api/stream/montage", s.handleStreamMontage)
+	apiMux.HandleFunc("/api/stream/stats", s.handleStreamStats)
+	apiMux.HandleFunc("/api/stream/latest-segment", s.handleLatestSegment)
+	apiMux.HandleFunc("/api/recording/start", s.handleRecordingStart)
+	apiMux.HandleFunc("/api/recording/stop", s.handleRecordingStop)
+	apiMux.HandleFunc("/api/system/maintenance", s.handleMaintenance)
+	apiMux.HandleFunc("/api/events", s.handleListEvents)
+	apiMux.HandleFunc("/api/events/mark", s.handleMarkEvent)
+	apiMux.HandleFunc("/api/events/download", s.handleDownloadEvent)
+	apiMux.HandleFunc("/api/snapshots", s.handleListSnapshots)
+	apiMux.HandleFunc("/api/snapshots/download", s.handleDownloadSnapshot)
+
+	apiMux.HandleFunc("/api/", s.handleAPINotFound)
 
 	mux.Handle("/api/", s.auth.Check(apiMux))
 
+	// public_stream: the live view skips auth by being registered outside the
+	// wrapped mux (more specific patterns win); everything else stays behind it
+	if s.config.PublicStream {
+		mux.HandleFunc("/api/stream/frame", s.handleStreamFrame)
+		mux.HandleFunc("/api/stream/mjpeg", s.handleStreamMJPEG)
+		mux.HandleFunc("/api/stream/montage", s.handleStreamMontage)
+		s.logger.Warnf("public_stream is on: live frames, MJPEG and the montage are served without auth")
+	}
+
 	s.server = &http.Server{
 		Addr:              fmt.Sprintf(":%d", s.config.Port),
 		Handler:           mux,
-		ReadTimeout:       ServerReadTimeout,
+		ReadTimeout:       time.Duration(s.config.HTTPReadTimeoutS) * time.Second,
 		WriteTimeout:      ServerWriteTimeout,
-		IdleTimeout:       ServerIdleTimeout,
-		ReadHeaderTimeout: ServerReadHeaderTimeout,
-		MaxHeaderBytes:    HTTPMaxHeaderBytes,
+		IdleTimeout:       time.Duration(s.config.HTTPIdleTimeoutS) * time.Second,
+		ReadHeaderTimeout: time.Duration(s.config.HTTPReadHeaderTimeoutS) * time.Second,
+		MaxHeaderBytes:    s.config.HTTPMaxHeaderBytes,
+	}
+
+	if len(s.config.ScheduledExports) > 0 {
+		go s.runExportSchedule()
 	}
 
 	s.logger.Printf("HTTP server starting on port %d", s.config.Port)
 	return s.server.ListenAndServe()
 }
 
+// decodeJSONBody decodes the request body into v, capped at max_request_body_bytes.
+// Fields v doesn't have are rejected so a typo doesn't silently save nothing.
+// On failure it has already written the error (413 if too large, else 400) and
+// returns false.
+func (s *APIServer) decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxRequestBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		// encoding/json has no typed error for this; the message is "json: unknown field \"name\""
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			http.Error(w, fmt.Sprintf("Unknown field %s", field), http.StatusBadRequest)
+			return false
+		}
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// writeJSONError sends {"error": msg} with the given status, for failures API
+// clients are likely to handle programmatically (unknown route, wrong method)
+func writeJSONError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// handleAPINotFound catches /api/ paths no handler is registered for
+func (s *APIServer) handleAPINotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "not found")
+}
+
 func (s *APIServer) Stop() error {
+	s.stopOnce.Do(func() { close(s.done) })
 	if s.server != nil {
 		return s.server.Close()
 	}
@@ -1,32 +1,49 @@
 package main
 
 import (
+	"dash-of-pi/camera"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 )
 
 type StorageManager struct {
-	videoDir     string
+	videoDir       string
+	fullDiskPolicy string // FullDiskPolicyOverwrite or FullDiskPolicyStop
+	exportTempDir  string // where exports stage their temp dirs; "" = videoDir
+	ticker         *time.Ticker
+	done           chan struct{}
+
+	// mu guards the cap (changed live from the config API) and the usage cache
+	mu           sync.Mutex
 	storageCapGB int
-	ticker       *time.Ticker
-	done         chan struct{}
-	lastUsed     int64 // Cache last calculated storage usage
+	minRetain    map[string]int // camera ID -> newest segments cleanup must never delete
+	exportTTL    time.Duration  // finished exports older than this are deleted; 0 = never
+	onExpire     func()         // called after an expired export is deleted
+	lastUsed     int64          // Cache last calculated storage usage
 	lastChecked  time.Time
+	cameraDirs   map[string]string // camera ID -> its own video_dir, for cameras recording outside videoDir
+	paused       bool              // maintenance mode: the cleanup loop leaves the disk alone
+
+	fullMu       sync.Mutex
+	storageFull  bool            // over cap under the "stop" policy
+	onFullChange func(full bool) // called when storageFull flips
 }
 
-func NewStorageManager(videoDir string, storageCapGB int) (*StorageManager, error) {
+func NewStorageManager(videoDir string, storageCapGB int, fullDiskPolicy string, checkIntervalS int) (*StorageManager, error) {
 	if err := os.MkdirAll(videoDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create video directory: %w", err)
 	}
 
 	sm := &StorageManager{
-		videoDir:     videoDir,
-		storageCapGB: storageCapGB,
-		ticker:       time.NewTicker(30 * time.Second), // Check every 30 seconds
-		done:         make(chan struct{}),
+		videoDir:       videoDir,
+		storageCapGB:   storageCapGB,
+		fullDiskPolicy: fullDiskPolicy,
+		ticker:         time.NewTicker(time.Duration(checkIntervalS) * time.Second),
+		done:           make(chan struct{}),
 	}
 
 	// Start cleanup goroutine
@@ -41,98 +58,122 @@ func (sm *StorageManager) cleanupLoop() {
 		case <-sm.done:
 			return
 		case <-sm.ticker.C:
+			if sm.isPaused() {
+				continue
+			}
 			if err := sm.enforceStorageCap(); err != nil {
 				// Just log, don't crash
 				fmt.Printf("Storage cleanup error: %v\n", err)
 			}
+			sm.expireExport()
 		}
 	}
 }
 
 func (sm *StorageManager) enforceStorageCap() error {
-	// Get all video files from camera subdirectories
-	entries, err := os.ReadDir(sm.videoDir)
+	// Get all video files from the camera directories
+	dirs, err := sm.listCameraDirs()
 	if err != nil {
 		return fmt.Errorf("failed to read video directory: %w", err)
 	}
 
 	type fileInfo struct {
-		path    string
-		modTime time.Time
-		size    int64
+		path      string
+		modTime   time.Time
+		size      int64
+		order     segmentOrder
+		protected bool // among the camera's newest MinRetainSegments
 	}
 
 	var files []fileInfo
 	var totalSize int64
 
-	// Scan camera subdirectories for video files
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			// Skip non-directories (shouldn't have loose files here)
-			continue
-		}
-
-		// Skip special directories
-		if entry.Name()[0] == '.' {
-			continue
-		}
-
-		cameraDir := filepath.Join(sm.videoDir, entry.Name())
-		cameraEntries, err := os.ReadDir(cameraDir)
+	// Scan camera directories for video files
+	for cameraID, cameraDir := range dirs {
+		segmentFiles, err := camera.ListSegmentFiles(cameraDir)
 		if err != nil {
 			continue
 		}
 
-		for _, videoEntry := range cameraEntries {
-			if videoEntry.IsDir() {
-				continue
-			}
-			if !isVideoFile(videoEntry.Name()) {
-				continue
-			}
-
-			info, err := videoEntry.Info()
-			if err != nil {
+		var cameraFiles []fileInfo
+		for _, file := range segmentFiles {
+			if !isVideoFile(file.Info.Name()) {
 				continue
 			}
 
-			fileSize := info.Size()
-			files = append(files, fileInfo{
-				path:    filepath.Join(cameraDir, videoEntry.Name()),
-				modTime: info.ModTime(),
+			fileSize := file.Info.Size()
+			cameraFiles = append(cameraFiles, fileInfo{
+				path:    file.Path,
+				modTime: file.Info.ModTime(),
 				size:    fileSize,
+				order:   newSegmentOrder(cameraID, file.Info.Name(), file.Info.ModTime()),
 			})
 			totalSize += fileSize
 		}
+
+		// Mark this camera's newest segments as off-limits to cleanup
+		if keep := sm.minRetainFor(cameraID); keep > 0 {
+			sort.Slice(cameraFiles, func(i, j int) bool {
+				return cameraFiles[j].order.before(cameraFiles[i].order)
+			})
+			for i := 0; i < keep && i < len(cameraFiles); i++ {
+				cameraFiles[i].protected = true
+			}
+		}
+		files = append(files, cameraFiles...)
 	}
 
 	// Update cached usage
-	sm.lastUsed = totalSize
-	sm.lastChecked = time.Now()
+	sm.setUsage(totalSize)
+
+	capGB := sm.CapGB()
+	capBytes := int64(capGB) * BytesPerGB
 
-	capBytes := int64(sm.storageCapGB) * BytesPerGB
+	// Evidence-retention mode: never delete footage, stop recording instead
+	if sm.fullDiskPolicy == FullDiskPolicyStop {
+		full := totalSize > capBytes
+		if full && !sm.IsFull() {
+			fmt.Printf("Storage full: using %.2f GB / %d GB, recording stopped (full_disk_policy=stop)\n",
+				float64(totalSize)/BytesPerGB,
+				capGB)
+		}
+		sm.setFull(full)
+		return nil
+	}
 
 	// If over cap, delete oldest files
 	if totalSize > capBytes {
-		// Sort by modification time (oldest first)
-		sort.Slice(files, func(i, j int) bool {
-			return files[i].modTime.Before(files[j].modTime)
-		})
+		// Oldest first, in the same recording order that picked the protected
+		// segments rather than by (possibly jumped) mod time
+		orders := make([]segmentOrder, len(files))
+		for i, f := range files {
+			orders[i] = f.order
+		}
 
 		deletedCount := 0
-		for _, f := range files {
+		skippedProtected, removeFailed := false, false
+		for _, i := range recordingOrder(orders) {
+			f := files[i]
 			if totalSize <= capBytes {
 				break
 			}
+			if f.protected {
+				skippedProtected = true
+				continue
+			}
 
 			if err := os.Remove(f.path); err == nil {
+				os.Remove(camera.SidecarPath(f.path))
+				removeEmptyDayDir(filepath.Dir(f.path))
 				deletedCount++
 				totalSize -= f.size
-				sm.lastUsed = totalSize // Update cache after deletion
+				sm.setUsage(totalSize) // Update cache after deletion
 				fmt.Printf("Deleted old video: %s (modified: %s, size: %.2f MB)\n",
 					filepath.Base(f.path),
 					f.modTime.Format("2006-01-02 15:04:05"),
 					float64(f.size)/BytesPerMB)
+			} else {
+				removeFailed = true
 			}
 		}
 
@@ -140,7 +181,22 @@ func (sm *StorageManager) enforceStorageCap() error {
 			fmt.Printf("Storage cleanup complete: deleted %d video(s), now using %.2f GB / %d GB\n",
 				deletedCount,
 				float64(totalSize)/BytesPerGB,
-				sm.storageCapGB)
+				capGB)
+		}
+		if totalSize > capBytes {
+			var reason string
+			switch {
+			case skippedProtected && removeFailed:
+				reason = "the rest is protected by min_retain_segments or couldn't be deleted"
+			case skippedProtected:
+				reason = "the remaining footage is protected by min_retain_segments"
+			default:
+				reason = "old videos couldn't be deleted"
+			}
+			fmt.Printf("Warning: still over storage cap (%.2f GB / %d GB); %s\n",
+				float64(totalSize)/BytesPerGB,
+				capGB,
+				reason)
 		}
 	}
 
@@ -148,97 +204,259 @@ func (sm *StorageManager) enforceStorageCap() error {
 }
 
 func (sm *StorageManager) GetStorageStats() (used int64, cap int64, err error) {
+	cap = int64(sm.CapGB()) * BytesPerGB
+
 	// Use cached value if recent (within 5 seconds)
-	if time.Since(sm.lastChecked) < 5*time.Second && sm.lastUsed > 0 {
-		cap = int64(sm.storageCapGB) * BytesPerGB
-		return sm.lastUsed, cap, nil
+	sm.mu.Lock()
+	cachedUsed, cachedAt := sm.lastUsed, sm.lastChecked
+	sm.mu.Unlock()
+	if time.Since(cachedAt) < 5*time.Second && cachedUsed > 0 {
+		return cachedUsed, cap, nil
 	}
 
-	// Otherwise, recalculate from camera subdirectories
-	entries, err := os.ReadDir(sm.videoDir)
+	// Otherwise, recalculate from the camera directories
+	dirs, err := sm.listCameraDirs()
 	if err != nil {
 		return 0, 0, err
 	}
 
 	used = 0
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
-		// Skip special directories like .export and .temp_export_*
-		if entry.Name()[0] == '.' {
-			continue
-		}
-
-		cameraDir := filepath.Join(sm.videoDir, entry.Name())
-		cameraEntries, err := os.ReadDir(cameraDir)
+	for _, cameraDir := range dirs {
+		segmentFiles, err := camera.ListSegmentFiles(cameraDir)
 		if err != nil {
 			continue
 		}
 
-		for _, videoEntry := range cameraEntries {
-			if videoEntry.IsDir() {
-				continue
-			}
-			if !isVideoFile(videoEntry.Name()) {
-				continue
-			}
-
-			info, err := videoEntry.Info()
-			if err != nil {
-				continue
+		for _, file := range segmentFiles {
+			if isVideoFile(file.Info.Name()) {
+				used += file.Info.Size()
 			}
-			used += info.Size()
 		}
 	}
 
 	// Update cache
-	sm.lastUsed = used
-	sm.lastChecked = time.Now()
+	sm.setUsage(used)
 
-	cap = int64(sm.storageCapGB) * BytesPerGB
 	return used, cap, nil
 }
 
+// RecalculateUsage drops the cached usage and rescans, e.g. after footage was
+// deleted through the API
+func (sm *StorageManager) RecalculateUsage() {
+	sm.mu.Lock()
+	sm.lastChecked = time.Time{}
+	sm.mu.Unlock()
+	sm.GetStorageStats()
+}
+
+func (sm *StorageManager) setUsage(used int64) {
+	sm.mu.Lock()
+	sm.lastUsed = used
+	sm.lastChecked = time.Now()
+	sm.mu.Unlock()
+}
+
 func (sm *StorageManager) Stop() {
 	sm.ticker.Stop()
 	close(sm.done)
 }
 
-// SetCap updates the storage cap live (no service restart needed).
-// ponytail: storageCapGB is a single int read by the cleanup goroutine; a plain
-// assignment is safe on 64-bit and good enough here.
-func (sm *StorageManager) SetCap(gb int) {
-	if gb > 0 {
-		sm.storageCapGB = gb
+// SetPaused stops or restarts the cleanup loop's deletions (cap enforcement and
+// export expiry); a tick already running finishes first
+func (sm *StorageManager) SetPaused(paused bool) {
+	sm.mu.Lock()
+	sm.paused = paused
+	sm.mu.Unlock()
+}
+
+func (sm *StorageManager) isPaused() bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.paused
+}
+
+// SetCapGB updates the storage cap live (no service restart needed); the next
+// cleanup tick enforces it.
+func (sm *StorageManager) SetCapGB(gb int) {
+	if gb <= 0 {
+		return
+	}
+	sm.mu.Lock()
+	sm.storageCapGB = gb
+	sm.mu.Unlock()
+}
+
+// SetCheckInterval changes how often the storage cap is enforced, live
+func (sm *StorageManager) SetCheckInterval(seconds int) {
+	if seconds < MinStorageCheckIntervalS {
+		return
+	}
+	sm.mu.Lock()
+	sm.ticker.Reset(time.Duration(seconds) * time.Second)
+	sm.mu.Unlock()
+}
+
+// SetMinRetainSegments sets, per camera ID, how many of the newest segments
+// cleanup must keep even when that leaves storage over the cap
+func (sm *StorageManager) SetMinRetainSegments(perCamera map[string]int) {
+	sm.mu.Lock()
+	sm.minRetain = perCamera
+	sm.mu.Unlock()
+}
+
+// SetCameraDirs sets, per camera ID, the video_dir of cameras that record
+// outside the video directory; their footage there counts toward the cap and is
+// cleaned up with the rest
+func (sm *StorageManager) SetCameraDirs(perCamera map[string]string) {
+	sm.mu.Lock()
+	sm.cameraDirs = perCamera
+	sm.mu.Unlock()
+}
+
+func (sm *StorageManager) listCameraDirs() (map[string]string, error) {
+	sm.mu.Lock()
+	overrides := sm.cameraDirs
+	sm.mu.Unlock()
+	return cameraDirs(sm.videoDir, overrides)
+}
+
+// SetExportTempDir moves export staging out of the video directory, e.g. onto a
+// larger or faster disk than the SD card. Call it before any export starts.
+func (sm *StorageManager) SetExportTempDir(dir string) {
+	sm.exportTempDir = dir
+}
+
+// ExportTempDir returns the directory exports create their temp dirs in
+func (sm *StorageManager) ExportTempDir() string {
+	if sm.exportTempDir == "" {
+		return sm.videoDir
 	}
+	return sm.exportTempDir
 }
 
-// CleanupTempExportDirs removes any leftover temporary export directories
+// SetExportTTLHours makes the cleanup loop delete a finished export once it is
+// older than the given number of hours (0 keeps it until deleted by hand).
+// onExpire is called after the files are removed.
+func (sm *StorageManager) SetExportTTLHours(hours int, onExpire func()) {
+	sm.mu.Lock()
+	sm.exportTTL = time.Duration(hours) * time.Hour
+	sm.onExpire = onExpire
+	sm.mu.Unlock()
+}
+
+// expireExport deletes the export in .export/ and its info file once the export
+// is older than exportTTL. Exports don't count toward the cap, so without this a
+// forgotten one holds its space forever.
+func (sm *StorageManager) expireExport() {
+	sm.mu.Lock()
+	ttl, onExpire := sm.exportTTL, sm.onExpire
+	sm.mu.Unlock()
+	if ttl <= 0 {
+		return
+	}
+
+	exportDir := filepath.Join(sm.videoDir, ".export")
+	expired := false
+	for _, name := range []string{ExportFilename, ExportGIFFilename} {
+		path := filepath.Join(exportDir, name)
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < ttl {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			fmt.Printf("Failed to delete expired export %s: %v\n", name, err)
+			continue
+		}
+		fmt.Printf("Deleted expired export: %s (created: %s, export_ttl_hours: %d)\n",
+			name,
+			info.ModTime().Format("2006-01-02 15:04:05"),
+			int(ttl.Hours()))
+		expired = true
+	}
+
+	if expired {
+		os.Remove(filepath.Join(exportDir, "export_info.json"))
+		if onExpire != nil {
+			onExpire()
+		}
+	}
+}
+
+func (sm *StorageManager) minRetainFor(cameraID string) int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.minRetain[cameraID]
+}
+
+// CapGB returns the current storage cap
+func (sm *StorageManager) CapGB() int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.storageCapGB
+}
+
+// OnFullChange registers a callback invoked whenever the storage-full state changes
+// under the "stop" policy. Must be called before the first cleanup tick.
+func (sm *StorageManager) OnFullChange(fn func(full bool)) {
+	sm.fullMu.Lock()
+	sm.onFullChange = fn
+	sm.fullMu.Unlock()
+}
+
+// IsFull reports whether recording is stopped because the cap was reached under
+// the "stop" policy
+func (sm *StorageManager) IsFull() bool {
+	sm.fullMu.Lock()
+	defer sm.fullMu.Unlock()
+	return sm.storageFull
+}
+
+func (sm *StorageManager) setFull(full bool) {
+	sm.fullMu.Lock()
+	changed := sm.storageFull != full
+	sm.storageFull = full
+	fn := sm.onFullChange
+	sm.fullMu.Unlock()
+
+	if changed && fn != nil {
+		fn(full)
+	}
+}
+
+// CleanupTempExportDirs removes any leftover temporary export directories except keep
 // These can be left behind if the process crashes during export generation
-func (sm *StorageManager) CleanupTempExportDirs() int {
-	entries, err := os.ReadDir(sm.videoDir)
-	if err != nil {
-		fmt.Printf("Failed to read video directory for cleanup: %v\n", err)
-		return 0
+func (sm *StorageManager) CleanupTempExportDirs(keep string) int {
+	dirs := []string{sm.ExportTempDir()}
+	// Exports staged in the video directory before a temp dir was configured
+	if dirs[0] != sm.videoDir {
+		dirs = append(dirs, sm.videoDir)
 	}
 
 	var cleaned int
-	for _, entry := range entries {
-		if !entry.IsDir() {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Printf("Failed to read %s for temp export cleanup: %v\n", dir, err)
+			}
 			continue
 		}
 
-		name := entry.Name()
-		// Check if it's a temporary export directory
-		if len(name) > 13 && name[:13] == ".temp_export_" {
-			dirPath := filepath.Join(sm.videoDir, name)
-			if err := os.RemoveAll(dirPath); err != nil {
-				fmt.Printf("Failed to remove temp export dir %s: %v\n", name, err)
-			} else {
-				fmt.Printf("Cleaned up leftover temp export directory: %s\n", name)
-				cleaned++
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+
+			name := entry.Name()
+			dirPath := filepath.Join(dir, name)
+			// Check if it's a temporary export directory
+			if len(name) > 13 && name[:13] == ".temp_export_" && dirPath != keep {
+				if err := os.RemoveAll(dirPath); err != nil {
+					fmt.Printf("Failed to remove temp export dir %s: %v\n", dirPath, err)
+				} else {
+					fmt.Printf("Cleaned up leftover temp export directory: %s\n", dirPath)
+					cleaned++
+				}
 			}
 		}
 	}
@@ -250,50 +468,138 @@ func isVideoFile(name string) bool {
 	return IsMJPEGFile(name)
 }
 
-// walkCameraVideos walks through camera subdirectories and calls the provided function for each video file
-// filterFunc is called with (cameraDir, fileName, fileInfo) and returns true if the file should be included
-func walkCameraVideos(videoDir string, filterFunc func(cameraDir, fileName string, info os.FileInfo) bool) ([]string, error) {
+// removeEmptyDayDir deletes a daily-layout directory once its last segment is
+// gone, so a whole day disappears as a unit; anything else is left alone
+func removeEmptyDayDir(dir string) {
+	if !camera.IsDayDir(filepath.Base(dir)) {
+		return
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) == 0 {
+		if err := os.Remove(dir); err == nil {
+			fmt.Printf("Removed empty day directory: %s\n", dir)
+		}
+	}
+}
+
+// cameraDirs maps camera IDs to the directories holding their segments: each
+// subdirectory of videoDir, except that a camera in overrides (ID -> its own
+// video_dir) is read from there instead
+func cameraDirs(videoDir string, overrides map[string]string) (map[string]string, error) {
 	entries, err := os.ReadDir(videoDir)
 	if err != nil {
 		return nil, err
 	}
 
-	var videoPaths []string
-
+	dirs := make(map[string]string, len(entries)+len(overrides))
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
-		}
-
 		// Skip special directories like .export and .temp_export_*
-		if entry.Name()[0] == '.' {
-			continue
+		if entry.IsDir() && entry.Name()[0] != '.' {
+			dirs[entry.Name()] = filepath.Join(videoDir, entry.Name())
 		}
+	}
+	for cameraID, dir := range overrides {
+		dirs[cameraID] = dir
+	}
+	return dirs, nil
+}
+
+// cameraVideo is a video file found by walkCameraVideos and the camera it belongs to
+type cameraVideo struct {
+	cameraID string
+	path     string
+}
 
-		cameraDir := filepath.Join(videoDir, entry.Name())
-		cameraEntries, err := os.ReadDir(cameraDir)
+// walkCameraVideos walks through the camera directories (see cameraDirs) and calls the provided function for each video file
+// filterFunc is called with (cameraID, fileName, fileInfo) and returns true if the file should be included.
+// The camera ID comes from dirs, as the file's parent directory may be a day directory or a per-camera video_dir.
+func walkCameraVideos(dirs map[string]string, filterFunc func(cameraID, fileName string, info os.FileInfo) bool) ([]cameraVideo, error) {
+	var videos []cameraVideo
+
+	for cameraID, cameraDir := range dirs {
+		segmentFiles, err := camera.ListSegmentFiles(cameraDir)
 		if err != nil {
 			continue
 		}
 
-		for _, videoEntry := range cameraEntries {
-			if videoEntry.IsDir() {
-				continue
-			}
-			if !isVideoFile(videoEntry.Name()) {
+		for _, file := range segmentFiles {
+			if !isVideoFile(file.Info.Name()) {
 				continue
 			}
 
-			info, err := videoEntry.Info()
-			if err != nil {
-				continue
+			if filterFunc == nil || filterFunc(cameraID, file.Info.Name(), file.Info) {
+				videos = append(videos, cameraVideo{cameraID: cameraID, path: file.Path})
 			}
+		}
+	}
 
-			if filterFunc == nil || filterFunc(cameraDir, videoEntry.Name(), info) {
-				videoPaths = append(videoPaths, filepath.Join(cameraDir, videoEntry.Name()))
-			}
+	return videos, nil
+}
+
+// segmentOrder is the sort key for a recorded segment. The wall clock on an
+// RTC-less Pi can jump (e.g. when NTP syncs after boot), so within one camera
+// the filename's sequence number wins over any timestamp. Different cameras'
+// sequence numbers are unrelated, so segments from several cameras are put in
+// order with recordingOrder rather than a single comparison.
+type segmentOrder struct {
+	cameraID string
+	start    time.Time // filename timestamp, or mod time for unparseable names
+	seq      int       // -1 if the filename has no sequence number
+}
+
+func newSegmentOrder(cameraID, name string, modTime time.Time) segmentOrder {
+	start, seq, ok := camera.ParseSegmentName(name)
+	if !ok {
+		start, seq = modTime, -1
+	}
+	return segmentOrder{cameraID: cameraID, start: start, seq: seq}
+}
+
+// before reports whether segment a was recorded before segment b, both from
+// the same camera. Segments without a sequence number predate numbering, so
+// they come first, by timestamp; numbered segments follow by number.
+func (a segmentOrder) before(b segmentOrder) bool {
+	if (a.seq >= 0) != (b.seq >= 0) {
+		return a.seq < 0
+	}
+	if a.seq >= 0 {
+		return a.seq < b.seq
+	}
+	return a.start.Before(b.start)
+}
+
+// recordingOrder returns the indexes of orders, oldest segment first. Each
+// camera's segments keep their own order (see before); the cameras are merged
+// by start time, ties going to the lower camera ID.
+func recordingOrder(orders []segmentOrder) []int {
+	byCamera := make(map[string][]int)
+	var cameraIDs []string
+	for i, order := range orders {
+		if _, ok := byCamera[order.cameraID]; !ok {
+			cameraIDs = append(cameraIDs, order.cameraID)
 		}
+		byCamera[order.cameraID] = append(byCamera[order.cameraID], i)
 	}
+	sort.Strings(cameraIDs)
 
-	return videoPaths, nil
+	queues := make([][]int, len(cameraIDs))
+	for n, id := range cameraIDs {
+		queue := byCamera[id]
+		sort.SliceStable(queue, func(i, j int) bool {
+			return orders[queue[i]].before(orders[queue[j]])
+		})
+		queues[n] = queue
+	}
+
+	indexes := make([]int, 0, len(orders))
+	for len(indexes) < len(orders) {
+		next := -1
+		for n, queue := range queues {
+			if len(queue) > 0 && (next < 0 || orders[queue[0]].start.Before(orders[queues[next][0]].start)) {
+				next = n
+			}
+		}
+		indexes = append(indexes, queues[next][0])
+		queues[next] = queues[next][1:]
+	}
+	return indexes
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mixedOrders has front's clock jump back between segments 1 and 2 (so its
+// timestamps interleave with rear's), and each camera has an older unnumbered
+// segment
+func mixedOrders() (orders []segmentOrder, names []string) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	add := func(name, cameraID string, minute, seq int) {
+		orders = append(orders, segmentOrder{cameraID: cameraID, start: base.Add(time.Duration(minute) * time.Minute), seq: seq})
+		names = append(names, name)
+	}
+	add("front-legacy", "front", -30, -1)
+	add("front-1", "front", 10, 1)
+	add("front-2", "front", 0, 2)
+	add("front-3", "front", 1, 3)
+	add("rear-1", "rear", 5, 1)
+	add("rear-2", "rear", 6, 2)
+	add("rear-legacy", "rear", 6, -1)
+	return orders, names
+}
+
+func TestSegmentOrderBeforeIsStrictWeak(t *testing.T) {
+	orders, names := mixedOrders()
+	var front []segmentOrder
+	for _, order := range orders {
+		if order.cameraID == "front" {
+			front = append(front, order)
+		}
+	}
+	for i, a := range front {
+		if a.before(a) {
+			t.Errorf("%s is before itself", names[i])
+		}
+		for j, b := range front {
+			for k, c := range front {
+				if a.before(b) && b.before(c) && !a.before(c) {
+					t.Errorf("%s < %s < %s but not %s < %s", names[i], names[j], names[k], names[i], names[k])
+				}
+			}
+		}
+	}
+}
+
+func TestRecordingOrder(t *testing.T) {
+	orders, names := mixedOrders()
+	want := []string{"front-legacy", "rear-legacy", "rear-1", "rear-2", "front-1", "front-2", "front-3"}
+
+	rng := rand.New(rand.NewSource(1))
+	for run := 0; run < 20; run++ {
+		perm := rng.Perm(len(orders))
+		shuffled := make([]segmentOrder, len(orders))
+		for i, p := range perm {
+			shuffled[i] = orders[p]
+		}
+
+		var got []string
+		for _, i := range recordingOrder(shuffled) {
+			got = append(got, names[perm[i]])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("input order %v: got %v, want %v", perm, got, want)
+		}
+	}
+}
+
+func TestEnforceStorageCapDeletesInRecordingOrder(t *testing.T) {
+	videoDir := t.TempDir()
+	sm := &StorageManager{videoDir: videoDir, storageCapGB: 1}
+	sm.SetMinRetainSegments(map[string]int{"front": 1})
+
+	// The clock jumped back after segment 1, so its timestamp and mod time are
+	// the newest; each segment is a sparse 400 MB, 1.6 GB in all
+	base := time.Now().Add(-time.Hour)
+	minutes := []int{10, 0, 1, 2}
+	paths := make([]string, len(minutes))
+	for i, minute := range minutes {
+		at := base.Add(time.Duration(minute) * time.Minute)
+		paths[i] = writeSegment(t, filepath.Join(videoDir, "front"), "front", at, i+1, at)
+		if err := os.Truncate(paths[i], 400*BytesPerMB); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(paths[i], at, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sm.enforceStorageCap(); err != nil {
+		t.Fatalf("enforceStorageCap: %v", err)
+	}
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		if deleted := os.IsNotExist(err); deleted != (i < 2) {
+			t.Errorf("segment %d deleted: %v, want only segments 1 and 2 deleted", i+1, deleted)
+		}
+	}
+}
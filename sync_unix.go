@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// syncDisks flushes written data to disk, so the card can be pulled safely
+func syncDisks() {
+	syscall.Sync()
+}
@@ -22,9 +22,12 @@ function wireUI() {
 
 	// Live stream camera selector
 	document.getElementById('streamCamera').addEventListener('change', stream.switchStreamCamera);
+	document.getElementById('streamReplayToggle').addEventListener('click', stream.toggleReplay);
+	document.addEventListener('visibilitychange', stream.onVisibilityChange);
 
 	// Export range + actions
 	document.getElementById('lifetimeRangeBtn').addEventListener('click', () => dashboard.setRange('lifetime'));
+	document.getElementById('dayRangeBtn').addEventListener('click', () => dashboard.setRange('day'));
 	document.getElementById('customRangeBtn').addEventListener('click', () => dashboard.setRange('custom'));
 	document.getElementById('segmentTimezoneToggle').addEventListener('click', dashboard.toggleSegmentTimezone);
 	document.getElementById('serverExportBtn').addEventListener('click', dashboard.generateVideo);
@@ -63,6 +66,7 @@ function startApp() {
 	dashboard.setRange(state.activeRange);
 	dashboard.setSegmentTimezone(state.segmentTimezone);
 	dashboard.loadStatus();
+	dashboard.checkClockSkew();
 	cameras.loadCameras().then(() => stream.startStream());
 	dashboard.checkExportStatus();
 	dashboard.checkRemuxStatus();
@@ -70,6 +74,7 @@ function startApp() {
 	setInterval(cameras.loadCameras, 30000);
 	setInterval(dashboard.checkExportStatus, 3000);
 	setInterval(dashboard.checkRemuxStatus, 3000);
+	setInterval(dashboard.checkClockSkew, 60000);
 }
 
 wireUI();
@@ -11,7 +11,15 @@ export async function apiCall(url, options = {}) {
 		document.getElementById('authModal').classList.add('active');
 		throw new Error('Unauthorized');
 	}
-	if (!res.ok) throw new Error(`API error: ${res.status} ${res.statusText}`);
+	if (!res.ok) {
+		// Handlers reply with a plain-text reason (e.g. "Invalid rotation"), or
+		// {"error": ...} for unknown routes and wrong methods; show it
+		let reason = (await res.text().catch(() => '')).trim();
+		if (reason.startsWith('{')) {
+			try { reason = JSON.parse(reason).error || reason; } catch (_) {}
+		}
+		throw new Error(reason || `API error: ${res.status} ${res.statusText}`);
+	}
 	return res.json();
 }
 
@@ -52,6 +52,7 @@ export function onDeviceSelectChange() {
 		rotSel.value = '0';
 		tsGroup.classList.add('hidden');
 		document.getElementById('cameraEmbedTimestamp').checked = false;
+		document.getElementById('cameraLabelOverlay').checked = false;
 		document.getElementById('deviceHint').textContent = 'CSI camera — resolution/FPS/timestamp managed by libcamera.';
 		return;
 	}
@@ -154,7 +155,7 @@ export function renderCameraList(cameras) {
 			<div class="camera-header">
 				<div class="camera-info">
 					<div class="camera-name">${esc(cam.name)}</div>
-					<div class="camera-meta">${cam.res_width}×${cam.res_height} · ${cam.fps} fps · ${cam.rotation}° · ID: ${esc(cam.id)}</div>
+					<div class="camera-meta">${cam.res_width}×${cam.res_height} · ${cam.fps} fps · ${esc(cam.orientation || cam.rotation + '°')} · ID: ${esc(cam.id)}</div>
 					<div class="camera-device">${esc(cam.device)}</div>
 				</div>
 				<span class="camera-status ${cam.enabled ? 'status-active' : 'status-inactive'}">${cam.enabled ? 'Active' : 'Disabled'}</span>
@@ -175,11 +176,17 @@ export function openAddCameraModal() {
 	document.getElementById('cameraName').value = '';
 	document.getElementById('cameraDevice').value = '';
 	document.getElementById('cameraRotation').value = '0';
+	document.getElementById('cameraFlipHorizontal').checked = false;
+	document.getElementById('cameraFlipVertical').checked = false;
 	document.getElementById('cameraResWidth').value = '';
 	document.getElementById('cameraResHeight').value = '';
 	document.getElementById('cameraFPSManual').value = '';
 	document.getElementById('cameraMJPEGQuality').value = '8';
+	document.getElementById('cameraMinRetainSegments').value = '0';
+	document.getElementById('cameraSnapshotInterval').value = '0';
+	document.getElementById('cameraSnapshotRetain').value = '0';
 	document.getElementById('cameraEmbedTimestamp').checked = true;
+	document.getElementById('cameraLabelOverlay').checked = false;
 	document.getElementById('cameraEnabled').checked = true;
 	document.getElementById('cameraModal').classList.add('active');
 	loadDiscovery().then(() => {
@@ -201,11 +208,17 @@ export async function editCamera(cameraId) {
 		document.getElementById('cameraName').value = cam.name;
 		document.getElementById('cameraDevice').value = cam.device;
 		document.getElementById('cameraRotation').value = cam.rotation;
+		document.getElementById('cameraFlipHorizontal').checked = !!cam.flip_horizontal;
+		document.getElementById('cameraFlipVertical').checked = !!cam.flip_vertical;
 		document.getElementById('cameraResWidth').value = cam.res_width;
 		document.getElementById('cameraResHeight').value = cam.res_height;
 		document.getElementById('cameraFPSManual').value = cam.fps;
 		document.getElementById('cameraMJPEGQuality').value = cam.mjpeg_quality;
+		document.getElementById('cameraMinRetainSegments').value = cam.min_retain_segments || 0;
+		document.getElementById('cameraSnapshotInterval').value = cam.snapshot_interval_s || 0;
+		document.getElementById('cameraSnapshotRetain').value = cam.snapshot_retain || 0;
 		document.getElementById('cameraEmbedTimestamp').checked = cam.embed_timestamp;
+		document.getElementById('cameraLabelOverlay').checked = !!cam.label_overlay;
 		document.getElementById('cameraEnabled').checked = cam.enabled;
 		document.getElementById('cameraModal').classList.add('active');
 
@@ -242,10 +255,16 @@ export async function saveCameraConfig() {
 	const payload = {
 		name, device,
 		rotation: parseInt(document.getElementById('cameraRotation').value, 10) || 0,
+		flip_horizontal: document.getElementById('cameraFlipHorizontal').checked,
+		flip_vertical: document.getElementById('cameraFlipVertical').checked,
 		res_width: width, res_height: height, fps,
 		bitrate: 1024, // unused by MJPEG capture; kept for config compatibility
 		mjpeg_quality: parseInt(document.getElementById('cameraMJPEGQuality').value, 10) || 8,
+		min_retain_segments: Math.max(0, parseInt(document.getElementById('cameraMinRetainSegments').value, 10) || 0),
+		snapshot_interval_s: Math.max(0, parseInt(document.getElementById('cameraSnapshotInterval').value, 10) || 0),
+		snapshot_retain: Math.max(0, parseInt(document.getElementById('cameraSnapshotRetain').value, 10) || 0),
 		embed_timestamp: document.getElementById('cameraEmbedTimestamp').checked,
+		label_overlay: document.getElementById('cameraLabelOverlay').checked,
 		enabled: document.getElementById('cameraEnabled').checked,
 	};
 	if (state.editingCameraId) payload.id = state.editingCameraId;
@@ -253,8 +272,8 @@ export async function saveCameraConfig() {
 		const url = state.editingCameraId
 			? `/api/cameras/update?id=${encodeURIComponent(state.editingCameraId)}`
 			: '/api/cameras/add';
-		await apiCall(url, { method: state.editingCameraId ? 'PUT' : 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(payload) });
-		notify(`Camera ${state.editingCameraId ? 'updated' : 'added'}`, 'success');
+		const res = await apiCall(url, { method: state.editingCameraId ? 'PUT' : 'POST', headers: { 'Content-Type': 'application/json' }, body: JSON.stringify(payload) });
+		notify(res.message || `Camera ${state.editingCameraId ? 'updated' : 'added'}`, 'success');
 		closeCameraModal();
 		setTimeout(loadCameras, 500);
 	} catch (err) {
@@ -270,8 +289,8 @@ export async function deleteCamera(cameraId) {
 	});
 	if (!ok) return;
 	try {
-		await apiCall(`/api/cameras/delete?id=${encodeURIComponent(cameraId)}`, { method: 'DELETE' });
-		notify('Camera deleted', 'success');
+		const res = await apiCall(`/api/cameras/delete?id=${encodeURIComponent(cameraId)}`, { method: 'DELETE' });
+		notify(res.message || 'Camera deleted', 'success');
 		loadCameras();
 	} catch (err) {
 		notify('Failed to delete: ' + err.message, 'error');
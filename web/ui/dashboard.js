@@ -22,6 +22,26 @@ export async function loadStatus() {
 	} catch (_) {}
 }
 
+// Warn when the Pi's clock is off from the browser's by more than this. Without an
+// RTC the Pi boots with a stale time until NTP syncs, which skews every timestamp.
+const CLOCK_SKEW_WARN_MS = 60 * 1000;
+
+export async function checkClockSkew() {
+	try {
+		const sent = Date.now();
+		const data = await apiCall('/api/time');
+		const received = Date.now();
+		// Compare against the midpoint of the request so network latency doesn't count as skew
+		const skew = data.unix_ms - (sent + received) / 2;
+		const banner = document.getElementById('clockSkewBanner');
+		banner.classList.toggle('hidden', Math.abs(skew) <= CLOCK_SKEW_WARN_MS);
+		if (Math.abs(skew) > CLOCK_SKEW_WARN_MS) {
+			document.getElementById('clockSkewText').textContent =
+				`Its time is ${formatUptime(Math.abs(skew))} ${skew > 0 ? 'ahead of' : 'behind'} this device (Pi: ${utcString(data.time)}, ${data.timezone}). Recording times will be off until it syncs (NTP or an RTC).`;
+		}
+	} catch (_) {}
+}
+
 export function renderVideoList(videos) {
 	const c = document.getElementById('videoList');
 	c.dataset.videos = JSON.stringify(videos || []);
@@ -107,8 +127,15 @@ export function toggleSegmentTimezone() {
 export function setRange(type) {
 	state.activeRange = type;
 	document.getElementById('lifetimeRangeBtn').classList.toggle('active', type === 'lifetime');
+	document.getElementById('dayRangeBtn').classList.toggle('active', type === 'day');
 	document.getElementById('customRangeBtn').classList.toggle('active', type === 'custom');
-	document.getElementById('customDateForm').classList.toggle('hidden', type === 'lifetime');
+	document.getElementById('customDateForm').classList.toggle('hidden', type !== 'custom');
+	document.getElementById('dayForm').classList.toggle('hidden', type !== 'day');
+	const day = document.getElementById('exportDay');
+	if (type === 'day' && !day.value) {
+		const now = new Date();
+		day.value = `${now.getFullYear()}-${String(now.getMonth() + 1).padStart(2, '0')}-${String(now.getDate()).padStart(2, '0')}`;
+	}
 }
 
 function getDateRange() {
@@ -119,11 +146,20 @@ function getDateRange() {
 }
 
 export async function generateVideo() {
-	const range = getDateRange(); if (!range) return;
+	let url;
+	if (state.activeRange === 'day') {
+		const day = document.getElementById('exportDay').value;
+		if (!day) { notify('Please pick a day', 'error'); return; }
+		url = `/api/videos/download-day?date=${day}`;
+	} else {
+		const range = getDateRange(); if (!range) return;
+		const format = document.getElementById('exportFormat').value;
+		url = `/api/videos/generate-export?start=${encodeURIComponent(range.start)}&end=${encodeURIComponent(range.end)}&format=${format}`;
+	}
 	const btn = document.getElementById('serverExportBtn');
 	btn.disabled = true; btn.textContent = 'Starting…';
 	try {
-		await apiCall(`/api/videos/generate-export?start=${encodeURIComponent(range.start)}&end=${encodeURIComponent(range.end)}`, { method: 'POST' });
+		await apiCall(url, { method: 'POST' });
 		notify('Export started on Pi', 'info');
 		setTimeout(checkExportStatus, 500);
 	} catch (err) {
@@ -140,11 +176,13 @@ export async function checkExportStatus() {
 			prog.classList.remove('hidden'); dl.classList.add('hidden');
 			document.getElementById('exportProgressLabel').textContent = 'Exporting on Pi…';
 			document.getElementById('exportProgressText').textContent = d.progress || 'Working…';
-			document.getElementById('exportProgressFill').style.width = (d.current_size_mb > 0 ? Math.min(80, d.current_size_mb) : 20) + '%';
+			const pct = d.percent > 0 ? d.percent : d.total_segments > 0 ? 100 * d.processed_files / d.total_segments : (d.current_size_mb > 0 ? Math.min(80, d.current_size_mb) : 20);
+			document.getElementById('exportProgressFill').style.width = pct + '%';
 		} else if (d.available) {
+			state.exportFormat = d.format || 'mp4';
 			prog.classList.add('hidden'); dl.classList.remove('hidden');
 			document.getElementById('exportProgressFill').style.width = '100%';
-			document.getElementById('exportDownloadInfo').textContent = `${utcString(d.start_time)} → ${utcString(d.end_time)} | ${(d.size / 1e6).toFixed(1)} MB`;
+			document.getElementById('exportDownloadInfo').textContent = `${utcString(d.start_time)} → ${utcString(d.end_time)} | ${state.exportFormat.toUpperCase()} | ${(d.size / 1e6).toFixed(1)} MB`;
 		} else { prog.classList.add('hidden'); dl.classList.add('hidden'); }
 	} catch (_) {}
 }
@@ -171,7 +209,7 @@ export async function checkRemuxStatus() {
 	} catch (_) {}
 }
 
-export function downloadExport() { triggerDownload(`/api/videos/download-export?token=${state.authToken}`, 'dashcam_export.mp4'); }
+export function downloadExport() { triggerDownload(`/api/videos/download-export?token=${state.authToken}`, `dashcam_export.${state.exportFormat}`); }
 
 export async function deleteExport() {
 	const ok = await confirmDialog({ title: 'Delete export', message: 'Delete the current export? You can generate a new one anytime.', confirmText: 'Delete' });
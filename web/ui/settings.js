@@ -7,6 +7,7 @@ export async function loadGeneralSettings() {
 	try {
 		const cfg = await apiCall('/api/config');
 		document.getElementById('cfgStorageCap').value = cfg.storage_cap_gb;
+		document.getElementById('cfgStorageCheckInterval').value = cfg.storage_check_interval_s;
 		document.getElementById('cfgSegmentLen').value = cfg.segment_length_s;
 		document.getElementById('cfgPort').value = cfg.port;
 	} catch (_) {}
@@ -16,6 +17,7 @@ export async function loadGeneralSettings() {
 export async function saveGeneralSettings() {
 	const payload = {
 		storage_cap_gb: parseInt(document.getElementById('cfgStorageCap').value, 10) || 0,
+		storage_check_interval_s: parseInt(document.getElementById('cfgStorageCheckInterval').value, 10) || 0,
 		segment_length_s: parseInt(document.getElementById('cfgSegmentLen').value, 10) || 0,
 		port: parseInt(document.getElementById('cfgPort').value, 10) || 0,
 	};
@@ -3,8 +3,10 @@ export const state = {
 	authToken: localStorage.getItem('authToken'),
 	editingCameraId: null,
 	activeRange: 'lifetime',
+	exportFormat: 'mp4', // format of the export currently available for download
 	streamCameraId: null,
-	streamInterval: null,
+	streamTimer: null,
+	streamReplay: false, // play completed segments instead of polling live frames
 	segmentTimezone: localStorage.getItem('segmentTimezone') || 'local',
 	discovered: { devices: [], csi_available: false },
 	currentDev: null,
@@ -1,24 +1,127 @@
-// Live MJPEG-ish stream: polls /api/stream/frame and swaps an <img>.
+// Live MJPEG-ish stream: polls /api/stream/frame and swaps an <img>. Replay mode
+// instead plays completed segments back-to-back on a <canvas>.
 import { state } from './state.js';
 
+// Stays above the server's stream_frame_min_interval_ms (429 if faster).
+const FRAME_INTERVAL_MS = 500;
+
+// How long replay waits before asking again when no newer segment has finished.
+const REPLAY_RETRY_MS = 2000;
+
+let img = null;
+let loading = false;
+let replayGen = 0; // bumped to stop a running replay loop
+
+// Each poll schedules the next one only after the previous frame settles, so a slow
+// device never queues up timers; nothing is scheduled while the page is hidden.
+function poll() {
+	state.streamTimer = null;
+	if (!img || document.hidden) return;
+	loading = true;
+	const cam = state.streamCameraId ? `&camera=${encodeURIComponent(state.streamCameraId)}` : '';
+	const next = new Image();
+	const done = () => {
+		loading = false;
+		if (!document.hidden) state.streamTimer = setTimeout(poll, FRAME_INTERVAL_MS);
+	};
+	next.onload = () => { img.src = next.src; done(); };
+	next.onerror = done;
+	// placeholder=1: a "camera starting" image instead of a 503 (broken image) before the first frame
+	next.src = `/api/stream/frame?token=${state.authToken}${cam}&placeholder=1&t=${Date.now()}`;
+}
+
 export function startStream() {
 	const c = document.getElementById('playerContainer');
+	replayGen++;
+	if (state.streamTimer) { clearTimeout(state.streamTimer); state.streamTimer = null; }
+	if (state.streamReplay) {
+		c.innerHTML = '<div class="rec-pill"><span class="dot"></span><span id="replayLabel">REPLAY</span></div><canvas id="replayCanvas" class="stream-viewer"></canvas>';
+		img = null;
+		replay(replayGen);
+		return;
+	}
 	c.innerHTML = '<div class="rec-pill"><span class="dot"></span>LIVE</div><img id="liveStream" class="stream-viewer" alt="Live stream">';
-	const img = document.getElementById('liveStream');
-	let loading = false;
+	img = document.getElementById('liveStream');
+	if (!loading) poll();
+}
+
+export function toggleReplay() {
+	state.streamReplay = !state.streamReplay;
+	document.getElementById('streamReplayToggle').textContent = state.streamReplay ? 'Live' : 'Replay';
+	startStream();
+}
 
-	if (state.streamInterval) clearInterval(state.streamInterval);
-	state.streamInterval = setInterval(() => {
-		if (loading) return;
-		loading = true;
-		const cam = state.streamCameraId ? `&camera=${encodeURIComponent(state.streamCameraId)}` : '';
-		const next = new Image();
-		next.onload = () => { img.src = next.src; loading = false; };
-		next.onerror = () => { loading = false; };
-		next.src = `/api/stream/frame?token=${state.authToken}${cam}&t=${Date.now()}`;
-	}, 40);
+const sleep = ms => new Promise(r => setTimeout(r, ms));
+
+// replay plays each completed segment at the camera's FPS, then asks the server for
+// the one recorded after it, giving full-quality playback one segment behind live.
+// It stops once replayGen moves on (mode switch or restart).
+async function replay(gen) {
+	const canvas = document.getElementById('replayCanvas');
+	const ctx = canvas.getContext('2d');
+	let cam = state.streamCameraId, after = '';
+	while (gen === replayGen) {
+		if (document.hidden) { await sleep(REPLAY_RETRY_MS); continue; }
+		if (cam !== state.streamCameraId) { cam = state.streamCameraId; after = ''; }
+		const seg = await nextSegment(cam, after).catch(() => null);
+		if (!seg) { await sleep(REPLAY_RETRY_MS); continue; }
+		// Two or more finished segments queued up means playback fell behind; jump to the newest
+		after = seg.remaining > 1 ? '' : seg.file;
+		if (!after) continue;
+		const frames = await fetchFrames(seg.url).catch(() => []);
+		const label = document.getElementById('replayLabel');
+		if (label) label.textContent = 'REPLAY ' + seg.file;
+		const interval = 1000 / (seg.fps || 30);
+		for (const frame of frames) {
+			if (gen !== replayGen || cam !== state.streamCameraId) break;
+			const t = performance.now();
+			try {
+				const bmp = await createImageBitmap(frame);
+				if (canvas.width !== bmp.width || canvas.height !== bmp.height) { canvas.width = bmp.width; canvas.height = bmp.height; }
+				ctx.drawImage(bmp, 0, 0);
+				bmp.close();
+			} catch (_) {}
+			await sleep(Math.max(0, interval - (performance.now() - t)));
+		}
+	}
+}
+
+async function nextSegment(cam, after) {
+	const q = new URLSearchParams({ token: state.authToken });
+	if (cam) q.set('camera', cam);
+	if (after) q.set('after', after);
+	const r = await fetch(`/api/stream/latest-segment?${q}`);
+	if (r.status !== 200) return null; // 204: nothing newer has finished yet
+	return r.json();
+}
+
+// fetchFrames downloads a whole MJPEG segment and cuts it into JPEG blobs. A frame
+// ends at an FFD9 followed by the next frame's FFD8 FF or by the end of the file.
+async function fetchFrames(url) {
+	const r = await fetch(`${url}&token=${state.authToken}`);
+	if (!r.ok) return [];
+	const buf = new Uint8Array(await r.arrayBuffer());
+	const frames = [];
+	let start = -1;
+	for (let i = 0; i + 1 < buf.length; i++) {
+		if (buf[i] !== 0xFF) continue;
+		if (start < 0 && buf[i + 1] === 0xD8 && buf[i + 2] === 0xFF) start = i;
+		else if (start >= 0 && buf[i + 1] === 0xD9 && (i + 2 === buf.length || (buf[i + 2] === 0xFF && buf[i + 3] === 0xD8))) {
+			frames.push(new Blob([buf.subarray(start, i + 2)], { type: 'image/jpeg' }));
+			start = -1;
+			i++;
+		}
+	}
+	return frames;
+}
+
+// onVisibilityChange pauses polling while the tab is hidden and resumes it on return.
+export function onVisibilityChange() {
+	if (document.hidden) {
+		if (state.streamTimer) { clearTimeout(state.streamTimer); state.streamTimer = null; }
+	} else if (img && !state.streamTimer && !loading) poll();
 }
 
 export function switchStreamCamera() {
 	state.streamCameraId = document.getElementById('streamCamera').value;
-}
\ No newline at end of file
+}
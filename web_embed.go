@@ -0,0 +1,42 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// webAssets is the web/ directory compiled into the binary, so the dashboard
+// still loads when no web directory (or only part of one) is installed
+//
+//go:embed web
+var webAssets embed.FS
+
+// getEmbeddedHTML returns the dashboard page built into the binary
+func getEmbeddedHTML() []byte {
+	data, _ := webAssets.ReadFile("web/index.html")
+	return data
+}
+
+// embeddedWebFS serves the embedded assets with paths relative to web/
+func embeddedWebFS() http.FileSystem {
+	sub, err := fs.Sub(webAssets, "web")
+	if err != nil {
+		panic(err) // "web" is fixed at compile time
+	}
+	return http.FS(sub)
+}
+
+// fallbackFS serves files from primary, falling back to secondary for any file
+// primary doesn't have
+type fallbackFS struct {
+	primary   http.FileSystem
+	secondary http.FileSystem
+}
+
+func (f fallbackFS) Open(name string) (http.File, error) {
+	if file, err := f.primary.Open(name); err == nil {
+		return file, nil
+	}
+	return f.secondary.Open(name)
+}